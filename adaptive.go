@@ -0,0 +1,33 @@
+package main
+
+import "time"
+
+// nextPollInterval returns how long to wait before the next poll. With -poll.adaptive, that's -poll.min-interval while any device is moving
+// and -poll.max-interval once every device is stationary, or the target's poll interval until the motion of a device is known.
+func (c *gpsdClient) nextPollInterval() time.Duration {
+	if !*adaptivePoll {
+		return c.pollInterval
+	}
+	moving, known := c.exporter.anyMoving()
+	switch {
+	case !known:
+		return c.pollInterval
+	case moving:
+		return *minPollInterval
+	default:
+		return *maxPollInterval
+	}
+}
+
+// anyMoving reports whether any device is moving, and whether the motion of any device is known yet
+func (e *exporter) anyMoving() (moving, known bool) {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	for _, m := range e.motion {
+		if m.moving {
+			return true, true
+		}
+		known = known || !m.stationarySince.IsZero()
+	}
+	return false, known
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// readToken reads a token such as the bearer token required by the admin endpoints, empty if no file is configured
+func readToken(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// adminHandler only allows POST requests to h, authenticated with the bearer token
+func adminHandler(token string, h http.HandlerFunc) http.HandlerFunc {
+	return authenticated(token, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	})
+}
+
+// bearerToken returns the token of a request's Authorization header, which must use the Bearer scheme
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return token, true
+}
+
+// authenticated only allows requests to h with the bearer token, rejecting every request if the token is empty
+func authenticated(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		given, ok := bearerToken(r)
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			log.Warnf("Rejecting unauthenticated admin request from %s", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// adminResetHandler clears the report metrics of every source
+func adminResetHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("Resetting metrics on request from %s", r.RemoteAddr)
+		for _, e := range sources.list() {
+			e.resetReports()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// adminClientsHandler applies action to the gpsd clients matching the optional target query parameter, failing if it fails for any
+func adminClientsHandler(sources *sourceSet, verb string, action func(*gpsdClient) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		var failed []string
+		matched := false
+		for _, c := range sources.gpsdClients() {
+			if target != "" && !c.is(target) {
+				continue
+			}
+			matched = true
+			log.Infof("Request from %s to %s %s", r.RemoteAddr, verb, c.addr)
+			if err := action(c); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", c.addr, err))
+			}
+		}
+		switch {
+		case !matched:
+			http.Error(w, fmt.Sprintf("no gpsd target %q", target), http.StatusNotFound)
+		case len(failed) > 0:
+			http.Error(w, strings.Join(failed, "\n"), http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// pollNow sends a POLL command right away
+func pollNow(c *gpsdClient) error {
+	if err := c.poll(); err != nil {
+		return err
+	}
+	c.exporter.setLastPoll(time.Now())
+	return nil
+}
+
+// adminResetMaximaHandler restarts the session maximum speed and altitude of every source
+func adminResetMaximaHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("Resetting session maxima on request from %s", r.RemoteAddr)
+		for _, e := range sources.list() {
+			e.resetMaxima()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
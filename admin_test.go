@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticated(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		token, header string
+		status        int
+	}{
+		{"bearer token", "s3cret", "Bearer s3cret", http.StatusNoContent},
+		{"lower case scheme", "s3cret", "bearer s3cret", http.StatusNoContent},
+		{"no header", "s3cret", "", http.StatusUnauthorized},
+		{"token without scheme", "s3cret", "s3cret", http.StatusUnauthorized},
+		{"other scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer secret", http.StatusUnauthorized},
+		{"token prefix", "s3cret", "Bearer s3c", http.StatusUnauthorized},
+		{"empty bearer token", "s3cret", "Bearer ", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+		{"no token configured without header", "", "", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := authenticated(tt.token, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusNoContent) })
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reset", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+		})
+	}
+}
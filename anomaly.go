@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// anomalyTypes are the implausible changes between consecutive fixes that may indicate spoofing
+var anomalyTypes = []string{"position_jump", "time_jump"}
+
+// anomalyState is the previous fix of a device that the next one is checked against
+type anomalyState struct {
+	lat, lon float64
+	fixTime  time.Time // GPS time of the fix
+	received time.Time // System time the fix was received
+}
+
+// checkAnomalies flags a fix that moved faster than -anomaly.max-speed from the previous one, or whose GPS time stepped by more than
+// -anomaly.max-time-step relative to the system clock. Such jumps are physically implausible, so they're a basic spoofing tripwire.
+func (e *exporter) checkAnomalies(tpv *TPV) {
+	t, ok := fixTime(tpv)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	a, ok := e.anomalies[tpv.Device]
+	if !ok {
+		a = &anomalyState{}
+		e.anomalies[tpv.Device] = a
+		for _, typ := range anomalyTypes {
+			e.anomalyCounts.WithLabelValues(tpv.Device, typ) // Exported from zero so increase() sees the first anomaly
+		}
+	} else {
+		dt := t.Sub(a.fixTime).Seconds()
+		speed := distance(a.lat, a.lon, tpv.Lat, tpv.Lon) / dt
+		positionJump := *anomalyMaxSpeed > 0 && dt > 0 && speed > *anomalyMaxSpeed
+		step := t.Sub(a.fixTime) - now.Sub(a.received)
+		timeJump := *anomalyMaxTimeStep > 0 && (step > *anomalyMaxTimeStep || -step > *anomalyMaxTimeStep)
+		if positionJump {
+			log.Warnf("Position of %s jumped at %.0f m/s", tpv.Device, speed)
+		}
+		if timeJump {
+			log.Warnf("GPS time of %s stepped by %s relative to the system clock", tpv.Device, step.Round(time.Millisecond))
+		}
+		e.setAnomaly(tpv.Device, "position_jump", positionJump)
+		e.setAnomaly(tpv.Device, "time_jump", timeJump)
+	}
+	a.lat, a.lon, a.fixTime, a.received = tpv.Lat, tpv.Lon, t, now
+}
+
+// setAnomaly exports whether the latest fix of a device showed an anomaly, counting it if so
+func (e *exporter) setAnomaly(device, typ string, detected bool) {
+	g := e.pairSeries(e.anomalyDetected, device, typ)
+	if !detected {
+		g.Set(0)
+		return
+	}
+	g.Set(1)
+	e.anomalyCounts.WithLabelValues(device, typ).Inc()
+}
@@ -0,0 +1,19 @@
+package main
+
+// antennaStates are the antenna supervisor states by their TPV ant value
+var antennaStates = map[float64]string{1: "ok", 2: "open", 3: "short"}
+
+// updateAntenna exports the antenna supervisor state of a device as one gauge per state, skipping receivers that don't report it
+func (e *exporter) updateAntenna(tpv *TPV) {
+	current, ok := antennaStates[tpv.Ant]
+	if !ok {
+		return
+	}
+	for _, state := range antennaStates {
+		if state == current {
+			e.pairSeries(e.antennaStatus, tpv.Device, state).Set(1)
+		} else {
+			e.pairSeries(e.antennaStatus, tpv.Device, state).Set(0)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sessions let EventSource, which can't set headers, authenticate with a cookie rather than a token in the URL that ends up in logs
+const (
+	apiSessionCookie = "gpsd_exporter_session"
+	apiSessionTTL    = 10 * time.Minute // Since the session was last used
+)
+
+// apiAccess guards the JSON, streaming and debug endpoints for browser dashboards served from other origins
+type apiAccess struct {
+	token   string          // Bearer token required by the endpoints, empty for none
+	origins map[string]bool // Origins allowed to make cross-origin requests, "*" for any
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // Expiry of each session by ID
+}
+
+func newAPIAccess(token, origins string) *apiAccess {
+	a := &apiAccess{token: token, origins: map[string]bool{}, sessions: map[string]time.Time{}}
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			a.origins[origin] = true
+		}
+	}
+	return a
+}
+
+// allowed reports whether origin may make cross-origin requests
+func (a *apiAccess) allowed(origin string) bool {
+	return a.origins["*"] || a.origins[origin]
+}
+
+// credentialed reports whether the allowed origins may send the session cookie. Any origin may not, since any site
+// could then use the sessions of its visitors, so dashboards allowed with * send the bearer token instead.
+func (a *apiAccess) credentialed() bool {
+	return len(a.origins) > 0 && !a.origins["*"]
+}
+
+// sameOrigin reports whether origin is that of the exporter as the request's host names it, as for the web UI
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == host
+}
+
+// authorized reports whether a request carries the bearer token or the cookie of a live session, which it keeps alive
+func (a *apiAccess) authorized(r *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+	if given, ok := bearerToken(r); ok && subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) == 1 {
+		return true
+	}
+	cookie, err := r.Cookie(apiSessionCookie)
+	if err != nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	expiry, ok := a.sessions[cookie.Value]
+	if !ok || time.Now().After(expiry) {
+		return false
+	}
+	a.sessions[cookie.Value] = time.Now().Add(apiSessionTTL)
+	return true
+}
+
+// wrap adds CORS headers for allowed origins to responses from h, and only allows requests with the token or a session cookie if a token is set
+func (a *apiAccess) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" && a.allowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if a.credentialed() {
+				w.Header().Set("Access-Control-Allow-Credentials", "true") // For the session cookie
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				// Preflight requests carry no credentials
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		if !a.authorized(r) {
+			log.Debugf("Rejecting unauthenticated API request from %s", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// sessionHandler starts a session for an authorized POST request, setting a cookie that expires once the session goes unused for apiSessionTTL.
+// Browsers only send the cookie of another site along with SameSite=None, which they only accept on Secure cookies, so the cookie
+// can't be used cross-site over plain HTTP other than from localhost.
+func (a *apiAccess) sessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	a.mu.Lock()
+	for session, expiry := range a.sessions {
+		if now.After(expiry) {
+			delete(a.sessions, session)
+		}
+	}
+	a.sessions[id] = now.Add(apiSessionTTL)
+	a.mu.Unlock()
+	cookie := &http.Cookie{
+		Name:     apiSessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(apiSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if origin := r.Header.Get("Origin"); a.credentialed() && a.allowed(origin) && !sameOrigin(origin, r.Host) {
+		cookie.Secure, cookie.SameSite = true, http.SameSiteNoneMode // For a dashboard hosted on another site
+	}
+	http.SetCookie(w, cookie)
+	w.WriteHeader(http.StatusNoContent)
+}
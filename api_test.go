@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newSession starts a session with a, returning its cookie
+func newSession(t *testing.T, a *apiAccess, origin string) *http.Cookie {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "http://gps.example.com:9978/api/v1/session", nil)
+	r.Header.Set("Authorization", "Bearer "+a.token)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	a.wrap(http.HandlerFunc(a.sessionHandler)).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("session request got status %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != apiSessionCookie {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	return cookies[0]
+}
+
+func TestAuthorized(t *testing.T) {
+	a := newAPIAccess("apitok", "")
+	live := newSession(t, a, "")
+	a.sessions["expired"] = time.Now().Add(-time.Second)
+	for _, tt := range []struct {
+		name   string
+		header string
+		cookie string
+		want   bool
+	}{
+		{name: "bearer token", header: "Bearer apitok", want: true},
+		{name: "lower case scheme", header: "bearer apitok", want: true},
+		{name: "token without scheme", header: "apitok"},
+		{name: "wrong token", header: "Bearer apitoken"},
+		{name: "nothing"},
+		{name: "session", cookie: live.Value, want: true},
+		{name: "session with a wrong token", header: "Bearer nope", cookie: live.Value, want: true},
+		{name: "expired session", cookie: "expired"},
+		{name: "unknown session", cookie: "0123456789abcdef"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: apiSessionCookie, Value: tt.cookie})
+			}
+			if got := a.authorized(r); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+	if !newAPIAccess("", "").authorized(httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)) {
+		t.Error("rejected a request without a token configured")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	a := newAPIAccess("apitok", "")
+	cookie := newSession(t, a, "")
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)
+		r.AddCookie(cookie)
+		return r
+	}
+
+	// Using a session keeps it alive for another apiSessionTTL
+	a.sessions[cookie.Value] = time.Now().Add(time.Second)
+	if !a.authorized(request()) {
+		t.Fatal("rejected a live session")
+	}
+	if left := time.Until(a.sessions[cookie.Value]); left < apiSessionTTL-time.Minute {
+		t.Errorf("session used expires in %s", left)
+	}
+
+	a.sessions[cookie.Value] = time.Now().Add(-time.Second)
+	if a.authorized(request()) {
+		t.Error("accepted an expired session")
+	}
+	// Expired sessions are forgotten when the next one starts
+	newSession(t, a, "")
+	if _, ok := a.sessions[cookie.Value]; ok || len(a.sessions) != 1 {
+		t.Errorf("kept %d sessions", len(a.sessions))
+	}
+}
+
+func TestSessionCookie(t *testing.T) {
+	for _, tt := range []struct {
+		name, origins, origin string
+		sameSite              http.SameSite
+		secure, credentials   bool
+	}{
+		{name: "web UI", sameSite: http.SameSiteStrictMode},
+		{name: "web UI with allowed origins", origins: "https://dashboard.example.com", origin: "http://gps.example.com:9978", sameSite: http.SameSiteStrictMode},
+		{name: "allowed origin", origins: "https://dashboard.example.com", origin: "https://dashboard.example.com", sameSite: http.SameSiteNoneMode, secure: true, credentials: true},
+		{name: "other origin", origins: "https://dashboard.example.com", origin: "https://evil.example.com", sameSite: http.SameSiteStrictMode},
+		{name: "any origin", origins: "*", origin: "https://dashboard.example.com", sameSite: http.SameSiteStrictMode},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAPIAccess("apitok", tt.origins)
+			cookie := newSession(t, a, tt.origin)
+			if cookie.SameSite != tt.sameSite || cookie.Secure != tt.secure || !cookie.HttpOnly {
+				t.Errorf("got SameSite %v, Secure %t, HttpOnly %t; want %v, %t", cookie.SameSite, cookie.Secure, cookie.HttpOnly, tt.sameSite, tt.secure)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/stream", nil)
+			r.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			a.wrap(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, r)
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("allowed credentials %t, want %t", got, tt.credentials)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	a := newAPIAccess("apitok", "https://dashboard.example.com")
+	h := a.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }))
+	for _, tt := range []struct {
+		name, method, origin, header string
+		status                       int
+		allowOrigin                  string
+	}{
+		{name: "authorized", method: http.MethodGet, header: "Bearer apitok", status: http.StatusOK},
+		{name: "unauthorized", method: http.MethodGet, status: http.StatusUnauthorized},
+		{name: "token without scheme", method: http.MethodGet, header: "apitok", status: http.StatusUnauthorized},
+		{name: "allowed origin", method: http.MethodGet, origin: "https://dashboard.example.com", header: "Bearer apitok", status: http.StatusOK, allowOrigin: "https://dashboard.example.com"},
+		{name: "other origin", method: http.MethodGet, origin: "https://evil.example.com", header: "Bearer apitok", status: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, origin: "https://dashboard.example.com", status: http.StatusNoContent, allowOrigin: "https://dashboard.example.com"},
+		{name: "preflight from other origin", method: http.MethodOptions, origin: "https://evil.example.com", status: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/v1/trips", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status || w.Header().Get("Access-Control-Allow-Origin") != tt.allowOrigin {
+				t.Errorf("got status %d and allowed origin %q, want %d and %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"), tt.status, tt.allowOrigin)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "time"
+
+// positionSample is a fix kept for the weighted average position
+type positionSample struct {
+	time          time.Time
+	lat, lon, alt float64
+	eph, epv      float64 // Zero if unknown
+	hasAlt        bool
+}
+
+// errorWeight weights a sample by the inverse variance of its error estimate, equally if the receiver doesn't report one
+func errorWeight(err float64) float64 {
+	if err <= 0 {
+		return 1
+	}
+	return 1 / (err * err)
+}
+
+// averagingWindow is the window of the average position: -position.average-window if set, or else the current interval
+// between polls of the target, which follows its @interval and -poll.adaptive. It's called with reportMu held.
+func (e *exporter) averagingWindow() time.Duration {
+	switch {
+	case *averageWindow > 0:
+		return *averageWindow
+	case e.pollInterval > 0:
+		return e.pollInterval
+	}
+	return *pollInterval // Sources that aren't polled, such as NMEA inputs
+}
+
+// updateAverage exports the position of a device averaged over e.averagingWindow(), weighting each fix by its error estimate
+func (e *exporter) updateAverage(m *motionState, tpv *TPV, t time.Time) {
+	alt := tpv.AltMSL
+	if alt == 0 {
+		alt = tpv.AltHAE
+	}
+	m.samples = append(m.samples, positionSample{
+		time: t, lat: tpv.Lat, lon: tpv.Lon, alt: alt,
+		eph: tpv.EPH, epv: tpv.EPV,
+		hasAlt: tpv.Mode >= 3 && alt != 0,
+	})
+	i, window := 0, e.averagingWindow()
+	for i < len(m.samples) && t.Sub(m.samples[i].time) > window {
+		i++
+	}
+	m.samples = m.samples[i:]
+
+	var lat, lon, horizontal, alt3D, vertical float64
+	for _, s := range m.samples {
+		w := errorWeight(s.eph)
+		lat, lon, horizontal = lat+w*s.lat, lon+w*s.lon, horizontal+w
+		if s.hasAlt {
+			w := errorWeight(s.epv)
+			alt3D, vertical = alt3D+w*s.alt, vertical+w
+		}
+	}
+	m.averaged, m.averageLat, m.averageLon = true, lat/horizontal, lon/horizontal
+	if lat, lon, ok := privacy.position(m.averageLat, m.averageLon); ok {
+		e.series(e.averageLat, tpv.Device).Set(lat)
+		e.series(e.averageLon, tpv.Device).Set(lon)
+	}
+	if vertical > 0 {
+		e.series(e.averageAlt, tpv.Device).Set(alt3D / vertical)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAveragingWindow(t *testing.T) {
+	defer func(window, interval time.Duration) { *averageWindow, *pollInterval = window, interval }(*averageWindow, *pollInterval)
+	*pollInterval = 10 * time.Second
+	for _, tt := range []struct {
+		name           string
+		flag, interval time.Duration
+		want           time.Duration
+	}{
+		{"not polled", 0, 0, 10 * time.Second},
+		{"target interval", 0, 30 * time.Second, 30 * time.Second},
+		{"adaptive interval", 0, 2 * time.Minute, 2 * time.Minute},
+		{"flag", 10 * time.Minute, 30 * time.Second, 10 * time.Minute},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			*averageWindow = tt.flag
+			e := newExporter("localhost:2947", prometheus.NewRegistry())
+			if tt.interval > 0 {
+				e.setPollInterval(tt.interval)
+			}
+			if got := e.averagingWindow(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateAverage(t *testing.T) {
+	defer func(window time.Duration) { *averageWindow = window }(*averageWindow)
+	*averageWindow = 0
+	e := newExporter("localhost:2947", prometheus.NewRegistry())
+	e.setPollInterval(30 * time.Second)
+	m := &motionState{}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, fix := range []struct {
+		after    time.Duration
+		lat, eph float64
+	}{
+		{0, 10, 1}, // Dropped once the later fixes are over 30s newer
+		{20 * time.Second, 20, 1},
+		{40 * time.Second, 30, 1},
+		{45 * time.Second, 40, 3}, // Weighs a ninth as much
+	} {
+		e.updateAverage(m, &TPV{Device: "/dev/ttyACM0", Mode: 3, Lat: fix.lat, Lon: 1, EPH: fix.eph}, start.Add(fix.after))
+	}
+	if len(m.samples) != 3 {
+		t.Errorf("kept %d samples, want 3", len(m.samples))
+	}
+	want := (20 + 30 + 40.0/9) / (2 + 1.0/9)
+	if got := testutil.ToFloat64(e.averageLat.WithLabelValues("/dev/ttyACM0")); math.Abs(got-want) > 1e-9 {
+		t.Errorf("got average latitude %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// admit reports whether a label value may be exported, allowing at most limit distinct values of the label (0 for no limit).
+// Values beyond the limit are counted and logged once until the label's values are forgotten. Must be called with reportMu held.
+func (e *exporter) admit(label, value string, limit int) bool {
+	seen, ok := e.labelValues[label]
+	if !ok {
+		seen = map[string]bool{}
+		e.labelValues[label] = seen
+	}
+	if seen[value] || limit <= 0 || len(seen) < limit {
+		seen[value] = true
+		return true
+	}
+	e.cardinalityOverflows.WithLabelValues(label).Inc()
+	if !e.overflowWarned[label] {
+		log.Warnf("More than %d distinct %s values received from %s, dropping %s %q and any further ones", limit, label, e.target, label, value)
+		e.overflowWarned[label] = true
+	}
+	return false
+}
+
+// forgetLabel clears the values of a label admitted so far, once their series have been deleted
+func (e *exporter) forgetLabel(label string) {
+	delete(e.labelValues, label)
+	delete(e.overflowWarned, label)
+}
+
+// admitDevice reports whether a report comes from a device within -metrics.max-devices, so a misbehaving source can't create unbounded series
+func (e *exporter) admitDevice(report any) bool {
+	return e.admit("device", reportDevice(report), *maxDevices)
+}
+
+// limitSatellites drops the satellites of a SKY report beyond -metrics.max-satellites, such as garbage PRNs from a misbehaving receiver
+func (e *exporter) limitSatellites(report any) any {
+	sky, ok := report.(*SKY)
+	if !ok {
+		return report
+	}
+	var kept []Satellite // Only allocated once a satellite is dropped
+	for i, sat := range sky.Satellites {
+		if e.admit("prn", prnLabel(sat.PRN), *maxSatellites) {
+			if kept != nil {
+				kept = append(kept, sat)
+			}
+		} else if kept == nil {
+			kept = append(make([]Satellite, 0, len(sky.Satellites)), sky.Satellites[:i]...)
+		}
+	}
+	if kept == nil {
+		return report
+	}
+	filtered := *sky
+	filtered.Satellites = kept
+	return &filtered
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// catalogEntry describes a metric the exporter can emit
+type catalogEntry struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Help   string            `json:"help"`
+	Unit   string            `json:"unit,omitempty"`
+	Labels []string          `json:"labels,omitempty"`
+	Source string            `json:"source,omitempty"` // gpsd class and field the value is read from
+	Enum   map[string]string `json:"enum,omitempty"`   // Meaning of each value of an enumerated field
+}
+
+// metricDetails adds the unit and source gpsd field of metrics that aren't read from a report field, which their collectors don't describe
+var metricDetails = []catalogEntry{
+	{Name: "gpsd_version", Source: "VERSION.release"},
+	{Name: "gpsd_restarts_total", Source: "VERSION.rev"},
+	{Name: "gpsd_connection_uptime_seconds", Unit: "seconds", Source: "VERSION"},
+	{Name: "gpsd_device_uptime_seconds", Unit: "seconds", Source: "DEVICES.devices.activated"},
+	{Name: "gpsd_proto_major", Source: "VERSION.proto_major"},
+	{Name: "gpsd_proto_minor", Source: "VERSION.proto_minor"},
+	{Name: "gpsd_poll_active_devices", Source: "POLL.active"},
+	{Name: "gpsd_poll_interval_seconds", Unit: "seconds"},
+	{Name: "gpsd_watch_enabled", Source: "WATCH.enable"},
+	{Name: "gpsd_device_watched", Source: "DEVICES.devices"},
+	{Name: "gpsd_receiver_info", Source: "DEVICES.devices"},
+	{Name: "gpsd_device_bps", Source: "DEVICES.devices"},
+	{Name: "gpsd_device_bps_changes_total", Source: "DEVICES.devices"},
+	{Name: "gpsd_device_packets_recognized", Source: "DEVICES.devices"},
+	{Name: "gpsd_errors_total", Source: "ERROR.message"},
+	{Name: "gpsd_device_added_total", Source: "DEVICES.devices"},
+	{Name: "gpsd_device_removed_total", Source: "DEVICES.devices"},
+	{Name: "gpsd_device_config_accepted", Source: "DEVICE"},
+	{Name: "gpsd_distance_traveled_meters_total", Unit: "meters", Source: "TPV.lat"},
+	{Name: "gpsd_position_avg_lat", Unit: "degrees", Source: "TPV.lat"},
+	{Name: "gpsd_position_avg_lon", Unit: "degrees", Source: "TPV.lon"},
+	{Name: "gpsd_position_avg_alt", Unit: "meters", Source: "TPV.altMSL"},
+	{Name: "gpsd_reference_learned_ratio", Source: "TPV.lat"},
+	{Name: "gpsd_reference_distance_meters", Unit: "meters", Source: "TPV.lat"},
+	{Name: "gpsd_reference_drift_meters", Unit: "meters", Source: "TPV.lat"},
+	{Name: "gpsd_reference_vertical_offset_meters", Unit: "meters", Source: "TPV.altMSL"},
+	{Name: "gpsd_velocity_3d_mps", Unit: "meters_per_second", Source: "TPV.velN"},
+	{Name: "gpsd_climb_smoothed_mps", Unit: "meters_per_second", Source: "TPV.climb"},
+	{Name: "gpsd_moving", Source: "TPV.speed"},
+	{Name: "gpsd_stationary_duration_seconds", Unit: "seconds", Source: "TPV.speed"},
+	{Name: "gpsd_moving_base_heading_degrees", Unit: "degrees", Source: "ATT.heading"},
+	{Name: "gpsd_moving_base_heading_baseline_valid", Source: "TPV.baseS"},
+	{Name: "gpsd_moving_base_heading_baseline_length_meters", Unit: "meters", Source: "TPV.baseL"},
+	{Name: "gpsd_heading_deviation_degrees", Unit: "degrees", Source: "TPV.magtrack"},
+	{Name: "gpsd_heading_inconsistent", Source: "TPV.magvar"},
+	{Name: "gpsd_session_max_speed_meters_per_second", Unit: "meters_per_second", Source: "TPV.speed"},
+	{Name: "gpsd_session_max_altitude_meters", Unit: "meters", Source: "TPV.altMSL"},
+	{Name: "gpsd_trip_active", Source: "TPV.speed"},
+	{Name: "gpsd_trips_total", Source: "TPV.speed"},
+	{Name: "gpsd_trip_distance_meters", Unit: "meters", Source: "TPV.lat"},
+	{Name: "gpsd_trip_duration_seconds", Unit: "seconds", Source: "TPV.time"},
+	{Name: "gpsd_sat_appearances_total", Source: "SKY.satellites"},
+	{Name: "gpsd_snr_min_dbhz", Unit: "dbhz", Source: "SKY.satellites.ss"},
+	{Name: "gpsd_snr_max_dbhz", Unit: "dbhz", Source: "SKY.satellites.ss"},
+	{Name: "gpsd_snr_mean_dbhz", Unit: "dbhz", Source: "SKY.satellites.ss"},
+	{Name: "gpsd_sky_sector_used_satellites", Source: "SKY.satellites"},
+	{Name: "gpsd_device_dop", Source: "SKY.hdop"},
+	{Name: "gpsd_device_quality", Source: "SKY.qual"},
+	{Name: "gpsd_signal_quality", Source: "SKY.qual"},
+	{Name: "gpsd_dop_threshold_breaches_total", Source: "SKY.hdop"},
+	{Name: "gpsd_dop_threshold_breached", Source: "SKY.hdop"},
+	{Name: "gpsd_antenna_status", Source: "TPV.ant"},
+	{Name: "gpsd_anomaly_detected", Source: "TPV.time"},
+	{Name: "gpsd_anomalies_total", Source: "TPV.time"},
+	{Name: "gpsd_dgps_corrections_stale", Source: "TPV.dgpsAge"},
+	{Name: "gpsd_dgps_staleness_events_total", Source: "TPV.dgpsAge"},
+	{Name: "gpsd_dgps_station_info", Source: "TPV.dgpsSta"},
+	{Name: "gpsd_pps_qerr_rms_seconds", Unit: "seconds", Source: "PPS.qErr"},
+	{Name: "gpsd_pps_interval_seconds", Unit: "seconds", Source: "PPS.real_sec"},
+	{Name: "gpsd_pps_missing_pulses_total", Source: "PPS.real_sec"},
+	{Name: "gpsd_pps_toff_disagreement_seconds", Unit: "seconds", Source: "TOFF.clock_sec"},
+	{Name: "gpsd_system_clock_frequency_error_ppm", Unit: "ppm", Source: "TOFF.clock_sec"},
+	{Name: "gpsd_system_clock_steps_total", Source: "TOFF.clock_sec"},
+	{Name: "gpsd_osc_disciplined_duration_seconds", Unit: "seconds", Source: "OSC.disciplined"},
+	{Name: "gpsd_osc_holdover_duration_seconds", Unit: "seconds", Source: "OSC.disciplined"},
+	{Name: "gpsd_pps_offset_seconds", Unit: "seconds", Source: "PPS.clock_sec"},
+	{Name: "gpsd_pps_qerr_seconds", Unit: "seconds", Source: "PPS.qErr"},
+	{Name: "gpsd_osc_delta_magnitude_seconds", Unit: "seconds", Source: "OSC.delta"},
+	{Name: "gpsd_sky_snr_dbhz", Unit: "dbhz", Source: "SKY.satellites.ss"},
+	{Name: "gpsd_fix_losses_total", Source: "TPV.mode"},
+	{Name: "gpsd_fix_outage_duration_seconds", Unit: "seconds", Source: "TPV.mode"},
+	{Name: "gpsd_fix_reacquisition_seconds", Unit: "seconds", Source: "TPV.mode"},
+	{Name: "gpsd_horizontal_error_estimate_meters", Unit: "meters", Source: "TPV.eph"},
+	{Name: "gpsd_vertical_error_estimate_meters", Unit: "meters", Source: "TPV.epv"},
+	{Name: "gpsd_spherical_error_estimate_meters", Unit: "meters", Source: "TPV.sep"},
+	{Name: "gpsd_exporter_scrape_duration_seconds", Unit: "seconds"},
+	{Name: "gpsd_exporter_parse_duration_seconds", Unit: "seconds"},
+	{Name: "gpsd_poll_response_bytes", Unit: "bytes", Source: "POLL"},
+	{Name: "gpsd_survey_position_stddev_meters", Unit: "meters", Source: "TPV.lat"},
+	{Name: "gpsd_survey_fixes_total", Source: "TPV.lat"},
+	{Name: "gpsd_survey_sky_coverage_ratio", Source: "SKY.satellites"},
+}
+
+// undescribedMetrics lists the metrics of the satellite snapshot, which is collected without describing its metrics
+var undescribedMetrics = []catalogEntry{
+	{Name: "gpsd_sat_visible_duration_seconds", Type: "gauge", Help: "How long the satellite has been continuously visible", Unit: "seconds", Labels: []string{"prn"}, Source: "SKY.satellites"},
+	{Name: "gpsd_sat_used_duration_seconds", Type: "gauge", Help: "How long the satellite has been continuously used in the solution, zero when unused", Unit: "seconds", Labels: []string{"prn"}, Source: "SKY.satellites.used"},
+	{Name: "gpsd_constellation_satellites_visible", Type: "gauge", Help: "Number of satellites of the constellation in the latest SKY report", Labels: []string{"constellation"}, Source: "SKY.satellites"},
+	{Name: "gpsd_constellation_satellites_used", Type: "gauge", Help: "Number of satellites of the constellation used in the navigation solution", Labels: []string{"constellation"}, Source: "SKY.satellites.used"},
+	{Name: "gpsd_constellation_snr_mean_dbhz", Type: "gauge", Help: "Mean signal to noise ratio of the tracked satellites of the constellation", Unit: "dbhz", Labels: []string{"constellation"}, Source: "SKY.satellites.ss"},
+	{Name: "gpsd_constellation_snr_median_dbhz", Type: "gauge", Help: "Median signal to noise ratio of the tracked satellites of the constellation", Unit: "dbhz", Labels: []string{"constellation"}, Source: "SKY.satellites.ss"},
+}
+
+// metricCatalog returns every metric the exporter can emit, sorted by name
+func metricCatalog() []catalogEntry {
+	lastPoll := catalogEntry{Name: "gpsd_last_poll_timestamp_seconds", Type: "gauge", Help: "Last time the GPSD daemon was polled", Unit: "seconds"}
+	if *legacyNames {
+		lastPoll.Name, lastPoll.Unit = "gpsd_last_poll", "milliseconds"
+	}
+	entries := append([]catalogEntry{lastPoll}, undescribedMetrics...)
+
+	for class, report := range streamedReports {
+		entries = append(entries, reportCatalog(class, reflect.TypeOf(report()).Elem())...)
+	}
+
+	for class := range streamedReports {
+		entries = append(entries, catalogEntry{
+			Name:   fmt.Sprintf("gpsd_last_%s_timestamp_seconds", strings.ToLower(class)),
+			Type:   "gauge",
+			Help:   fmt.Sprintf("Time the exporter received the latest new %s report from the device", class),
+			Unit:   "seconds",
+			Labels: []string{"device"},
+		})
+	}
+	for _, class := range []string{"GST", "PPS", "SKY", "TOFF", "TPV"} {
+		entries = append(entries, catalogEntry{
+			Name:   fmt.Sprintf("gpsd_%s_report_age_seconds", strings.ToLower(class)),
+			Type:   "gauge",
+			Help:   fmt.Sprintf("Time between the gpsd timestamp of the latest %s report and when the exporter received it", class),
+			Unit:   "seconds",
+			Source: class + ".time",
+		})
+	}
+
+	// Other metrics are described by the collectors that export them, which -profile minimal also registers some report fields with
+	described := describedMetrics()
+	for _, entry := range entries {
+		delete(described, entry.Name)
+	}
+	for _, details := range metricDetails {
+		if entry, ok := described[details.Name]; ok {
+			entry.Unit, entry.Source = details.Unit, details.Source
+			described[details.Name] = entry
+		}
+	}
+	for _, entry := range described {
+		entries = append(entries, entry)
+	}
+
+	// Label every metric with its target when exporting more than one
+	if multipleSources() {
+		for i := range entries {
+			entries[i].Labels = append([]string{"target"}, entries[i].Labels...)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// reportCatalog describes the metrics exported from the fields of a report struct, following the rules of updateMetrics
+func reportCatalog(class string, t reflect.Type) []catalogEntry {
+	namespace := strings.ToLower(class)
+	var entries []catalogEntry
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		jsonField, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		namespace := namespace
+		if ns := f.Tag.Get("namespace"); ns != "" {
+			namespace = ns
+		}
+		var labels []string
+		switch {
+		case f.Tag.Get("metric") == "-", f.Tag.Get("metric") == "legacy" && !*legacyNames:
+			continue
+		case f.Type.Kind() == reflect.String && jsonField != "time":
+			continue
+		case f.Type.Kind() == reflect.Slice && jsonField == "satellites":
+			entries = append(entries, reportCatalog("SAT", f.Type.Elem())...)
+			continue
+		case namespace == "sat":
+			labels = []string{"prn"}
+		}
+
+		name, _ := metricName(namespace, jsonField)
+		entry := catalogEntry{
+			Name:   name,
+			Type:   "gauge",
+			Help:   fieldHelp(namespace, jsonField, f.Tag.Get("description")),
+			Labels: labels,
+			Source: fmt.Sprintf("%s.%s", class, jsonField),
+		}
+		m := fieldMetrics[namespace+"."+jsonField]
+		for v, meaning := range m.enum {
+			if entry.Enum == nil {
+				entry.Enum = map[string]string{}
+			}
+			entry.Enum[strconv.Itoa(v)] = meaning
+		}
+		if !*legacyNames {
+			entry.Unit = m.unit
+		} else if jsonField == "time" {
+			entry.Unit = "milliseconds"
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// catalogHandler serves the metric catalog as JSON
+func catalogHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(metricCatalog())
+}
+
+// runDocs prints the metric catalog for the docs subcommand
+func runDocs(args []string) {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format (markdown or json)")
+	_ = fs.Parse(args)
+
+	catalog := metricCatalog()
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(catalog)
+	case "markdown":
+		fmt.Println("| Metric | Type | Unit | Labels | Source | Description |")
+		fmt.Println("|--------|------|------|--------|--------|-------------|")
+		for _, e := range catalog {
+			fmt.Printf("| `%s` | %s | %s | %s | %s | %s |\n",
+				e.Name, e.Type, e.Unit, strings.Join(e.Labels, ", "), e.Source, strings.ReplaceAll(e.Help, "|", "\\|"))
+		}
+	default:
+		log.Fatalf("Unknown docs format %q", *format)
+	}
+}
+
+// catalogRegistry is a Registerer recording the metrics described by the collectors registered with it, by name
+type catalogRegistry map[string]catalogEntry
+
+func (r catalogRegistry) Register(c prometheus.Collector) error {
+	metricType := collectorType(c)
+	for _, d := range describe(c) {
+		if entry, ok := descEntry(d); ok {
+			entry.Type = metricType
+			r[entry.Name] = entry
+		}
+	}
+	return nil
+}
+
+func (r catalogRegistry) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		_ = r.Register(c)
+	}
+}
+
+func (r catalogRegistry) Unregister(c prometheus.Collector) bool {
+	for _, d := range describe(c) {
+		if entry, ok := descEntry(d); ok {
+			delete(r, entry.Name)
+		}
+	}
+	return true
+}
+
+// describe returns the descriptors of the metrics of c
+func describe(c prometheus.Collector) []*prometheus.Desc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(ch)
+		close(ch)
+	}()
+	var descs []*prometheus.Desc
+	for d := range ch {
+		descs = append(descs, d)
+	}
+	return descs
+}
+
+// descEntry reads the name, help and variable labels of a descriptor, which client_golang only exposes through its String method
+func descEntry(d *prometheus.Desc) (catalogEntry, bool) {
+	s, ok := cutPrefix(d.String(), `Desc{fqName: `)
+	if !ok {
+		return catalogEntry{}, false
+	}
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return catalogEntry{}, false
+	}
+	name, _ := strconv.Unquote(quoted)
+	if s, ok = cutPrefix(s[len(quoted):], `, help: `); !ok {
+		return catalogEntry{}, false
+	}
+	if quoted, err = strconv.QuotedPrefix(s); err != nil {
+		return catalogEntry{}, false
+	}
+	help, _ := strconv.Unquote(quoted)
+	i := strings.LastIndex(s, "variableLabels: [")
+	if i < 0 || !strings.HasSuffix(s, "]}") {
+		return catalogEntry{}, false
+	}
+	entry := catalogEntry{Name: name, Help: help}
+	if labels := strings.Fields(s[i+len("variableLabels: [") : len(s)-len("]}")]); len(labels) > 0 {
+		entry.Labels = labels
+	}
+	return entry, name != ""
+}
+
+// cutPrefix is strings.CutPrefix, which needs Go 1.20
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// collectorType returns the type of the metrics of c, gauge for custom collectors
+func collectorType(c prometheus.Collector) string {
+	switch c := c.(type) {
+	case *prometheus.CounterVec:
+		return "counter"
+	case *prometheus.HistogramVec:
+		return "histogram"
+	case *prometheus.SummaryVec:
+		return "summary"
+	case prometheus.Metric:
+		var m dto.Metric
+		if c.Write(&m) == nil {
+			switch {
+			case m.Counter != nil:
+				return "counter"
+			case m.Histogram != nil:
+				return "histogram"
+			case m.Summary != nil:
+				return "summary"
+			}
+		}
+	}
+	return "gauge"
+}
+
+// describedMetrics returns the metrics of the exporter's collectors, created as each source and the server would create them
+func describedMetrics() catalogRegistry {
+	r := catalogRegistry{}
+	newExporter("", r)
+	newSurvey("", r)
+	newLineRelay(r)
+	newScrapeDuration(r)
+	for name := range r {
+		if !strings.HasPrefix(name, "gpsd_") {
+			delete(r, name)
+		}
+	}
+	return r
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDescEntry(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		desc *prometheus.Desc
+		want catalogEntry
+	}{
+		{"no labels", prometheus.NewDesc("gpsd_up", "Whether the exporter is connected to gpsd", nil, nil),
+			catalogEntry{Name: "gpsd_up", Help: "Whether the exporter is connected to gpsd"}},
+		{"variable labels", prometheus.NewDesc("gpsd_device_dop", "Dilution of precision", []string{"device", "dop"}, nil),
+			catalogEntry{Name: "gpsd_device_dop", Help: "Dilution of precision", Labels: []string{"device", "dop"}}},
+		{"quoted help and const labels", prometheus.NewDesc("gpsd_x", `Help with "quotes", variableLabels: [a] and }`, []string{"prn"}, prometheus.Labels{"target": "a b"}),
+			catalogEntry{Name: "gpsd_x", Help: `Help with "quotes", variableLabels: [a] and }`, Labels: []string{"prn"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := descEntry(tt.desc)
+			if !ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v (%t), want %+v", got, ok, tt.want)
+			}
+		})
+	}
+	if _, ok := descEntry(prometheus.NewInvalidDesc(nil)); ok {
+		t.Error("invalid descriptor read as a metric")
+	}
+}
+
+func TestCatalogDescribed(t *testing.T) {
+	described := describedMetrics()
+	for _, details := range metricDetails {
+		if _, ok := described[details.Name]; !ok {
+			t.Errorf("%s has details but no collector describes it", details.Name)
+		}
+	}
+	for name, metricType := range map[string]string{
+		"gpsd_up":                               "gauge",
+		"gpsd_reports_total":                    "counter",
+		"gpsd_pps_offset_seconds":               "histogram",
+		"gpsd_horizontal_error_estimate_meters": "summary",
+		"gpsd_connection_uptime_seconds":        "gauge",
+		"gpsd_exporter_scrape_duration_seconds": "histogram",
+		"gpsd_exporter_relay_clients":           "gauge",
+		"gpsd_survey_fixes_total":               "counter",
+		"gpsd_survey_position_stddev_meters":    "gauge",
+	} {
+		if got := described[name].Type; got != metricType {
+			t.Errorf("%s is a %q, want %q", name, got, metricType)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range metricCatalog() {
+		if seen[entry.Name] {
+			t.Errorf("%s is listed twice", entry.Name)
+		}
+		seen[entry.Name] = true
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// collectedClasses holds whether the reports of each class are parsed and exported, set with -collector.<class>
+var collectedClasses = func() map[string]*bool {
+	classes := map[string]*bool{}
+	for _, class := range append(append([]string{}, pollClasses...), "att") {
+		classes[class] = flag.Bool("collector."+class, true, fmt.Sprintf("parse and export %s reports", strings.ToUpper(class)))
+	}
+	return classes
+}()
+
+// collected reports whether the reports of a class are parsed and exported
+func collected(class string) bool {
+	enabled, ok := collectedClasses[strings.ToLower(class)]
+	return !ok || *enabled
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// pollCommand enables watcher mode and requests a POLL report
+const pollCommand = "?WATCH={\"enable\": true}\n?POLL;\n"
+
+// pollCommands returns the commands requesting reports from gpsd: a POLL, or watcher mode with JSON reports for releases that predate ?POLL.
+// Reports are also streamed alongside polling for what POLL doesn't include, ATT with -gpsd.nmea2000 or -gpsd.heading and every pulse with the pps option.
+// The options of -gpsd.watch are added to the WATCH command.
+func (e *exporter) pollCommands() string {
+	streaming := e.streaming()
+	alongside := *nmea2000 || *movingBase || *relayListen != "" // Reports streamed alongside polling
+	if !streaming && !alongside && len(watchOptions) == 0 {
+		return pollCommand
+	}
+	watch := `?WATCH={"enable": true`
+	if streaming || alongside || watchOptions["pps"] {
+		watch += `, "json": true`
+	}
+	for _, option := range watchOptions.names() {
+		watch += fmt.Sprintf(`, %q: true`, option)
+	}
+	watch += "}\n"
+	if streaming {
+		return watch
+	}
+	return watch + "?POLL;\n"
+}
+
+var errNotConnected = errors.New("not connected to gpsd")
+
+// errStopped is returned when connecting to a target that was stopped meanwhile
+var errStopped = errors.New("target stopped")
+
+// gpsdClient maintains a connection to a gpsd instance
+type gpsdClient struct {
+	addr         string
+	pollInterval time.Duration
+	dialer       proxy.ContextDialer
+	exporter     *exporter
+	done         chan struct{} // Closed to stop the client, nil for clients that run forever
+
+	mu         sync.Mutex
+	conn       net.Conn
+	lastReport time.Time
+	refused    bool   // Set when gpsd speaks an unsupported protocol in strict mode
+	connected  bool   // Set once the first connection succeeds
+	redial     bool   // Set to reconnect without waiting a poll interval
+	override   string // Address set through the admin API in place of addr, which keeps naming the target
+	stopped    bool   // Set once the target is no longer discovered
+}
+
+// connect dials gpsd and sends the initial poll command
+func (c *gpsdClient) connect() (net.Conn, error) {
+	addr := c.dialAddr()
+	log.Infof("Connecting to gpsd on %s", addr)
+	conn, err := c.dialer.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Connected to gpsd at %s", conn.RemoteAddr())
+
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		_ = conn.Close()
+		return nil, errStopped
+	}
+	c.conn = conn
+	c.lastReport = time.Now()
+	c.mu.Unlock()
+	c.exporter.resetFixes()
+	if err := c.poll(); err != nil {
+		c.disconnect()
+		return nil, err
+	}
+	if cmds := c.exporter.configureDevices(); cmds != "" {
+		if err := c.send(cmds); err != nil {
+			c.disconnect()
+			return nil, err
+		}
+	}
+	c.mu.Lock()
+	if c.connected {
+		c.exporter.reconnects.Inc()
+	}
+	c.connected = true
+	c.mu.Unlock()
+	c.exporter.up.Set(1)
+	c.exporter.connectionInfo.With(prometheus.Labels{"address": conn.RemoteAddr().String()}).Set(1)
+	c.exporter.connUp(conn.RemoteAddr())
+	return conn, nil
+}
+
+// disconnect closes the current connection, if any
+func (c *gpsdClient) disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+	c.exporter.up.Set(0)
+	c.exporter.connectionInfo.Reset()
+	c.exporter.connDown()
+	c.exporter.watchEnabled.Set(0)
+	if *resetOnDisconnect {
+		c.exporter.resetReports()
+	}
+}
+
+// poll sends a POLL command on the current connection
+func (c *gpsdClient) poll() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errNotConnected
+	}
+	log.Debugf("Sending POLL command to %s", c.addr)
+	return c.write(c.exporter.pollCommands())
+}
+
+// send writes commands to the current connection
+func (c *gpsdClient) send(cmds string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errNotConnected
+	}
+	log.Debugf("Sending %q to %s", cmds, c.addr)
+	return c.write(cmds)
+}
+
+// write writes to the current connection, which must be held under c.mu
+func (c *gpsdClient) write(cmds string) error {
+	if *writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(*writeTimeout))
+	}
+	_, err := c.conn.Write([]byte(cmds))
+	return err
+}
+
+// read queues lines from conn for parsing until the connection fails or the read deadline passes.
+// Lines are dropped when the queue is full, so slow parsing never stops reading and gets the exporter disconnected by gpsd.
+func (c *gpsdClient) read(conn net.Conn) {
+	lines := make(chan string, *queueSize)
+	parsed := make(chan struct{})
+	go func() {
+		defer close(parsed)
+		c.exporter.supervise("parse", nil, func() { c.parse(conn, lines) })
+	}()
+
+	reader := newLineReader(countingReader{conn, c.exporter}, c.exporter)
+	var err error
+	for {
+		if *readTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(*readTimeout))
+		}
+		var line string
+		if line, err = reader.next(); err != nil {
+			break
+		}
+		c.exporter.connMessage()
+		select {
+		case lines <- line:
+		default:
+			c.exporter.droppedLines.Inc()
+		}
+	}
+	close(lines)
+	<-parsed
+
+	c.mu.Lock()
+	refused := c.refused
+	c.mu.Unlock()
+	if refused || errors.Is(err, net.ErrClosed) {
+		log.Debugf("Closed the connection to gpsd %s", c.addr) // By disconnect or parse
+	} else if err != io.EOF {
+		log.Warnf("Error reading from gpsd %s: %v", c.addr, err)
+		c.exporter.connError(err)
+	} else {
+		log.Warnf("gpsd %s closed the connection", c.addr)
+		c.exporter.connError(io.EOF)
+	}
+}
+
+// parse processes the lines read from conn until the queue is closed, closing conn if gpsd must be refused
+func (c *gpsdClient) parse(conn net.Conn, lines <-chan string) {
+	for line := range lines {
+		err := c.exporter.processLine(line)
+		recentMessages.add(c.addr, line, err)
+		relay.publish(line)
+		if errors.Is(err, errUnsupportedProtocol) && *strictVersion {
+			log.Errorf("Refusing to poll gpsd %s: %v", c.addr, err)
+			c.mu.Lock()
+			c.refused = true
+			c.mu.Unlock()
+			_ = conn.Close()
+			for range lines { // Until read notices the connection is closed
+			}
+			return
+		} else if err != nil {
+			log.Warnf("Error processing line from %s: %v", c.addr, err)
+			c.exporter.connError(err)
+		} else {
+			c.mu.Lock()
+			c.lastReport = time.Now()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// run reads from gpsd forever, reconnecting whenever the connection is lost
+func (c *gpsdClient) run() {
+	for {
+		conn, err := c.connect()
+		if errors.Is(err, errStopped) {
+			return
+		} else if err != nil {
+			log.Warnf("Error connecting to gpsd %s: %v", c.addr, err)
+			c.exporter.connError(err)
+		} else {
+			c.read(conn)
+			c.disconnect()
+		}
+		c.mu.Lock()
+		refused, redial, stopped := c.refused, c.redial, c.stopped
+		c.redial = false
+		c.mu.Unlock()
+		if refused || stopped {
+			return
+		}
+		if !redial {
+			select {
+			case <-time.After(c.pollInterval):
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+// reconnect drops the current connection, which run re-establishes right away
+func (c *gpsdClient) reconnect() error {
+	c.mu.Lock()
+	connected := c.conn != nil
+	c.redial = connected
+	c.mu.Unlock()
+	if !connected {
+		return errNotConnected
+	}
+	c.disconnect()
+	return nil
+}
+
+// stop disconnects for good, ending run, pollLoop, and watchdog
+func (c *gpsdClient) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	close(c.done)
+	c.disconnect()
+}
+
+// pollLoop sends a POLL command every poll interval, or every nextPollInterval with -poll.adaptive
+func (c *gpsdClient) pollLoop() {
+	log.Debugf("Starting poll ticker for %s every %s", c.addr, c.pollInterval)
+	interval := c.pollInterval
+	c.exporter.setPollInterval(interval)
+	pollTimer := time.NewTimer(interval)
+	defer pollTimer.Stop()
+	for {
+		select {
+		case <-pollTimer.C:
+		case <-c.done:
+			return
+		}
+		err := c.poll()
+		switch {
+		case errors.Is(err, errNotConnected):
+			log.Debugf("Not connected to %s, not sending POLL command", c.addr)
+		case err != nil:
+			log.Warnf("Error sending POLL command to %s: %v", c.addr, err)
+			c.exporter.connError(err)
+			c.disconnect()
+		default:
+			c.exporter.setLastPoll(time.Now())
+		}
+		if next := c.nextPollInterval(); next != interval {
+			log.Debugf("Polling %s every %s", c.addr, next)
+			interval = next
+			c.exporter.setPollInterval(interval)
+		}
+		pollTimer.Reset(interval)
+	}
+}
+
+// devicesLoop asks gpsd for its device list every -gpsd.devices-interval, so devices added or removed between connections are noticed
+func (c *gpsdClient) devicesLoop() {
+	ticker := time.NewTicker(*devicesInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		if err := c.send("?DEVICES;\n"); err != nil && !errors.Is(err, errNotConnected) {
+			log.Warnf("Error sending DEVICES command to %s: %v", c.addr, err)
+		}
+	}
+}
+
+// watchdog reconnects when the connection is up but no report has been parsed within the stall timeout
+func (c *gpsdClient) watchdog() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		c.mu.Lock()
+		stalled := c.conn != nil && time.Since(c.lastReport) > *stallTimeout
+		c.mu.Unlock()
+		if stalled {
+			log.Warnf("No reports parsed from gpsd %s in %s, reconnecting", c.addr, *stallTimeout)
+			c.exporter.connError(fmt.Errorf("no reports parsed in %s", *stallTimeout))
+			c.exporter.stalls.Inc()
+			c.disconnect()
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Raw commands wait this long for a first response, and stop reading once gpsd has been quiet for rawCommandIdle
+const (
+	rawCommandTimeout = 5 * time.Second
+	rawCommandIdle    = 500 * time.Millisecond
+	rawCommandMaxSize = 4096
+	rawCommandMaxRead = 100 // Lines, so a ?WATCH doesn't stream forever
+)
+
+// readOnlyCommands are the gpsd commands sent through /api/v1/admin/command, which only query gpsd or change the connection's own watcher policy.
+// ?DEVICE with an argument reconfigures the serial line of a receiver, so it's only allowed with -web.enable-device-commands.
+var readOnlyCommands = map[string]bool{"?VERSION": true, "?DEVICES": true, "?POLL": true, "?WATCH": true}
+
+// checkRawCommand returns an error unless each of the semicolon separated commands in line may be sent to gpsd.
+// Line breaks are rejected since gpsd would read what follows them as further commands, unchecked as part of an argument.
+func checkRawCommand(line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return errors.New("commands can't span several lines")
+	}
+	for _, cmd := range strings.Split(line, ";") {
+		if cmd = strings.TrimSpace(cmd); cmd == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(cmd, "=")
+		switch {
+		case readOnlyCommands[name]:
+		case name == "?DEVICE" && (arg == "" || *deviceCommands):
+		case name == "?DEVICE":
+			return errors.New("?DEVICE with an argument reconfigures the device, which requires -web.enable-device-commands")
+		default:
+			return fmt.Errorf("command %s isn't allowed (expected ?VERSION, ?DEVICES, ?DEVICE, ?POLL, or ?WATCH)", name)
+		}
+	}
+	return nil
+}
+
+// rawCommand sends cmd to gpsd on a connection of its own and returns the lines gpsd responds with
+func (c *gpsdClient) rawCommand(cmd string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *dialTimeout)
+	defer cancel()
+	conn, err := c.dialer.DialContext(ctx, "tcp", c.dialAddr())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(rawCommandTimeout))
+	if !scanner.Scan() { // VERSION banner
+		return nil, fmt.Errorf("no banner from gpsd: %v", scanner.Err())
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(*writeTimeout))
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	_ = conn.SetReadDeadline(time.Now().Add(rawCommandTimeout))
+	for len(lines) < rawCommandMaxRead && scanner.Scan() {
+		lines = append(lines, privacy.filterLine(scanner.Text()))
+		_ = conn.SetReadDeadline(time.Now().Add(rawCommandIdle))
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no response from gpsd: %v", scanner.Err())
+	}
+	return lines, nil
+}
+
+// adminCommandHandler sends the request body to gpsd as a raw command and responds with gpsd's response lines
+func adminCommandHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, rawCommandMaxSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cmd := strings.TrimSpace(string(body))
+		if !strings.HasPrefix(cmd, "?") || strings.ContainsAny(cmd, "\r\n") {
+			http.Error(w, "expected a single gpsd command starting with ?", http.StatusBadRequest)
+			return
+		}
+		if err := checkRawCommand(cmd); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		c, err := pickClient(sources.gpsdClients(), r.URL.Query().Get("target"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Infof("Request from %s to send %q to %s", r.RemoteAddr, cmd, c.addr)
+		lines, err := c.rawCommand(cmd)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", c.addr, err), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// is reports whether the client connects to target, given as on the command line
+func (c *gpsdClient) is(target string) bool {
+	return c.addr == target || c.addr == normalizeAddr(target, defaultGPSDPort)
+}
+
+// pickClient returns the gpsd client of target, which may only be omitted when there's a single one
+func pickClient(clients []*gpsdClient, target string) (*gpsdClient, error) {
+	if target == "" {
+		if len(clients) != 1 {
+			return nil, errors.New("pick a gpsd target with ?target=host:port")
+		}
+		return clients[0], nil
+	}
+	for _, c := range clients {
+		if c.is(target) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no gpsd target %q", target)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckRawCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		line           string
+		deviceCommands bool
+		ok             bool
+	}{
+		{name: "version", line: "?VERSION;", ok: true},
+		{name: "devices", line: "?DEVICES;", ok: true},
+		{name: "poll", line: "?POLL;", ok: true},
+		{name: "watch", line: `?WATCH={"enable":true,"json":true};`, ok: true},
+		{name: "device query", line: "?DEVICE;", ok: true},
+		{name: "without terminator", line: "?VERSION", ok: true},
+		{name: "device configuration", line: `?DEVICE={"path":"/dev/ttyACM0","bps":4800};`},
+		{name: "device configuration enabled", line: `?DEVICE={"path":"/dev/ttyACM0","bps":4800};`, deviceCommands: true, ok: true},
+		{name: "unknown command", line: "?RESET;"},
+		{name: "lower case", line: "?version;"},
+		{name: "several read-only commands", line: "?VERSION;?DEVICES;?POLL;", ok: true},
+		{name: "device configuration after a query", line: `?VERSION;?DEVICE={"path":"/dev/ttyACM0","native":1};`},
+		{name: "unknown command after a query", line: "?VERSION;?RESET;"},
+		{name: "newline before device configuration", line: "?WATCH={\"enable\":true}\n?DEVICE={\"path\":\"/dev/ttyACM0\",\"bps\":4800};"},
+		{name: "newline between queries", line: "?VERSION;\n?POLL;"},
+		{name: "carriage return", line: "?VERSION;\r?DEVICE={\"path\":\"/dev/ttyACM0\"};"},
+		{name: "newline with device commands enabled", line: "?VERSION;\n?DEVICE;", deviceCommands: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(enabled bool) { *deviceCommands = enabled }(*deviceCommands)
+			*deviceCommands = tt.deviceCommands
+			if err := checkRawCommand(tt.line); (err == nil) != tt.ok {
+				t.Errorf("got %v, want allowed %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAdminCommandHandlerRejected(t *testing.T) {
+	for _, tt := range []struct {
+		name, body string
+		status     int
+	}{
+		{"not a command", "VERSION", http.StatusBadRequest},
+		{"two lines", "?VERSION;\n?POLL;", http.StatusBadRequest},
+		{"device configuration", `?DEVICE={"path":"/dev/ttyACM0","bps":4800};`, http.StatusForbidden},
+		{"unknown command", "?RESET;", http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			adminCommandHandler(&sourceSet{})(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/command", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+)
+
+// configFlag is the value of a flag in the effective configuration
+type configFlag struct {
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Set     bool   `json:"set"` // Whether the flag was given on the command line
+}
+
+// configTarget is a connected gpsd target with its resolved and current poll intervals
+type configTarget struct {
+	Address             string `json:"address"`
+	Override            string `json:"override,omitempty"` // Address set through the admin API
+	Discovered          bool   `json:"discovered"`
+	PollInterval        string `json:"poll_interval"`
+	CurrentPollInterval string `json:"current_poll_interval,omitempty"` // Differs from poll_interval with -poll.adaptive
+}
+
+// effectiveConfig is the configuration the exporter is running with
+type effectiveConfig struct {
+	Flags   map[string]configFlag `json:"flags"`
+	Targets []configTarget        `json:"targets"`
+	Inputs  []string              `json:"inputs"`
+}
+
+// secretFlags redact the secrets in the values of flags that may contain them, and the paths of files holding credentials
+var secretFlags = map[string]func(string) string{
+	"gpsd.proxy":                redactURL,
+	"gpsd.ssh-key":              redactAll,
+	"targets.consul-address":    redactURL,
+	"snmp.community":            redactAll,
+	"targets.consul-token-file": redactAll,
+	"web.admin-token-file":      redactAll,
+	"web.api-token-file":        redactAll,
+}
+
+// redactAll masks a value entirely
+func redactAll(string) string {
+	return "xxxxx"
+}
+
+// redactURL masks the password of a URL
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "xxxxx"
+	}
+	return u.Redacted()
+}
+
+// currentConfig returns the effective configuration, with secrets redacted and the targets sources is connected to
+func currentConfig(sources *sourceSet) effectiveConfig {
+	c := effectiveConfig{Flags: map[string]configFlag{}, Targets: []configTarget{}, Inputs: []string{}}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	flag.VisitAll(func(f *flag.Flag) {
+		value, def := f.Value.String(), f.DefValue
+		if redact, ok := secretFlags[f.Name]; ok {
+			if value != "" {
+				value = redact(value)
+			}
+			if def != "" {
+				def = redact(def)
+			}
+		}
+		c.Flags[f.Name] = configFlag{Value: value, Default: def, Set: set[f.Name]}
+	})
+	for _, client := range sources.gpsdClients() {
+		t := configTarget{Address: client.addr, Discovered: client.done != nil, PollInterval: client.pollInterval.String()}
+		if addr := client.dialAddr(); addr != client.addr {
+			t.Override = addr
+		}
+		client.exporter.reportMu.Lock()
+		if current := client.exporter.pollInterval; current > 0 {
+			t.CurrentPollInterval = current.String()
+		}
+		client.exporter.reportMu.Unlock()
+		c.Targets = append(c.Targets, t)
+	}
+	for _, in := range nmeaInputs {
+		c.Inputs = append(c.Inputs, in.url)
+	}
+	return c
+}
+
+// configHandler serves the effective configuration as JSON
+func configHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(currentConfig(sources))
+	}
+}
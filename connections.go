@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connectionState is the state of the connection to a source, for /debug/connections
+type connectionState struct {
+	Target         string     `json:"target"`
+	Connected      bool       `json:"connected"`
+	ConnectedSince *time.Time `json:"connected_since,omitempty"`
+	RemoteAddress  string     `json:"remote_address,omitempty"`
+	BytesRead      int64      `json:"bytes_read"`
+	LastMessage    *time.Time `json:"last_message,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastErrorTime  *time.Time `json:"last_error_time,omitempty"`
+}
+
+// countingReader counts the bytes read from a source's connection
+type countingReader struct {
+	r io.Reader
+	e *exporter
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.e.connRead(n)
+	return n, err
+}
+
+// connUp records that the source connected to or started listening on addr
+func (e *exporter) connUp(addr net.Addr) {
+	now := time.Now().UTC()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn.Connected = true
+	e.conn.ConnectedSince = &now
+	e.conn.RemoteAddress = addr.String()
+}
+
+// connDown records that the connection to the source was lost
+func (e *exporter) connDown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn.Connected = false
+	e.conn.ConnectedSince = nil
+	e.conn.RemoteAddress = ""
+	e.handshake = time.Time{}
+	e.activated = map[string]time.Time{}
+}
+
+// connRead adds n bytes to those read from the source
+func (e *exporter) connRead(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn.BytesRead += int64(n)
+}
+
+// connMessage records that a message was received from the source
+func (e *exporter) connMessage() {
+	now := time.Now().UTC()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn.LastMessage = &now
+}
+
+// connError records the latest error connecting to, reading from, or processing a message of the source
+func (e *exporter) connError(err error) {
+	now := time.Now().UTC()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.conn.LastError = err.Error()
+	e.conn.LastErrorTime = &now
+}
+
+// connection returns the state of the connection to the source
+func (e *exporter) connection() connectionState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := e.conn
+	c.Target = e.target
+	return c
+}
+
+// connectionsHandler serves the connection state of every source as JSON
+func connectionsHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		conns := []connectionState{}
+		for _, e := range sources.list() {
+			conns = append(conns, e.connection())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(conns)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import "sort"
+
+// gnssNames maps u-blox GNSS IDs, as reported by gpsd in gnssid, to constellation names
+var gnssNames = map[int]string{
+	0: "gps",
+	1: "sbas",
+	2: "galileo",
+	3: "beidou",
+	4: "imes",
+	5: "qzss",
+	6: "glonass",
+	7: "navic",
+}
+
+// constellation returns the name of a satellite's constellation.
+// gnssid is zero both for GPS and when the driver doesn't report it, so GPS satellites are told apart by their NMEA PRN range.
+func constellation(sat *Satellite) string {
+	if name, ok := gnssNames[int(sat.GNSSID)]; ok && sat.GNSSID != 0 {
+		return name
+	}
+	switch prn := int(sat.PRN); {
+	case prn >= 1 && prn <= 63:
+		return "gps"
+	case prn >= 64 && prn <= 96:
+		return "glonass"
+	case prn >= 100 && prn <= 164:
+		return "sbas"
+	case prn >= 193 && prn <= 200:
+		return "qzss"
+	case prn >= 201 && prn <= 263:
+		return "beidou"
+	case prn >= 301 && prn <= 336:
+		return "galileo"
+	}
+	return "unknown"
+}
+
+// median returns the median of values, which it sorts
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// constellationStats accumulates the satellites of each constellation in a SKY report, reused across reports
+type constellationStats struct {
+	visible, used int
+	snrs          []float64
+}
+
+// updateConstellations exports the number of visible and used satellites of each constellation in a SKY report,
+// and the mean and median signal strength of its tracked satellites
+func (e *exporter) updateConstellations(sky *SKY) {
+	if len(sky.Satellites) == 0 {
+		return
+	}
+	for _, stats := range e.constellations {
+		stats.visible, stats.used, stats.snrs = 0, 0, stats.snrs[:0]
+	}
+	for i := range sky.Satellites {
+		sat := &sky.Satellites[i]
+		name := constellation(sat)
+		stats, ok := e.constellations[name]
+		if !ok {
+			stats = &constellationStats{}
+			e.constellations[name] = stats
+		}
+		stats.visible++
+		if sat.Used {
+			stats.used++
+		}
+		if sat.SNR > 0 {
+			stats.snrs = append(stats.snrs, sat.SNR)
+		}
+	}
+
+	visibleVec := e.reportGaugeVec("gpsd_constellation_satellites_visible", "Number of satellites of the constellation in the latest SKY report", "constellation")
+	usedVec := e.reportGaugeVec("gpsd_constellation_satellites_used", "Number of satellites of the constellation used in the navigation solution", "constellation")
+	mean := e.reportGaugeVec("gpsd_constellation_snr_mean_dbhz", "Mean signal to noise ratio of the tracked satellites of the constellation", "constellation")
+	med := e.reportGaugeVec("gpsd_constellation_snr_median_dbhz", "Median signal to noise ratio of the tracked satellites of the constellation", "constellation")
+	for name, stats := range e.constellations {
+		// Constellations no longer visible or tracked mustn't keep their last values
+		if stats.visible == 0 {
+			e.dropSeries(visibleVec, name)
+			e.dropSeries(usedVec, name)
+			delete(e.constellations, name)
+		} else {
+			e.series(visibleVec, name).Set(float64(stats.visible))
+			e.series(usedVec, name).Set(float64(stats.used))
+		}
+		if len(stats.snrs) == 0 {
+			e.dropSeries(mean, name)
+			e.dropSeries(med, name)
+			continue
+		}
+		var sum float64
+		for _, v := range stats.snrs {
+			sum += v
+		}
+		e.series(mean, name).Set(sum / float64(len(stats.snrs)))
+		e.series(med, name).Set(median(stats.snrs))
+	}
+}
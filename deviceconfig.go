@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// deviceSettings are the DEVICE attributes that can be changed, with whether each takes a number
+var deviceSettings = map[string]bool{
+	"bps":      true,
+	"parity":   false,
+	"stopbits": true,
+	"native":   true,
+	"cycle":    true,
+}
+
+// deviceConfig is a device configuration to apply through gpsd's ?DEVICE command
+type deviceConfig struct {
+	path     string
+	settings map[string]any
+}
+
+// command returns the ?DEVICE command applying the configuration
+func (d deviceConfig) command() string {
+	m := map[string]any{"class": "DEVICE", "path": d.path}
+	for k, v := range d.settings {
+		m[k] = v
+	}
+	b, _ := json.Marshal(m)
+	return fmt.Sprintf("?DEVICE=%s;\n", b)
+}
+
+// matches reports whether a DEVICE report from gpsd has every requested setting
+func (d deviceConfig) matches(report map[string]interface{}) bool {
+	for k, want := range d.settings {
+		if fmt.Sprint(report[k]) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// deviceConfigsFlag is a repeatable flag of device configurations in path,key=value,... form
+type deviceConfigsFlag []deviceConfig
+
+func (f *deviceConfigsFlag) String() string {
+	var paths []string
+	for _, d := range *f {
+		paths = append(paths, d.path)
+	}
+	return strings.Join(paths, ", ")
+}
+
+func (f *deviceConfigsFlag) Set(value string) error {
+	parts := strings.Split(value, ",")
+	d := deviceConfig{path: parts[0], settings: map[string]any{}}
+	if d.path == "" {
+		return fmt.Errorf("device configuration %q has no device path", value)
+	}
+	for _, setting := range parts[1:] {
+		k, v, ok := strings.Cut(setting, "=")
+		numeric, known := deviceSettings[k]
+		if !ok || !known {
+			return fmt.Errorf("invalid device setting %q (expected bps, parity, stopbits, native, or cycle=value)", setting)
+		}
+		if !numeric {
+			d.settings[k] = v
+			continue
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s for %s: %w", k, d.path, err)
+		}
+		d.settings[k] = n
+	}
+	*f = append(*f, d)
+	return nil
+}
+
+// processDevice records whether a DEVICE report reflects the configuration requested for it
+func (e *exporter) processDevice(line string) error {
+	var report map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &report); err != nil {
+		return fmt.Errorf("unmarshalling DEVICE: %w", err)
+	}
+	var device DEVICE
+	if err := json.Unmarshal([]byte(line), &device); err != nil {
+		return fmt.Errorf("unmarshalling DEVICE: %w", err)
+	}
+	e.updateReceiver(device)
+	e.updateDriver(device)
+	path, activated := device.Path, device.Activated
+	e.mu.Lock()
+	delete(e.pendingConfigs, path)
+	e.setActivated(path, activated)
+	e.mu.Unlock()
+	for _, d := range deviceConfigs {
+		if d.path != path {
+			continue
+		}
+		if d.matches(report) {
+			log.Debugf("gpsd applied configuration for %s", path)
+			e.deviceConfigAccepted.WithLabelValues(path).Set(1)
+		} else {
+			log.Warnf("gpsd didn't apply the requested configuration for %s: %s", path, line)
+			e.deviceConfigAccepted.WithLabelValues(path).Set(0)
+		}
+	}
+	return nil
+}
+
+// configureDevices returns the ?DEVICE commands for the configured devices, marking each as awaiting gpsd's reply
+func (e *exporter) configureDevices() string {
+	var cmds strings.Builder
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, d := range deviceConfigs {
+		e.pendingConfigs[d.path] = true
+		cmds.WriteString(d.command())
+	}
+	return cmds.String()
+}
+
+// processError handles an ERROR message, which gpsd sends instead of a DEVICE reply when it rejects a configuration
+func (e *exporter) processError(m map[string]interface{}) error {
+	message, _ := m["message"].(string)
+	e.countError(message)
+	e.mu.Lock()
+	for path := range e.pendingConfigs {
+		log.Warnf("gpsd rejected the configuration for %s: %s", path, message)
+		e.deviceConfigAccepted.WithLabelValues(path).Set(0)
+		delete(e.pendingConfigs, path)
+	}
+	e.mu.Unlock()
+	return fmt.Errorf("gpsd error: %s", message)
+}
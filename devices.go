@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DEVICE represents a gpsd DEVICE (device configuration) class (https://gpsd.io/gpsd_json.html#_device)
+type DEVICE struct {
+	Path      string  `json:"path" description:"Name the device for which the control bits are being reported, or for which they are to be applied."`
+	Activated string  `json:"activated" description:"Time the device was activated as an ISO8601 timestamp. If the device is inactive this attribute is absent."`
+	Flags     float64 `json:"flags" description:"Bit vector of property flags. Currently defined flags are: describe packet types seen so far (GPS, RTCM2, RTCM3, AIS)."`
+	Driver    string  `json:"driver" description:"GPSD's name for the device driver type."`
+	Subtype   string  `json:"subtype" description:"Whatever version information the device driver returned."`
+	BPS       float64 `json:"bps" description:"Device speed in bits per second."`
+	Parity    string  `json:"parity" description:"N, O or E for no parity, odd, or even."`
+	StopBits  float64 `json:"stopbits" description:"Stop bits (1 or 2)."`
+	Native    float64 `json:"native" description:"0 means NMEA mode and 1 means alternate mode (binary if it has one, for SiRF and Evermore chipsets in particular)."`
+	Cycle     float64 `json:"cycle" description:"Device cycle time in seconds."`
+	MinCycle  float64 `json:"mincycle" description:"Device minimum cycle time in seconds."`
+}
+
+// DEVICES represents a gpsd DEVICES (device list) class (https://gpsd.io/gpsd_json.html#_devices)
+type DEVICES struct {
+	Devices []DEVICE `json:"devices" description:"List of device descriptions"`
+	Remote  string   `json:"remote" description:"URL of the remote daemon reporting this version. If empty, this is the version of the local daemon."`
+}
+
+// WATCH represents a gpsd WATCH (watcher mode policy) class (https://gpsd.io/gpsd_json.html#_watch)
+type WATCH struct {
+	Enable  bool   `json:"enable" description:"Enable (true) or disable (false) watcher mode."`
+	JSON    bool   `json:"json" description:"Enable (true) or disable (false) dumping of JSON reports."`
+	NMEA    bool   `json:"nmea" description:"Enable (true) or disable (false) dumping of binary packets as pseudo-NMEA."`
+	Raw     int    `json:"raw" description:"Controls 'raw' mode."`
+	Scaled  bool   `json:"scaled" description:"If true, apply scaling divisors to output before dumping."`
+	Split24 bool   `json:"split24" description:"If true, aggregate AIS type24 sentence parts."`
+	PPS     bool   `json:"pps" description:"If true, emit the TOFF JSON message on each cycle and a PPS JSON message when the device issues 1PPS."`
+	Timing  bool   `json:"timing" description:"If true, add timing information to reports."`
+	Device  string `json:"device" description:"If present, enable watching only of the specified device rather than all devices."`
+}
+
+// processDevices records the devices gpsd knows about from a DEVICES message
+func (e *exporter) processDevices(line string) error {
+	var devices DEVICES
+	if err := json.Unmarshal([]byte(line), &devices); err != nil {
+		return fmt.Errorf("unmarshalling DEVICES: %w", err)
+	}
+	log.Tracef("DEVICES: %+v", devices)
+
+	e.mu.Lock()
+	previous := map[string]bool{}
+	for _, d := range e.devices {
+		previous[d] = true
+	}
+	e.devices = e.devices[:0]
+	e.activated = map[string]time.Time{}
+	for _, d := range devices.Devices {
+		e.devices = append(e.devices, d.Path)
+		e.setActivated(d.Path, d.Activated)
+	}
+	inventoried := e.inventoried
+	e.inventoried = true
+	e.mu.Unlock()
+	if inventoried {
+		e.diffInventory(previous, devices.Devices)
+	}
+	e.updateReceivers(devices.Devices)
+	e.updateDrivers(devices.Devices)
+	e.updateWatched()
+	events.publish("devices", &devices)
+	return nil
+}
+
+// diffInventory logs and counts the devices added to and removed from gpsd since its previous DEVICES message
+func (e *exporter) diffInventory(previous map[string]bool, devices []DEVICE) {
+	for _, d := range devices {
+		if previous[d.Path] {
+			delete(previous, d.Path)
+			continue
+		}
+		log.Infof("Device %s (%s) added to gpsd %s", d.Path, d.Driver, e.target)
+		e.devicesAdded.WithLabelValues(d.Path).Inc()
+	}
+	for d := range previous {
+		log.Warnf("Device %s removed from gpsd %s", d, e.target)
+		e.devicesRemoved.WithLabelValues(d).Inc()
+	}
+}
+
+// processWatch records the watcher policy gpsd acknowledged
+func (e *exporter) processWatch(line string) error {
+	var watch WATCH
+	if err := json.Unmarshal([]byte(line), &watch); err != nil {
+		return fmt.Errorf("unmarshalling WATCH: %w", err)
+	}
+	log.Tracef("WATCH: %+v", watch)
+
+	e.mu.Lock()
+	e.watch = watch
+	e.mu.Unlock()
+	if watch.Enable {
+		e.watchEnabled.Set(1)
+	} else {
+		e.watchEnabled.Set(0)
+	}
+	e.updateWatched()
+	return nil
+}
+
+// watchedDevices returns the devices gpsd is sending reports for
+func (e *exporter) watchedDevices() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var watched []string
+	for _, d := range e.devices {
+		if e.watch.Enable && (e.watch.Device == "" || e.watch.Device == d) {
+			watched = append(watched, d)
+		}
+	}
+	return watched
+}
+
+// updateWatched exports the watch state of each known device
+func (e *exporter) updateWatched() {
+	e.mu.Lock()
+	devices := append([]string{}, e.devices...)
+	e.mu.Unlock()
+	watched := map[string]bool{}
+	for _, d := range e.watchedDevices() {
+		watched[d] = true
+	}
+
+	e.deviceWatched.Reset()
+	for _, d := range devices {
+		if watched[d] {
+			e.deviceWatched.WithLabelValues(d).Set(1)
+		} else {
+			e.deviceWatched.WithLabelValues(d).Set(0)
+		}
+	}
+}
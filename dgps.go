@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// dgpsState is the differential correction state of a device that has reported DGPS corrections
+type dgpsState struct {
+	stale   bool   // Whether the corrections were older than -dgps.max-age or missing in the latest fix
+	station string // Station of the latest corrections, empty until one is reported
+}
+
+// updateDGPS exports whether the DGPS corrections of a device are stale and the station they came from, counting each time they go stale.
+// Devices are only tracked once they report corrections. gpsd drops dgpsAge and dgpsSta when corrections stop, so a later fix without them
+// counts as stale, while reports without a fix leave the state as it is.
+func (e *exporter) updateDGPS(tpv *TPV) {
+	corrected := tpv.DGPSAge != 0 || tpv.DGPSStation != 0
+	state, ok := e.dgps[tpv.Device]
+	if !ok {
+		if !corrected {
+			return
+		}
+		state = &dgpsState{}
+		e.dgps[tpv.Device] = state
+	}
+	if !corrected && tpv.Mode < 2 {
+		return
+	}
+
+	stale := !corrected || time.Duration(tpv.DGPSAge*float64(time.Second)) > *dgpsMaxAge
+	outages := e.dgpsStalenessEvents.WithLabelValues(tpv.Device) // Exported from zero so increase() sees the first outage
+	if stale && !state.stale {
+		outages.Inc()
+	}
+	state.stale = stale
+	if stale {
+		e.series(e.dgpsStale, tpv.Device).Set(1)
+	} else {
+		e.series(e.dgpsStale, tpv.Device).Set(0)
+	}
+
+	if !corrected {
+		return
+	}
+	station := strconv.Itoa(int(tpv.DGPSStation))
+	if station != state.station && state.station != "" {
+		e.dropPairSeries(e.dgpsStation, tpv.Device, state.station)
+	}
+	e.pairSeries(e.dgpsStation, tpv.Device, station).Set(1) // Set again after the series expired
+	state.station = station
+}
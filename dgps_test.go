@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDGPSStationLegacy(t *testing.T) {
+	defer func(legacy bool) { *legacyNames = legacy }(*legacyNames)
+	for _, legacy := range []bool{false, true} {
+		*legacyNames = legacy
+		reg := prometheus.NewRegistry()
+		e := newExporter("localhost:2947", reg)
+		e.handleReport("tpv", &TPV{Device: "/dev/ttyACM0", Mode: 3, Time: "2024-06-01T12:00:00.000Z", Lat: 37.7749, Lon: -122.4194, DGPSAge: 2, DGPSStation: 402})
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported := map[string]float64{}
+		for _, family := range families {
+			for _, m := range family.GetMetric() {
+				exported[family.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+		if _, ok := exported["gpsd_dgps_station_info"]; !ok {
+			t.Errorf("legacy names %t: station info not exported", legacy)
+		}
+		if v, ok := exported["gpsd_tpv_dgpsSta"]; ok != legacy || legacy && v != 402 {
+			t.Errorf("legacy names %t: gpsd_tpv_dgpsSta is %v (exported %t)", legacy, v, ok)
+		}
+
+		listed := false
+		for _, entry := range metricCatalog() {
+			listed = listed || entry.Name == "gpsd_tpv_dgpsSta"
+		}
+		if listed != legacy {
+			t.Errorf("legacy names %t: gpsd_tpv_dgpsSta listed in the catalog %t", legacy, listed)
+		}
+	}
+}
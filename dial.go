@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// defaultGPSDPort is used when a gpsd address is given without a port
+const defaultGPSDPort = "2947"
+
+// normalizeAddr adds defaultPort to addresses without one, accepting bare and bracketed IPv6 literals
+func normalizeAddr(addr, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// newDialer returns a dialer for gpsd connections, routed through proxyURL and then an SSH tunnel to sshTarget if set
+func newDialer(proxyURL, sshTarget string) (proxy.ContextDialer, error) {
+	direct := &multiDialer{
+		dialer:         net.Dialer{KeepAlive: *keepAlive},
+		attemptTimeout: *dialTimeout,
+	}
+	if *keepAlive == 0 {
+		direct.dialer.KeepAlive = -1 // A zero value enables Go's default interval
+	}
+	var d proxy.ContextDialer = direct
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "socks5", "socks5h":
+			socks, err := proxy.FromURL(u, direct)
+			if err != nil {
+				return nil, err
+			}
+			d = &timeoutDialer{dialer: socks.(proxy.ContextDialer), timeout: *dialTimeout}
+		case "http":
+			d = &timeoutDialer{dialer: &httpProxyDialer{proxy: u, forward: direct}, timeout: *dialTimeout}
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q (expected socks5, socks5h, or http)", u.Scheme)
+		}
+	}
+	if sshTarget != "" {
+		return newSSHDialer(sshTarget, *sshKey, *sshKnownHosts, d)
+	}
+	return d, nil
+}
+
+// multiDialer resolves a hostname and tries each of its addresses in turn, each with its own timeout
+type multiDialer struct {
+	dialer         net.Dialer
+	attemptTimeout time.Duration
+}
+
+// Dial connects to the first reachable address of addr
+func (d *multiDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the first reachable address of addr
+func (d *multiDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		target := net.JoinHostPort(ip.String(), port)
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if d.attemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, d.attemptTimeout)
+		}
+		conn, err := d.dialer.DialContext(attemptCtx, network, target)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		log.Debugf("Error connecting to %s (%s): %v", target, host, err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, lastErr
+}
+
+// timeoutDialer bounds an entire dial, including any proxy handshake, by a single timeout
+type timeoutDialer struct {
+	dialer  proxy.ContextDialer
+	timeout time.Duration
+}
+
+// DialContext connects to addr within the configured timeout
+func (d *timeoutDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	return d.dialer.DialContext(ctx, network, addr)
+}
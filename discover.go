@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// invalidMetricChars matches characters that can't appear in a metric name
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// knownFields returns the JSON fields of the struct a report class is decoded into
+func knownFields(class string) map[string]bool {
+	constructor, ok := streamedReports[strings.ToUpper(class)]
+	if !ok {
+		return nil
+	}
+	return jsonFields(reflect.TypeOf(constructor()).Elem())
+}
+
+// jsonFields returns the JSON fields of a struct type, and the class field every report has
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{"class": true}
+	for i := 0; i < t.NumField(); i++ {
+		field, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[field] = true
+	}
+	return fields
+}
+
+// satelliteFields are the JSON fields of a satellite in a SKY report
+var satelliteFields = jsonFields(reflect.TypeOf(Satellite{}))
+
+// inspectFields looks for fields of a raw report that aren't in its struct, for -strict and -metrics.auto-discover
+func (e *exporter) inspectFields(class string, raw map[string]interface{}) {
+	if *strict {
+		e.checkFields(class, raw)
+	}
+	if *autoDiscover {
+		e.discoverFields(class, raw)
+	}
+}
+
+// checkFields notes the fields of a report, and of the satellites in a SKY report, that aren't in its struct
+func (e *exporter) checkFields(class string, raw map[string]interface{}) {
+	known := knownFields(class)
+	for field := range raw {
+		if !known[field] {
+			e.noteUnknown(class, field)
+		}
+	}
+	if class != "sky" {
+		return
+	}
+	satellites, _ := raw["satellites"].([]interface{})
+	for _, sat := range satellites {
+		sat, _ := sat.(map[string]interface{})
+		for field := range sat {
+			if !satelliteFields[field] {
+				e.noteUnknown(class, "satellites."+field)
+			}
+		}
+	}
+}
+
+// noteUnknown counts an unknown class, or an unknown field of a class, logging each the first time it's seen
+func (e *exporter) noteUnknown(class, field string) {
+	e.unknownFields.WithLabelValues(class).Inc()
+	name := class
+	if field != "" {
+		name += "." + field
+	}
+	e.mu.Lock()
+	seen := e.unknown[name]
+	e.unknown[name] = true
+	e.mu.Unlock()
+	if seen {
+		return
+	}
+	if field == "" {
+		log.Warnf("Unknown gpsd class %s", strings.ToUpper(class))
+	} else {
+		log.Warnf("Unknown %s field %s", strings.ToUpper(class), field)
+	}
+}
+
+// discoverFields exports the numeric and boolean fields of a report that aren't in its struct, as added by newer gpsd releases,
+// labelled with the device of the report.
+// Reports that handleReport skipped as repeats don't revive discovered metrics that have expired.
+func (e *exporter) discoverFields(class string, raw map[string]interface{}) {
+	known := knownFields(class)
+	if known == nil {
+		return
+	}
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	if _, ok := e.lastSeen[class]; !ok {
+		return
+	}
+	device, _ := raw["device"].(string)
+	for field, value := range raw {
+		if known[field] {
+			continue
+		}
+		var v float64
+		switch value := value.(type) {
+		case float64:
+			v = value
+		case bool:
+			if value {
+				v = 1
+			}
+		default:
+			continue
+		}
+
+		name := fmt.Sprintf("gpsd_%s_%s", class, invalidMetricChars.ReplaceAllString(field, "_"))
+		vec, ok := e.gaugeVecs[name]
+		if !ok {
+			vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: name,
+				Help: fmt.Sprintf("Auto-discovered %s field %s", strings.ToUpper(class), field),
+			}, []string{"device"})
+			if err := e.reg.Register(vec); err != nil {
+				log.Debugf("Not exporting discovered field %s: %v", field, err)
+				continue
+			}
+			log.Infof("Discovered %s field %s, exporting it as %s", strings.ToUpper(class), field, name)
+			e.gaugeVecs[name] = vec
+		}
+		e.series(vec, device).Set(v)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDiscoverFields(t *testing.T) {
+	defer func(discover bool) { *autoDiscover = discover }(*autoDiscover)
+	*autoDiscover = true
+	e := newExporter("localhost:2947", prometheus.NewRegistry())
+	// Two receivers reporting fields this release doesn't know about
+	poll := `{"class":"POLL","time":"2024-06-01T12:00:00.000Z","active":2,"tpv":[` +
+		`{"class":"TPV","device":"/dev/ttyACM0","mode":3,"lat":37.7749,"lon":-122.4194,"wander":1.5,"jammed":true,"note":"text"},` +
+		`{"class":"TPV","device":"/dev/ttyUSB0","mode":3,"lat":37.7750,"lon":-122.4195,"wander":2.5,"jammed":false}],"gst":[],"sky":[]}`
+	if err := e.processLine(poll); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, device string
+		want         float64
+	}{
+		{"gpsd_tpv_wander", "/dev/ttyACM0", 1.5},
+		{"gpsd_tpv_wander", "/dev/ttyUSB0", 2.5},
+		{"gpsd_tpv_jammed", "/dev/ttyACM0", 1},
+		{"gpsd_tpv_jammed", "/dev/ttyUSB0", 0},
+	} {
+		vec, ok := e.gaugeVecs[tt.name]
+		if !ok {
+			t.Fatalf("%s not exported", tt.name)
+		}
+		if got := testutil.ToFloat64(vec.WithLabelValues(tt.device)); got != tt.want {
+			t.Errorf("%s{device=%q} is %v, want %v", tt.name, tt.device, got, tt.want)
+		}
+	}
+	if _, ok := e.gaugeVecs["gpsd_tpv_note"]; ok {
+		t.Error("exported the string field note")
+	}
+}
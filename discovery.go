@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// discoveredTarget is a gpsd target found by discovery, with the labels added to its metrics
+type discoveredTarget struct {
+	config targetConfig
+	labels prometheus.Labels
+}
+
+// newDiscoveredTarget returns a discovered target whose metrics carry labels and its address as the target label
+func newDiscoveredTarget(config targetConfig, labels prometheus.Labels) discoveredTarget {
+	t := discoveredTarget{config: config, labels: copyLabels(labels)}
+	t.labels["target"] = config.addr
+	return t
+}
+
+// key identifies a discovered target, which is restarted when its address, poll interval, or labels change
+func (t discoveredTarget) key() string {
+	var pairs []string
+	for name, value := range t.labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%s@%s{%s}", t.config.addr, t.config.pollInterval, strings.Join(pairs, ","))
+}
+
+// copyLabels returns a copy of labels
+func copyLabels(labels prometheus.Labels) prometheus.Labels {
+	c := prometheus.Labels{}
+	for name, value := range labels {
+		c[name] = value
+	}
+	return c
+}
+
+// watchTargets periodically starts and stops gpsd targets to match those returned by lookup.
+// The previous targets are kept while lookup fails, so a half-written file or unreachable service doesn't drop them.
+func (s *sourceSet) watchTargets(provider string, interval time.Duration, dialer proxy.ContextDialer, lookup func() (map[string]discoveredTarget, error)) {
+	for {
+		targets, err := lookup()
+		if err != nil {
+			log.Warnf("Error discovering gpsd targets from %s: %v", provider, err)
+		} else {
+			s.reconcile(provider, targets, dialer)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// reconcile starts the targets of a discovery provider that aren't running yet and stops the ones it no longer lists
+func (s *sourceSet) reconcile(provider string, targets map[string]discoveredTarget, dialer proxy.ContextDialer) {
+	s.mu.Lock()
+	if s.discovered == nil {
+		s.discovered = map[string]map[string]*gpsdClient{}
+	}
+	running := s.discovered[provider]
+	if running == nil {
+		running = map[string]*gpsdClient{}
+		s.discovered[provider] = running
+	}
+	static := map[string]bool{}
+	for _, t := range gpsdTargets {
+		static[t.addr] = true
+	}
+	s.mu.Unlock()
+
+	for key, c := range running {
+		if _, ok := targets[key]; !ok {
+			log.Infof("Stopping gpsd target %s, which is no longer in %s", c.addr, provider)
+			c.stop()
+			s.remove(c)
+			delete(running, key)
+		}
+	}
+	for key, t := range targets {
+		if _, ok := running[key]; ok {
+			continue
+		}
+		if static[t.config.addr] {
+			log.Warnf("Ignoring gpsd target %s from %s, which is already given with -d", t.config.addr, provider)
+			continue
+		}
+		log.Infof("Starting gpsd target %s from %s", t.config.addr, provider)
+		reg := prometheus.NewRegistry()
+		c, err := startTarget(t.config, prometheus.WrapRegistererWith(t.labels, withConstLabels(reg)), dialer, make(chan struct{}))
+		if err != nil {
+			log.Warnf("Error starting gpsd target %s from %s: %v", t.config.addr, provider, err)
+			continue
+		}
+		s.addDiscovered(c, reg)
+		running[key] = c
+	}
+}
+
+// lookupSRV returns the gpsd targets of a DNS SRV record
+func lookupSRV(name string) (map[string]discoveredTarget, error) {
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]discoveredTarget{}
+	for _, r := range records {
+		addr := net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port)))
+		t := newDiscoveredTarget(targetConfig{addr: addr}, nil)
+		targets[t.key()] = t
+	}
+	return targets, nil
+}
+
+// consulEntry is the part of an entry of Consul's service health API used to find gpsd targets
+type consulEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// consulClient queries the Consul agent
+var consulClient = &http.Client{Timeout: 10 * time.Second}
+
+// lookupConsul returns the gpsd targets registered as a Consul service whose health checks pass, labeled with their node
+func lookupConsul(agent, service, token string) (map[string]discoveredTarget, error) {
+	if !strings.Contains(agent, "://") {
+		agent = "http://" + agent
+	}
+	u, err := url.Parse(agent)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/v1/health/service/" + url.PathEscape(service)
+	u.RawQuery = "passing=true"
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	resp, err := consulClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul responded %s", resp.Status)
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding consul response: %w", err)
+	}
+
+	targets := map[string]discoveredTarget{}
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		addr := host
+		if entry.Service.Port != 0 {
+			addr = net.JoinHostPort(host, strconv.Itoa(entry.Service.Port))
+		}
+		t := newDiscoveredTarget(targetConfig{addr: normalizeAddr(addr, defaultGPSDPort)}, prometheus.Labels{"node": entry.Node.Node})
+		targets[t.key()] = t
+	}
+	return targets, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// skyDOPs returns the dilutions of precision of a SKY report by name
+func skyDOPs(sky *SKY) map[string]float64 {
+	return map[string]float64{
+		"gdop": sky.GDOP,
+		"hdop": sky.HDOP,
+		"pdop": sky.PDOP,
+		"tdop": sky.TDOP,
+		"vdop": sky.VDOP,
+		"xdop": sky.XDOP,
+		"ydop": sky.YDOP,
+	}
+}
+
+// updateDeviceDOPs exports the dilutions of precision of a SKY report labeled with its device, skipping those missing from the report
+func (e *exporter) updateDeviceDOPs(sky *SKY) {
+	for dop, value := range skyDOPs(sky) {
+		if value != 0 {
+			e.pairSeries(e.deviceDOP, sky.Device, dop).Set(value)
+		}
+	}
+}
+
+// dopThresholdsFlag maps dilutions of precision to the value above which the satellite geometry counts as poor
+type dopThresholdsFlag map[string]float64
+
+func (f dopThresholdsFlag) String() string {
+	var specs []string
+	for dop, threshold := range f {
+		specs = append(specs, fmt.Sprintf("%s=%g", dop, threshold))
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (f dopThresholdsFlag) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		dop, threshold, ok := strings.Cut(spec, "=")
+		dop = strings.ToLower(dop)
+		if _, known := skyDOPs(&SKY{})[dop]; !ok || !known {
+			return fmt.Errorf("invalid DOP threshold %q (expected gdop, hdop, pdop, tdop, vdop, xdop, or ydop=value)", spec)
+		}
+		n, err := strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s threshold: %w", dop, err)
+		}
+		f[dop] = n
+	}
+	return nil
+}
+
+// updateDOPBreaches exports whether each configured DOP is above its threshold, counting each time one crosses it.
+// DOPs missing from the report leave the breach state as it is.
+func (e *exporter) updateDOPBreaches(sky *SKY) {
+	dops := skyDOPs(sky)
+	for dop, threshold := range dopThresholds {
+		value := dops[dop]
+		if value == 0 {
+			continue
+		}
+		breached := value > threshold
+		breaches := e.dopBreaches.WithLabelValues(dop) // Exported from zero so increase() sees the first breach
+		if breached && !e.dopBreached[dop] {
+			breaches.Inc()
+		}
+		e.dopBreached[dop] = breached
+		if breached {
+			e.series(e.dopBreach, dop).Set(1)
+		} else {
+			e.series(e.dopBreach, dop).Set(0)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// driftSample is a system clock offset implied by a TOFF report, kept for the frequency error regression
+type driftSample struct {
+	time   float64 // GPS time, seconds
+	offset float64 // Offset of the system clock, seconds
+}
+
+// minDriftSamples is the number of TOFF reports needed before a frequency error is estimated
+const minDriftSamples = 3
+
+// driftSlope returns the least squares slope of the offsets over time, in seconds per second
+func driftSlope(samples []driftSample) float64 {
+	t0 := samples[0].time // Keeps the sums small enough for float64 to resolve nanoseconds
+	var n, sumT, sumO, sumTT, sumTO float64
+	for _, s := range samples {
+		t := s.time - t0
+		n++
+		sumT += t
+		sumO += s.offset
+		sumTT += t * t
+		sumTO += t * s.offset
+	}
+	d := n*sumTT - sumT*sumT
+	if d == 0 {
+		return 0
+	}
+	return (n*sumTO - sumT*sumO) / d
+}
+
+// updateDrift estimates the frequency error of the system clock from the trend of its TOFF offsets over -toff.drift-window,
+// and counts steps of the offset by more than -toff.step-threshold from that trend, which restart the estimate.
+func (e *exporter) updateDrift(toff *TOFF) {
+	if toff.RealSec == 0 {
+		return
+	}
+	steps := e.clockSteps.WithLabelValues(toff.Device) // Exported from zero so increase() sees the first step
+	sample := driftSample{
+		time:   toff.RealSec + toff.RealNsec/1e9,
+		offset: toff.ClockSec - toff.RealSec + (toff.ClockNsec-toff.RealNsec)/1e9,
+	}
+	samples := e.drift[toff.Device]
+	if n := len(samples); n > 0 {
+		last := samples[n-1]
+		if sample.time <= last.time {
+			return // A POLL response repeating a report already sampled
+		}
+		expected := last.offset
+		if n >= minDriftSamples {
+			expected += driftSlope(samples) * (sample.time - last.time)
+		}
+		if step := sample.offset - expected; math.Abs(step) > toffStepThreshold.Seconds() {
+			steps.Inc()
+			log.Infof("System clock of %s stepped by %.6fs", toff.Device, step)
+			samples = nil
+			e.dropSeries(e.clockFrequencyError, toff.Device)
+		}
+	}
+
+	samples = append(samples, sample)
+	i := 0
+	for i < len(samples) && sample.time-samples[i].time > toffDriftWindow.Seconds() {
+		i++
+	}
+	samples = samples[i:]
+	e.drift[toff.Device] = samples
+	if len(samples) >= minDriftSamples {
+		e.series(e.clockFrequencyError, toff.Device).Set(driftSlope(samples) * 1e6)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// driftStart is a GPS time in seconds, large enough that the regression has to keep nanoseconds apart from it
+const driftStart = 1717243200
+
+func TestDriftSlope(t *testing.T) {
+	linear := func(n int, interval, offset, slope float64) []driftSample {
+		var samples []driftSample
+		for i := 0; i < n; i++ {
+			t := float64(i) * interval
+			samples = append(samples, driftSample{time: driftStart + t, offset: offset + slope*t})
+		}
+		return samples
+	}
+	for _, tt := range []struct {
+		name    string
+		samples []driftSample
+		want    float64
+	}{
+		{"constant offset", linear(10, 1, 0.002, 0), 0},
+		{"1 ppm fast", linear(10, 1, 0.002, 1e-6), 1e-6},
+		{"50 ppb slow", linear(600, 1, -0.01, -50e-9), -50e-9},
+		{"uneven intervals", []driftSample{{driftStart, 0}, {driftStart + 1, 2e-6}, {driftStart + 5, 10e-6}, {driftStart + 6, 12e-6}}, 2e-6},
+		{"noise around a trend", []driftSample{{driftStart, 1e-6}, {driftStart + 1, 1e-6}, {driftStart + 2, 5e-6}, {driftStart + 3, 5e-6}}, 1.6e-6},
+		{"single time", []driftSample{{driftStart, 0}, {driftStart, 1e-3}}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := driftSlope(tt.samples); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("got %g s/s, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+// toff returns a TOFF report of a system clock offset from the GPS clock at t seconds after driftStart.
+// Times are split into whole seconds and nanoseconds as gpsd reports them, which float64 can't hold together.
+func toff(t, offset float64) *TOFF {
+	real := int64(math.Round(t * 1e9))
+	clock := real + int64(math.Round(offset*1e9))
+	return &TOFF{
+		Device:    "/dev/ttyACM0",
+		RealSec:   float64(driftStart + real/1e9),
+		RealNsec:  float64(real % 1e9),
+		ClockSec:  float64(driftStart + clock/1e9),
+		ClockNsec: float64(clock % 1e9),
+	}
+}
+
+func TestUpdateDrift(t *testing.T) {
+	// fast is a clock running 2 ppm fast
+	fast := func(t float64) *TOFF { return toff(t, 0.001+2e-6*t) }
+	for _, tt := range []struct {
+		name      string
+		reports   []*TOFF
+		steps     float64
+		frequency float64 // ppm, NaN when no estimate should be exported
+		window    int     // Samples kept
+	}{
+		{"too few samples", []*TOFF{fast(0), fast(1)}, 0, math.NaN(), 2},
+		{"steady drift", []*TOFF{fast(0), fast(1), fast(2), fast(3), fast(4)}, 0, 2, 5},
+		{"repeated report", []*TOFF{fast(0), fast(1), fast(2), fast(2), fast(1)}, 0, 2, 3},
+		{"no GPS time", []*TOFF{fast(0), fast(1), {Device: "/dev/ttyACM0"}, fast(2)}, 0, 2, 3},
+		{"step", []*TOFF{fast(0), fast(1), fast(2), fast(3), toff(4, 0.5)}, 1, math.NaN(), 1},
+		{"step before a trend", []*TOFF{fast(0), toff(1, -0.2)}, 1, math.NaN(), 1},
+		{"drift within the threshold", []*TOFF{toff(0, 0), toff(1, 0.1), toff(2, 0.2)}, 0, 1e5, 3},
+		{"estimate after a step", []*TOFF{fast(0), fast(1), fast(2), toff(3, 0.5), toff(4, 0.5+2e-6), toff(5, 0.5+4e-6)}, 1, 2, 3},
+		{"window", []*TOFF{fast(0), fast(300), fast(600), fast(900), fast(1200)}, 0, 2, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExporter("localhost:2947", prometheus.NewRegistry())
+			for _, report := range tt.reports {
+				e.updateDrift(report)
+			}
+			if steps := testutil.ToFloat64(e.clockSteps.WithLabelValues("/dev/ttyACM0")); steps != tt.steps {
+				t.Errorf("counted %v steps, want %v", steps, tt.steps)
+			}
+			if n := len(e.drift["/dev/ttyACM0"]); n != tt.window {
+				t.Errorf("kept %d samples, want %d", n, tt.window)
+			}
+			exported := testutil.CollectAndCount(e.clockFrequencyError) > 0
+			if math.IsNaN(tt.frequency) {
+				if exported {
+					t.Errorf("exported a frequency error of %v ppm", testutil.ToFloat64(e.clockFrequencyError.WithLabelValues("/dev/ttyACM0")))
+				}
+				return
+			}
+			if !exported {
+				t.Fatal("no frequency error exported")
+			}
+			// Nanosecond offsets limit the estimate over a few seconds to about a thousandth of a ppm
+			if ppm := testutil.ToFloat64(e.clockFrequencyError.WithLabelValues("/dev/ttyACM0")); math.Abs(ppm-tt.frequency) > 1e-3*math.Max(1, math.Abs(tt.frequency)) {
+				t.Errorf("estimated %v ppm, want %v", ppm, tt.frequency)
+			}
+		})
+	}
+}
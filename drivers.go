@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// updateDrivers exports the driver state of the devices gpsd listed, dropping that of devices it no longer lists
+func (e *exporter) updateDrivers(devices []DEVICE) {
+	listed := map[string]bool{}
+	for _, d := range devices {
+		listed[d.Path] = true
+		e.updateDriver(d)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for path := range e.speeds {
+		if !listed[path] {
+			delete(e.speeds, path)
+			e.deviceBPS.DeleteLabelValues(path)
+			e.packetsRecognized.DeleteLabelValues(path)
+		}
+	}
+}
+
+// updateDriver exports the speed gpsd talks to a device at and whether it has recognized any packets from it, counting speed changes.
+// gpsd hunts through speeds while it can't make sense of a device, so a device whose speed keeps changing without any packet type
+// recognized is talking at a speed or protocol gpsd doesn't expect rather than lacking satellites.
+func (e *exporter) updateDriver(d DEVICE) {
+	// Flags are a bit vector of the packet types seen so far: GPS, RTCM2, RTCM3 and AIS
+	if int(d.Flags)&0x0f != 0 {
+		e.packetsRecognized.WithLabelValues(d.Path).Set(1)
+	} else {
+		e.packetsRecognized.WithLabelValues(d.Path).Set(0)
+	}
+	if d.BPS == 0 {
+		return // Not a serial device
+	}
+	e.deviceBPS.WithLabelValues(d.Path).Set(d.BPS)
+	changes := e.bpsChanges.WithLabelValues(d.Path) // Exported from zero so increase() sees the first change
+
+	e.mu.Lock()
+	previous, ok := e.speeds[d.Path]
+	e.speeds[d.Path] = d.BPS
+	e.mu.Unlock()
+	if ok && previous != d.BPS {
+		log.Debugf("gpsd %s changed the speed of %s from %.0f to %.0f bps", e.target, d.Path, previous, d.BPS)
+		changes.Inc()
+	}
+}
+
+// countError counts an ERROR message from gpsd against the device it names, if any
+func (e *exporter) countError(message string) {
+	e.mu.Lock()
+	device := ""
+	for _, d := range e.devices {
+		if strings.Contains(message, d) {
+			device = d
+			break
+		}
+	}
+	e.mu.Unlock()
+	e.errors.WithLabelValues(device).Inc()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// Exit statuses of the dump subcommand
+const (
+	dumpFix3D = 0
+	dumpError = 1
+	dumpNoFix = 2
+	dumpFix2D = 3
+)
+
+// runDump polls gpsd once, prints the result, and exits with a status reflecting the fix
+func runDump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	format := fs.String("format", "prom", "output format (prom or json)")
+	addr := fs.String("d", "localhost:2947", "gpsd address")
+	timeout := fs.Duration("timeout", 10*time.Second, "give up if gpsd hasn't answered the poll within this long")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s dump [flags]\n\nExits 0 with a 3D fix, %d with a 2D fix, %d without a fix, and %d on error.\n\n", os.Args[0], dumpFix2D, dumpNoFix, dumpError)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *format != "prom" && *format != "json" {
+		log.Fatalf("Unknown dump format %q", *format)
+	}
+
+	registry := prometheus.NewRegistry()
+	e := newExporter(*addr, registry)
+	report, err := pollOnce(e, normalizeAddr(*addr, defaultGPSDPort), *timeout)
+	if err != nil {
+		log.Error(err)
+		os.Exit(dumpError)
+	}
+
+	var tpvs struct {
+		Mode float64 `json:"mode"`
+		TPV  []TPV   `json:"tpv"`
+	}
+	_ = json.Unmarshal(report, &tpvs)
+	mode := tpvs.Mode
+	for _, tpv := range tpvs.TPV {
+		if tpv.Mode > mode {
+			mode = tpv.Mode
+		}
+	}
+
+	switch *format {
+	case "json":
+		var out bytes.Buffer
+		_ = json.Indent(&out, report, "", "  ")
+		fmt.Println(out.String())
+	case "prom":
+		families, err := registry.Gather()
+		if err != nil {
+			log.Error(err)
+			os.Exit(dumpError)
+		}
+		enc := expfmt.NewEncoder(os.Stdout, expfmt.FmtText)
+		for _, mf := range families {
+			_ = enc.Encode(mf)
+		}
+	}
+
+	switch {
+	case mode >= 3:
+		os.Exit(dumpFix3D)
+	case mode == 2:
+		os.Exit(dumpFix2D)
+	default:
+		os.Exit(dumpNoFix)
+	}
+}
+
+// pollOnce connects to gpsd, updates e from a single POLL response, and returns it.
+// gpsd releases without ?POLL return the first streamed TPV report instead.
+func pollOnce(e *exporter, addr string, timeout time.Duration) ([]byte, error) {
+	dialer, err := newDialer(*proxyURL, *sshTarget)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to gpsd %s: %w", addr, err)
+	}
+	defer conn.Close()
+	e.up.Set(1)
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	reader := newLineReader(conn, e)
+	sent := false
+	for {
+		line, err := reader.next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("gpsd %s closed the connection before answering the poll", addr)
+		} else if err != nil {
+			return nil, fmt.Errorf("reading from gpsd %s: %w", addr, err)
+		}
+		if err := e.processLine(line); err != nil {
+			return nil, err
+		}
+		class, _ := peekClass(line)
+		switch {
+		case class == "VERSION" && !sent:
+			if _, err := conn.Write([]byte(e.pollCommands())); err != nil {
+				return nil, fmt.Errorf("sending POLL command: %w", err)
+			}
+			sent = true
+		case class == "POLL", class == "TPV" && e.streaming():
+			e.setLastPoll(time.Now())
+			return []byte(line), nil
+		}
+	}
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// exporter holds the metrics for a single gpsd target
+type exporter struct {
+	target   string                         // Address or URL of the source, for APIs listing data from all sources
+	onReport func(class string, report any) // Called with each new report, if set
+	reg      prometheus.Registerer
+	factory  promauto.Factory
+
+	lastPoll             prometheus.Gauge
+	up                   prometheus.Gauge
+	connectionInfo       *prometheus.GaugeVec
+	version              *prometheus.GaugeVec
+	stalls               prometheus.Counter
+	droppedLines         prometheus.Counter
+	malformedLines       *prometheus.CounterVec
+	taskUp               *prometheus.GaugeVec
+	taskPanics           *prometheus.CounterVec
+	restarts             prometheus.Counter
+	reconnects           prometheus.Counter
+	distance             *prometheus.CounterVec
+	averageLat           *prometheus.GaugeVec
+	averageLon           *prometheus.GaugeVec
+	averageAlt           *prometheus.GaugeVec
+	referenceLearning    prometheus.Gauge
+	referenceDistance    *prometheus.GaugeVec
+	referenceDrift       *prometheus.GaugeVec
+	referenceVertical    *prometheus.GaugeVec
+	velocity3D           *prometheus.GaugeVec
+	climbSmoothed        *prometheus.GaugeVec
+	moving               *prometheus.GaugeVec
+	headingDeviation     *prometheus.GaugeVec
+	movingBaseHeading    *prometheus.GaugeVec
+	baselineValid        *prometheus.GaugeVec
+	baselineLength       *prometheus.GaugeVec
+	headingInconsistent  *prometheus.GaugeVec
+	stationaryDuration   *prometheus.GaugeVec
+	maxSpeed             *prometheus.GaugeVec
+	maxAltitude          *prometheus.GaugeVec
+	tripActive           *prometheus.GaugeVec
+	tripsTotal           *prometheus.CounterVec
+	tripDistance         *prometheus.GaugeVec
+	tripDuration         *prometheus.GaugeVec
+	timeParseErrors      prometheus.Counter
+	cardinalityOverflows *prometheus.CounterVec
+	unknownFields        *prometheus.CounterVec
+	protoMajor           prometheus.Gauge
+	protoMinor           prometheus.Gauge
+	reports              *prometheus.CounterVec
+	pollActive           prometheus.Gauge
+	pollIntervalSeconds  prometheus.Gauge
+	watchEnabled         prometheus.Gauge
+	deviceWatched        *prometheus.GaugeVec
+	devicesAdded         *prometheus.CounterVec
+	devicesRemoved       *prometheus.CounterVec
+	receiverInfo         *prometheus.GaugeVec
+	deviceBPS            *prometheus.GaugeVec
+	bpsChanges           *prometheus.CounterVec
+	packetsRecognized    *prometheus.GaugeVec
+	errors               *prometheus.CounterVec
+	deviceConfigAccepted *prometheus.GaugeVec
+	pollPresent          *prometheus.GaugeVec
+	ppsOffset            prometheus.Histogram
+	qErr                 *prometheus.HistogramVec
+	pulseInterval        *prometheus.GaugeVec
+	offsetDisagreement   *prometheus.GaugeVec
+	clockFrequencyError  *prometheus.GaugeVec
+	clockSteps           *prometheus.CounterVec
+	anomalyDetected      *prometheus.GaugeVec
+	deviceDOP            *prometheus.GaugeVec
+	skySectorUsed        *prometheus.GaugeVec
+	snrMin               *prometheus.GaugeVec
+	snrMax               *prometheus.GaugeVec
+	snrMean              *prometheus.GaugeVec
+	deviceQuality        *prometheus.GaugeVec
+	signalQuality        *prometheus.GaugeVec
+	anomalyCounts        *prometheus.CounterVec
+	missingPulses        *prometheus.CounterVec
+	qErrRMS              *prometheus.GaugeVec
+	snr                  prometheus.Histogram
+	fixOutage            prometheus.Histogram
+	fixLosses            *prometheus.CounterVec
+	ephSummary           *prometheus.SummaryVec
+	epvSummary           *prometheus.SummaryVec
+	sepSummary           *prometheus.SummaryVec
+	satAppearances       *prometheus.CounterVec
+	dopBreaches          *prometheus.CounterVec
+	antennaStatus        *prometheus.GaugeVec
+	dgpsStale            *prometheus.GaugeVec
+	dgpsStalenessEvents  *prometheus.CounterVec
+	dgpsStation          *prometheus.GaugeVec
+	dopBreach            *prometheus.GaugeVec
+	oscDisciplined       *prometheus.GaugeVec
+	oscHoldover          *prometheus.GaugeVec
+	oscDelta             prometheus.Histogram
+	fixReacquisition     prometheus.Histogram
+	parseDuration        *prometheus.HistogramVec
+	pollSize             prometheus.Histogram
+	lastPulse            float64                          // PPS pulse last observed in ppsOffset
+	parseObservers       map[string]prometheus.Observer   // Children of parseDuration by class, created up front
+	pollClassPresent     map[string]prometheus.Gauge      // Children of pollPresent by class, created up front
+	lastReports          map[reportKey]string             // Time of the last counted report by class and device
+	reportCounters       map[reportKey]prometheus.Counter // Children of reports already looked up
+	exemplar             prometheus.Labels                // Reused for the exemplars of counted reports and PPS offsets
+	minimal              minimalMetrics                   // Fixed metrics of -profile minimal, nil with the full profile
+
+	mu             sync.Mutex
+	protocol       gpsdProtocol         // Negotiated from the VERSION message on connect
+	identity       string               // Release and revision from the last VERSION message
+	devices        []string             // Device paths from the last DEVICES message
+	inventoried    bool                 // Whether a DEVICES message has been received, so the next ones are diffed against devices
+	watch          WATCH                // Watcher policy acknowledged by gpsd
+	pendingConfigs map[string]bool      // Devices sent a ?DEVICE command without a reply yet
+	conn           connectionState      // Connection to the source, for /debug/connections
+	handshake      time.Time            // When the VERSION banner of the current connection arrived
+	activated      map[string]time.Time // When gpsd activated each active device
+	speeds         map[string]float64   // Speed gpsd last reported for each serial device
+	unknown        map[string]bool      // Unknown classes and fields already logged by -strict
+
+	// Metrics created on demand from gpsd reports, guarded by reportMu so stale ones can be expired
+	reportMu       sync.Mutex
+	gauges         map[string]prometheus.Gauge
+	gaugeVecs      map[string]*prometheus.GaugeVec
+	children       map[seriesKey]prometheus.Gauge    // Children of gauge vectors looked up by series
+	lastSeen       map[string]time.Time              // When a new report of each class was last received
+	latest         map[string]any                    // Latest report of each class as exported, for the SNMP agent
+	motion         map[string]*motionState           // Movement of each device
+	fixes          map[string]*fixState              // Whether each device has a fix, and since when it hasn't
+	satellites     map[string]*satVisibility         // Satellites in the latest SKY report by PRN
+	satSnapshot    *satelliteSnapshot                // Per-satellite metrics, published once per SKY report
+	derived        map[string][]*prometheus.GaugeVec // Gauges derived from the reports of each class, expired and reset along with its fields
+	constellations map[string]*constellationStats    // Satellites of each constellation visible in the latest SKY report
+	reference      referenceState                    // Position of a static antenna to measure drift from
+	smoothers      map[string]*smoother              // Smoothing filters of each device
+	dopBreached    map[string]bool                   // Whether each DOP with a threshold was above it in the latest SKY report
+	dgps           map[string]*dgpsState             // Differential corrections of each device that has reported them
+	oscillators    map[string]*oscState              // Discipline of each device's oscillator
+	qErrSamples    map[string][]qErrSample           // PPS quantization errors of each device over -pps.qerr-window
+	sectors        map[string]*sectorState           // Used satellites by azimuth sector of each device over -sky.sector-window
+	history        map[string][]historyPoint         // Fixes of each device within -history.retention, oldest first
+	pulses         map[string]float64                // Latest PPS pulse of each device with -pps.watch
+	offsets        map[string]*clockOffsets          // Latest clock offsets of each device from PPS and TOFF
+	movingBases    map[string]bool                   // Devices that reported a moving-base heading
+	drift          map[string][]driftSample          // TOFF offsets of each device over -toff.drift-window since the last step
+	anomalies      map[string]*anomalyState          // Previous fix of each device checked for anomalies
+	labelValues    map[string]map[string]bool        // Values of the device and prn labels admitted under their limits
+	overflowWarned map[string]bool                   // Labels whose limit has been logged as exceeded
+	connected      time.Time                         // When the source was last connected, for the reacquisition time
+	trips          []*trip                           // Recently completed trips, oldest first
+	pollInterval   time.Duration                     // Current interval between polls of gpsd, zero for sources that aren't polled
+}
+
+// newExporter creates an exporter for target that registers its metrics with reg
+func newExporter(target string, reg prometheus.Registerer) *exporter {
+	exported := reg
+	if *profile == "minimal" {
+		reg = prometheus.NewRegistry() // Only the fixed set registered with exported below is exported
+	}
+	factory := promauto.With(reg)
+	lastPollName := "gpsd_last_poll_timestamp_seconds"
+	if *legacyNames {
+		lastPollName = "gpsd_last_poll"
+	}
+	e := &exporter{
+		target:  target,
+		reg:     reg,
+		factory: factory,
+		lastPoll: factory.NewGauge(prometheus.GaugeOpts{
+			Name: lastPollName,
+			Help: "Last time the GPSD daemon was polled",
+		}),
+		up: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_up",
+			Help: "Whether the exporter is connected to gpsd",
+		}),
+		connectionInfo: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_connection_info",
+			Help: "Remote address of the current gpsd connection",
+		}, []string{"address"}),
+		version: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_version",
+			Help: "GPSD version",
+		}, []string{"version", "rev"}),
+		restarts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_restarts_total",
+			Help: "Number of times gpsd reported a different release or revision after reconnecting",
+		}),
+		reconnects: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_exporter_reconnects_total",
+			Help: "Number of times the connection to gpsd was re-established after being lost",
+		}),
+		stalls: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_exporter_stalls_total",
+			Help: "Number of reconnections because no gpsd report was parsed within the stall timeout",
+		}),
+		droppedLines: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_exporter_dropped_lines_total",
+			Help: "Number of lines from gpsd dropped because the parse queue was full",
+		}),
+		malformedLines: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_exporter_malformed_lines_total",
+			Help: "Number of oversized lines and line fragments from gpsd discarded before parsing",
+		}, []string{"reason"}),
+		taskUp: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_exporter_task_up",
+			Help: "Whether a task of the source is running, 0 while it waits to be restarted after a panic or error",
+		}, []string{"task"}),
+		taskPanics: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_exporter_task_panics_total",
+			Help: "Number of times a task of the source panicked and was restarted",
+		}, []string{"task"}),
+		timeParseErrors: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_exporter_time_parse_errors_total",
+			Help: "Number of report timestamps that couldn't be parsed",
+		}),
+		cardinalityOverflows: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_exporter_cardinality_overflows_total",
+			Help: "Number of label values dropped for exceeding -metrics.max-devices or -metrics.max-satellites",
+		}, []string{"label"}),
+		unknownFields: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_exporter_unknown_fields_total",
+			Help: "Number of unknown classes and fields received from gpsd, counted with -strict",
+		}, []string{"class"}),
+		protoMajor: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_proto_major",
+			Help: "Major version of the gpsd JSON protocol",
+		}),
+		protoMinor: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_proto_minor",
+			Help: "Minor version of the gpsd JSON protocol",
+		}),
+		reports: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_reports_total",
+			Help: "Number of reports parsed from gpsd",
+		}, []string{"class", "device"}),
+		watchEnabled: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_watch_enabled",
+			Help: "Whether gpsd acknowledged watcher mode for the connection",
+		}),
+		devicesAdded: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_device_added_total",
+			Help: "Number of times the device appeared in gpsd's device list",
+		}, []string{"device"}),
+		devicesRemoved: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_device_removed_total",
+			Help: "Number of times the device disappeared from gpsd's device list",
+		}, []string{"device"}),
+		receiverInfo: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_receiver_info",
+			Help: "Receiver gpsd identified behind the device, named by its driver and the first field of its subtype",
+		}, []string{"device", "receiver", "driver", "subtype"}),
+		deviceBPS: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_bps",
+			Help: "Speed gpsd talks to the serial device at in bits per second",
+		}, []string{"device"}),
+		bpsChanges: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_device_bps_changes_total",
+			Help: "Number of times gpsd changed the speed of the serial device, as it does while hunting for a speed it can decode",
+		}, []string{"device"}),
+		packetsRecognized: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_packets_recognized",
+			Help: "Whether gpsd has recognized GPS, RTCM or AIS packets from the device",
+		}, []string{"device"}),
+		errors: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_errors_total",
+			Help: "Number of ERROR messages from gpsd by the device they name, empty for those naming none",
+		}, []string{"device"}),
+		deviceWatched: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_watched",
+			Help: "Whether gpsd is sending reports from the device to the exporter",
+		}, []string{"device"}),
+		deviceConfigAccepted: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_config_accepted",
+			Help: "Whether gpsd applied the configuration requested with -gpsd.device-config",
+		}, []string{"device"}),
+		distance: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_distance_traveled_meters_total",
+			Help: "Distance traveled by the device, ignoring position noise and jumps during bad fixes",
+		}, []string{"device"}),
+		averageLat: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_position_avg_lat",
+			Help: "Latitude averaged over the poll interval or -position.average-window, weighted by the horizontal error estimate",
+		}, []string{"device"}),
+		averageLon: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_position_avg_lon",
+			Help: "Longitude averaged over the poll interval or -position.average-window, weighted by the horizontal error estimate",
+		}, []string{"device"}),
+		averageAlt: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_position_avg_alt",
+			Help: "MSL altitude of 3D fixes averaged over the poll interval or -position.average-window, weighted by the vertical error estimate",
+		}, []string{"device"}),
+		referenceLearning: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_reference_learned_ratio",
+			Help: "Fraction of -reference.auto elapsed while learning the reference position, 1 once it's known",
+		}),
+		referenceDistance: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_reference_distance_meters",
+			Help: "Horizontal distance of the latest fix from the reference position",
+		}, []string{"device"}),
+		referenceDrift: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_reference_drift_meters",
+			Help: "Horizontal distance of the average position from the reference position",
+		}, []string{"device"}),
+		referenceVertical: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_reference_vertical_offset_meters",
+			Help: "MSL altitude of the latest 3D fix minus the reference altitude",
+		}, []string{"device"}),
+		velocity3D: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_velocity_3d_mps",
+			Help: "Magnitude of the device's velocity including its vertical component",
+		}, []string{"device"}),
+		climbSmoothed: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_climb_smoothed_mps",
+			Help: "Climb rate averaged over the latest 3D fixes",
+		}, []string{"device"}),
+		moving: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_moving",
+			Help: "Whether the device is moving, with hysteresis between the moving and stationary speeds",
+		}, []string{"device"}),
+		stationaryDuration: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_stationary_duration_seconds",
+			Help: "How long the device has been stationary, zero while moving",
+		}, []string{"device"}),
+		movingBaseHeading: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_moving_base_heading_degrees",
+			Help: "Heading from true north measured along the baseline from the moving base antenna, with -gpsd.heading",
+		}, []string{"device"}),
+		baselineValid: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_moving_base_heading_baseline_valid",
+			Help: "Whether the baseline to the moving base antenna has a fixed carrier phase solution, with -gpsd.heading",
+		}, []string{"device"}),
+		baselineLength: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_moving_base_heading_baseline_length_meters",
+			Help: "Length of the baseline to the moving base antenna, with -gpsd.heading",
+		}, []string{"device"}),
+		headingDeviation: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_heading_deviation_degrees",
+			Help: "Magnetic track minus true track, which should match the magnetic variation",
+		}, []string{"device"}),
+		headingInconsistent: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_heading_inconsistent",
+			Help: "Whether the heading deviation differs from the magnetic variation by more than -heading.tolerance",
+		}, []string{"device"}),
+		maxSpeed: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_session_max_speed_meters_per_second",
+			Help: "Highest speed reported since the exporter started or the maxima were reset",
+		}, []string{"device"}),
+		maxAltitude: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_session_max_altitude_meters",
+			Help: "Highest MSL altitude of a 3D fix since the exporter started or the maxima were reset",
+		}, []string{"device"}),
+		tripActive: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_trip_active",
+			Help: "Whether the device is on a trip",
+		}, []string{"device"}),
+		tripsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_trips_total",
+			Help: "Number of completed trips",
+		}, []string{"device"}),
+		tripDistance: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_trip_distance_meters",
+			Help: "Distance traveled on the current trip, zero when stopped",
+		}, []string{"device"}),
+		tripDuration: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_trip_duration_seconds",
+			Help: "Duration of the current trip, zero when stopped",
+		}, []string{"device"}),
+		pollActive: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_poll_active_devices",
+			Help: "Number of active devices in the last POLL response",
+		}),
+		pollIntervalSeconds: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_poll_interval_seconds",
+			Help: "Current interval between polls of gpsd, which changes with the motion of the devices with -poll.adaptive",
+		}),
+		pollPresent: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_poll_class_present",
+			Help: "Whether the last POLL response contained any reports of the class",
+		}, []string{"class"}),
+		ppsOffset: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_pps_offset_seconds",
+			Help:    "Offset of the system clock from each PPS pulse",
+			Buckets: []float64{-1e-3, -1e-4, -1e-5, -1e-6, -1e-7, 0, 1e-7, 1e-6, 1e-5, 1e-4, 1e-3},
+		})),
+		qErr: factory.NewHistogramVec(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_pps_qerr_seconds",
+			Help:    "Quantization (sawtooth) error the receiver reported for each PPS pulse",
+			Buckets: []float64{-5e-8, -2e-8, -1e-8, -5e-9, -2e-9, -1e-9, 0, 1e-9, 2e-9, 5e-9, 1e-8, 2e-8, 5e-8},
+		}), []string{"device"}),
+		qErrRMS: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_pps_qerr_rms_seconds",
+			Help: "Root mean square of the PPS quantization errors over -pps.qerr-window",
+		}, []string{"device"}),
+		pulseInterval: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_pps_interval_seconds",
+			Help: "Time between the latest two PPS pulses with -pps.watch",
+		}, []string{"device"}),
+		missingPulses: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_pps_missing_pulses_total",
+			Help: "Number of PPS pulses missing from the expected -pps.interval cadence with -pps.watch",
+		}, []string{"device"}),
+		offsetDisagreement: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_pps_toff_disagreement_seconds",
+			Help: "System clock offset implied by the latest TOFF report minus the one implied by the latest PPS report",
+		}, []string{"device"}),
+		clockFrequencyError: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_system_clock_frequency_error_ppm",
+			Help: "Frequency error of the system clock estimated from the trend of its TOFF offsets over -toff.drift-window, positive when it runs fast",
+		}, []string{"device"}),
+		clockSteps: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_system_clock_steps_total",
+			Help: "Number of times the TOFF offset of the system clock departed from its trend by more than -toff.step-threshold",
+		}, []string{"device"}),
+		deviceDOP: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_dop",
+			Help: "Dilution of precision (gdop, hdop, pdop, tdop, vdop, xdop, or ydop) in the latest SKY report of the device",
+		}, []string{"device", "dop"}),
+		snrMin: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_snr_min_dbhz",
+			Help: "Lowest signal strength of the satellites used in the latest SKY report of the device",
+		}, []string{"device"}),
+		snrMax: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_snr_max_dbhz",
+			Help: "Highest signal strength of the satellites used in the latest SKY report of the device",
+		}, []string{"device"}),
+		snrMean: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_snr_mean_dbhz",
+			Help: "Mean signal strength of the satellites used in the latest SKY report of the device",
+		}, []string{"device"}),
+		skySectorUsed: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_sky_sector_used_satellites",
+			Help: "Satellites used in the solution in the 30 degree azimuth sector starting at the sector label, averaged over -sky.sector-window",
+		}, []string{"device", "sector"}),
+		deviceQuality: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_device_quality",
+			Help: "Quality indicator in the latest SKY report of the device",
+		}, []string{"device"}),
+		signalQuality: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_signal_quality",
+			Help: "Whether the quality indicator of the device is at the level (no_signal, searching, acquired, unusable, code_locked, or carrier_locked)",
+		}, []string{"device", "level"}),
+		anomalyDetected: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_anomaly_detected",
+			Help: "Whether the latest fix jumped implausibly from the previous one (position_jump or time_jump), a possible sign of spoofing",
+		}, []string{"device", "type"}),
+		anomalyCounts: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_anomalies_total",
+			Help: "Number of fixes that jumped implausibly from the previous one (position_jump or time_jump)",
+		}, []string{"device", "type"}),
+		snr: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_sky_snr_dbhz",
+			Help:    "Signal to noise ratio of each satellite in a SKY report",
+			Buckets: prometheus.LinearBuckets(10, 5, 9),
+		})),
+		satAppearances: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_sat_appearances_total",
+			Help: "Number of times the satellite became visible after being absent from SKY reports",
+		}, []string{"prn"}),
+		dopBreaches: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_dop_threshold_breaches_total",
+			Help: "Number of times the dilution of precision rose above its -dop.threshold",
+		}, []string{"dop"}),
+		dopBreach: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_dop_threshold_breached",
+			Help: "Whether the dilution of precision is above its -dop.threshold",
+		}, []string{"dop"}),
+		ephSummary: errorSummary(factory, "gpsd_horizontal_error_estimate_meters", "Quantiles of the estimated horizontal position error over -metrics.error-window"),
+		epvSummary: errorSummary(factory, "gpsd_vertical_error_estimate_meters", "Quantiles of the estimated vertical position error over -metrics.error-window"),
+		sepSummary: errorSummary(factory, "gpsd_spherical_error_estimate_meters", "Quantiles of the estimated spherical position error over -metrics.error-window"),
+		antennaStatus: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_antenna_status",
+			Help: "Whether the receiver reports the antenna in the state (ok, open, or short)",
+		}, []string{"device", "state"}),
+		dgpsStale: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_dgps_corrections_stale",
+			Help: "Whether the DGPS corrections of the latest fix are older than -dgps.max-age or missing",
+		}, []string{"device"}),
+		dgpsStalenessEvents: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_dgps_staleness_events_total",
+			Help: "Number of times the DGPS corrections went stale",
+		}, []string{"device"}),
+		dgpsStation: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_dgps_station_info",
+			Help: "Station of the latest DGPS corrections",
+		}, []string{"device", "station"}),
+		oscDisciplined: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_osc_disciplined_duration_seconds",
+			Help: "How long the oscillator has been disciplined by the GPS PPS signal, zero while it isn't",
+		}, []string{"device"}),
+		oscHoldover: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_osc_holdover_duration_seconds",
+			Help: "How long the running oscillator has been in holdover since it was last disciplined, zero while disciplined",
+		}, []string{"device"}),
+		oscDelta: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_osc_delta_magnitude_seconds",
+			Help:    "Absolute time difference between the oscillator PPS output and the GPS PPS input in each OSC report",
+			Buckets: prometheus.ExponentialBuckets(1e-9, 4, 12),
+		})),
+		fixLosses: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "gpsd_fix_losses_total",
+			Help: "Number of times the device lost its fix",
+		}, []string{"device"}),
+		fixOutage: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_fix_outage_duration_seconds",
+			Help:    "How long a device went without a fix each time it lost one",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+		})),
+		fixReacquisition: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_fix_reacquisition_seconds",
+			Help:    "Time from connecting to the source until each device's first fix",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		})),
+		parseDuration: factory.NewHistogramVec(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_exporter_parse_duration_seconds",
+			Help:    "Time taken to parse and process each message from gpsd",
+			Buckets: prometheus.ExponentialBuckets(1e-5, 4, 8),
+		}), []string{"class"}),
+		pollSize: factory.NewHistogram(histogramOpts(prometheus.HistogramOpts{
+			Name:    "gpsd_poll_response_bytes",
+			Help:    "Size of each POLL response from gpsd",
+			Buckets: prometheus.ExponentialBuckets(256, 2, 10),
+		})),
+		lastReports:    map[reportKey]string{},
+		reportCounters: map[reportKey]prometheus.Counter{},
+		exemplar:       prometheus.Labels{},
+		pendingConfigs: map[string]bool{},
+		speeds:         map[string]float64{},
+		activated:      map[string]time.Time{},
+		unknown:        map[string]bool{},
+		gauges:         map[string]prometheus.Gauge{},
+		gaugeVecs:      map[string]*prometheus.GaugeVec{},
+		children:       map[seriesKey]prometheus.Gauge{},
+		lastSeen:       map[string]time.Time{},
+		latest:         map[string]any{},
+		motion:         map[string]*motionState{},
+		fixes:          map[string]*fixState{},
+		satellites:     map[string]*satVisibility{},
+		satSnapshot:    newSatelliteSnapshot(),
+		constellations: map[string]*constellationStats{},
+		dopBreached:    map[string]bool{},
+		dgps:           map[string]*dgpsState{},
+		oscillators:    map[string]*oscState{},
+		qErrSamples:    map[string][]qErrSample{},
+		sectors:        map[string]*sectorState{},
+		history:        map[string][]historyPoint{},
+		pulses:         map[string]float64{},
+		offsets:        map[string]*clockOffsets{},
+		movingBases:    map[string]bool{},
+		drift:          map[string][]driftSample{},
+		anomalies:      map[string]*anomalyState{},
+		labelValues:    map[string]map[string]bool{},
+		overflowWarned: map[string]bool{},
+		smoothers:      map[string]*smoother{},
+	}
+	if *satelliteMetrics == "off" {
+		reg.Unregister(e.snr)
+	}
+	if *profile == "minimal" {
+		e.minimal = newMinimalMetrics(exported)
+		exported.MustRegister(e.up, e.ppsOffset)
+	}
+	// Children looked up for every message are created once, which also exports them before their first observation
+	e.parseObservers = map[string]prometheus.Observer{"other": e.parseDuration.WithLabelValues("other")}
+	for class := range parsedClasses {
+		class = strings.ToLower(class)
+		e.parseObservers[class] = e.parseDuration.WithLabelValues(class)
+	}
+	for _, reason := range []string{"oversized", "fragment"} {
+		e.malformedLines.WithLabelValues(reason)
+	}
+	e.pollClassPresent = map[string]prometheus.Gauge{}
+	for _, class := range pollClasses {
+		e.pollClassPresent[class] = e.pollPresent.WithLabelValues(class)
+	}
+	e.derived = map[string][]*prometheus.GaugeVec{
+		"tpv": {
+			e.averageLat, e.averageLon, e.averageAlt, e.referenceDistance, e.referenceDrift, e.referenceVertical,
+			e.velocity3D, e.climbSmoothed, e.moving, e.stationaryDuration, e.headingDeviation, e.headingInconsistent,
+			e.antennaStatus, e.dgpsStale, e.dgpsStation, e.anomalyDetected, e.baselineValid, e.baselineLength,
+		},
+		"sky":  {e.deviceDOP, e.dopBreach, e.skySectorUsed, e.snrMin, e.snrMax, e.snrMean, e.deviceQuality, e.signalQuality},
+		"pps":  {e.pulseInterval, e.qErrRMS, e.offsetDisagreement},
+		"toff": {e.offsetDisagreement, e.clockFrequencyError},
+		"osc":  {e.oscDisciplined, e.oscHoldover},
+		"att":  {e.movingBaseHeading},
+	}
+	reg.MustRegister(uptimeCollector{e})
+	reg.MustRegister(e.satSnapshot)
+	return e
+}
+
+// setLastPoll records the time of the last POLL command, in milliseconds for legacy names
+// setPollInterval records the current interval between polls of gpsd, which varies with -poll.adaptive
+func (e *exporter) setPollInterval(d time.Duration) {
+	e.pollIntervalSeconds.Set(d.Seconds())
+	e.reportMu.Lock()
+	e.pollInterval = d
+	e.reportMu.Unlock()
+}
+
+func (e *exporter) setLastPoll(t time.Time) {
+	if *legacyNames {
+		e.lastPoll.Set(float64(t.UnixNano() / 1000000))
+	} else {
+		e.lastPoll.Set(float64(t.UnixNano()) / 1e9)
+	}
+}
+
+// reportKey identifies the reports of a class from a device
+type reportKey struct {
+	class, device string
+}
+
+// countReport counts a parsed report, attaching its device and time as an exemplar for OpenMetrics scrapes.
+// POLL responses repeat the latest report of each device until a new one arrives, so reports already counted are skipped and false is returned.
+func (e *exporter) countReport(class string, report any) bool {
+	key := reportKey{class, reportDevice(report)}
+	t := reportTime(report)
+	if t != "" {
+		if e.lastReports[key] == t {
+			return false
+		}
+		e.lastReports[key] = t
+	}
+
+	counter, ok := e.reportCounters[key]
+	if !ok {
+		counter = e.reports.WithLabelValues(class, key.device)
+		e.reportCounters[key] = counter
+	}
+	setExemplar(e.exemplar, key.device, t)
+	if len(e.exemplar) > 0 {
+		counter.(prometheus.ExemplarAdder).AddWithExemplar(1, e.exemplar) // Copied, so the labels can be reused
+	} else {
+		counter.Inc()
+	}
+	return true
+}
+
+// setExemplar replaces labels with the device and time of a report, truncated to the runes client_golang allows in an exemplar,
+// beyond which it panics. Times are at most 35 runes, so the device gets the rest.
+func setExemplar(labels prometheus.Labels, device, t string) {
+	for label := range labels {
+		delete(labels, label)
+	}
+	budget := prometheus.ExemplarMaxRunes
+	if t != "" {
+		labels["time"] = truncateRunes(t, 35)
+		budget -= len("time") + utf8.RuneCountInString(labels["time"])
+	}
+	if device != "" {
+		labels["device"] = truncateRunes(device, budget-len("device"))
+	}
+}
+
+// truncateRunes returns the first n runes of s
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// freshnessNames are the names of the freshness gauge vectors of the classes gpsd streams, built once rather than for each report
+var freshnessNames = classMetricNames("gpsd_last_%s_timestamp_seconds")
+
+// classMetricNames formats the name of a per-class metric for each class gpsd streams
+func classMetricNames(format string) map[string]string {
+	names := map[string]string{}
+	for class := range streamedReports {
+		class = strings.ToLower(class)
+		names[class] = fmt.Sprintf(format, class)
+	}
+	return names
+}
+
+// updateFreshness records when the exporter received a new report from a device
+func (e *exporter) updateFreshness(class string, report any) {
+	key, ok := freshnessNames[class]
+	if !ok {
+		key = fmt.Sprintf("gpsd_last_%s_timestamp_seconds", class)
+	}
+	if _, exists := e.gaugeVecs[key]; !exists {
+		e.gaugeVecs[key] = e.factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: key,
+			Help: fmt.Sprintf("Time the exporter received the latest new %s report from the device", strings.ToUpper(class)),
+		}, []string{"device"})
+	}
+	e.series(e.gaugeVecs[key], reportDevice(report)).SetToCurrentTime()
+}
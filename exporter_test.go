@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSetExemplar(t *testing.T) {
+	for _, tt := range []struct {
+		name, device, time string
+		wantDevice         string
+	}{
+		{"short", "/dev/ttyACM0", "2024-06-01T12:00:00.000Z", "/dev/ttyACM0"},
+		{"no time", "/dev/ttyACM0", "", "/dev/ttyACM0"},
+		{"long device", strings.Repeat("d", 200), "2024-06-01T12:00:00.000Z", strings.Repeat("d", 94)},
+		{"long multibyte device", strings.Repeat("é", 200), "2024-06-01T12:00:00.000Z", strings.Repeat("é", 94)},
+		{"long time", "/dev/ttyACM0", strings.Repeat("t", 200), "/dev/ttyACM0"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := prometheus.Labels{"stale": "label"}
+			setExemplar(labels, tt.device, tt.time)
+			runes := 0
+			for name, value := range labels {
+				runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+			}
+			if runes > prometheus.ExemplarMaxRunes || labels["device"] != tt.wantDevice || labels["stale"] != "" {
+				t.Errorf("got %d runes in %v", runes, labels)
+			}
+			// Panics if the labels are invalid
+			prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total"}).(prometheus.ExemplarAdder).AddWithExemplar(1, labels)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// targetGroup is a group of gpsd targets sharing labels, as in Prometheus file_sd files
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+// parseTargetGroups returns the targets of groups by key. Targets take the same addr[@interval] form as -d,
+// and labels starting with __ are dropped as Prometheus does.
+func parseTargetGroups(groups []targetGroup) (map[string]discoveredTarget, error) {
+	targets := map[string]discoveredTarget{}
+	for _, g := range groups {
+		labels := prometheus.Labels{}
+		for name, value := range g.Labels {
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+			if !model.LabelName(name).IsValid() || name == "target" {
+				return nil, fmt.Errorf("invalid label name %q", name)
+			}
+			labels[name] = value
+		}
+		for _, addr := range g.Targets {
+			var parsed targetsFlag
+			if err := parsed.Set(addr); err != nil {
+				return nil, err
+			}
+			t := newDiscoveredTarget(parsed[0], labels)
+			targets[t.key()] = t
+		}
+	}
+	return targets, nil
+}
+
+// readTargetsFile reads the targets of a JSON or YAML file in file_sd format
+func readTargetsFile(path string) (map[string]discoveredTarget, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []targetGroup
+	if err := yaml.UnmarshalStrict(b, &groups); err != nil {
+		return nil, err
+	}
+	return parseTargetGroups(groups)
+}
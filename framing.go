@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// classKey starts the first key of every gpsd message, found to resynchronize after a fragment
+var classKey = []byte(`{"class"`)
+
+// lineReader splits a gpsd stream into JSON lines, discarding what can't be one instead of giving up on the connection:
+// lines longer than -gpsd.max-line-length, and fragments such as those left by a connection cut mid-line
+type lineReader struct {
+	r *bufio.Reader
+	e *exporter
+}
+
+func newLineReader(r io.Reader, e *exporter) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, *maxLineLength), e: e}
+}
+
+// next returns the next line that looks like a JSON object, or the error that ended the stream
+func (l *lineReader) next() (string, error) {
+	for {
+		line, err := l.r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			l.e.malformedLines.WithLabelValues("oversized").Inc()
+			for errors.Is(err, bufio.ErrBufferFull) { // Resynchronize on the next newline
+				_, err = l.r.ReadSlice('\n')
+			}
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		line = bytes.TrimSpace(line)
+		if err != nil {
+			if len(line) > 0 {
+				l.e.malformedLines.WithLabelValues("fragment").Inc() // Cut off by the end of the stream
+			}
+			return "", err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != '{' {
+			// The tail of a line whose start was lost, possibly followed by a whole message
+			l.e.malformedLines.WithLabelValues("fragment").Inc()
+			i := bytes.Index(line, classKey)
+			if i < 0 {
+				continue
+			}
+			line = line[i:]
+		}
+		if line[len(line)-1] != '}' {
+			l.e.malformedLines.WithLabelValues("fragment").Inc()
+			continue
+		}
+		return string(line), nil
+	}
+}
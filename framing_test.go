@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLineReader(t *testing.T) {
+	tpv := `{"class":"TPV","mode":3}`
+	long := `{"class":"SKY","satellites":[` + strings.Repeat(`{"PRN":1},`, 10) + `{"PRN":2}]}`
+	for _, tt := range []struct {
+		name       string
+		stream     string
+		lines      []string
+		oversized  float64
+		fragments  float64
+		lineLength int
+	}{
+		{name: "lines", stream: tpv + "\n" + tpv + "\r\n", lines: []string{tpv, tpv}},
+		{name: "blank lines", stream: "\n  \n" + tpv + "\n\n", lines: []string{tpv}},
+		{name: "cut at the end", stream: tpv + "\n" + `{"class":"TP`, lines: []string{tpv}, fragments: 1},
+		{name: "unterminated at the end", stream: tpv, fragments: 1},
+		{name: "lost start", stream: `e":3}` + "\n" + tpv + "\n", lines: []string{tpv}, fragments: 1},
+		{name: "lost start before a message", stream: `e":3}` + tpv + "\n", lines: []string{tpv}, fragments: 1},
+		{name: "lost end", stream: `{"class":"TPV","mo` + "\n" + tpv + "\n", lines: []string{tpv}, fragments: 1},
+		{name: "not JSON", stream: "GPSD 3.25\n" + tpv + "\n", lines: []string{tpv}, fragments: 1},
+		{name: "oversized", stream: long + "\n" + tpv + "\n", lines: []string{tpv}, oversized: 1, lineLength: 64},
+		{name: "oversized at the end", stream: tpv + "\n" + long, lines: []string{tpv}, oversized: 1, lineLength: 64},
+		{name: "within the limit", stream: long + "\n", lines: []string{long}, lineLength: 256},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.lineLength > 0 {
+				defer func(length int) { *maxLineLength = length }(*maxLineLength)
+				*maxLineLength = tt.lineLength
+			}
+			e := newExporter("localhost:2947", prometheus.NewRegistry())
+			r := newLineReader(strings.NewReader(tt.stream), e)
+			var lines []string
+			for {
+				line, err := r.next()
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						t.Fatal(err)
+					}
+					break
+				}
+				lines = append(lines, line)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("got lines %q, want %q", lines, tt.lines)
+			}
+			oversized := testutil.ToFloat64(e.malformedLines.WithLabelValues("oversized"))
+			fragments := testutil.ToFloat64(e.malformedLines.WithLabelValues("fragment"))
+			if oversized != tt.oversized || fragments != tt.fragments {
+				t.Errorf("counted %v oversized and %v fragments, want %v and %v", oversized, fragments, tt.oversized, tt.fragments)
+			}
+		})
+	}
+}
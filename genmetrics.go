@@ -0,0 +1,143 @@
+//go:build ignore
+
+// genmetrics generates typed functions updating the metrics of each gpsd report from its struct definition in gpsd.go,
+// so reports don't have to be walked with reflection. The json and description struct tags remain the source of truth.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// reports are the report structs to generate update functions for, with their metric namespace
+var reports = []struct{ typ, namespace string }{
+	{"TPV", "tpv"},
+	{"SKY", "sky"},
+	{"GST", "gst"},
+	{"PPS", "pps"},
+	{"TOFF", "toff"},
+	{"OSC", "osc"},
+	{"ATT", "att"},
+	{"Satellite", "sat"},
+}
+
+func main() {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "gpsd.go", nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	structs := map[string]*ast.StructType{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok {
+			if s, ok := spec.Type.(*ast.StructType); ok {
+				structs[spec.Name.Name] = s
+			}
+		}
+		return true
+	})
+
+	var vars, funcs bytes.Buffer
+	for _, r := range reports {
+		s, ok := structs[r.typ]
+		if !ok {
+			log.Fatalf("struct %s not found in gpsd.go", r.typ)
+		}
+		receiver := "r"
+		if r.namespace == "sat" {
+			fmt.Fprintf(&funcs, "\n// update%s updates the metrics of a %s, labeled with its PRN\n", r.typ, r.typ)
+			fmt.Fprintf(&funcs, "func (e *exporter) update%s(%s *%s) {\n", r.typ, receiver, r.typ)
+			fmt.Fprintf(&funcs, "prn := prnLabel(%s.PRN)\n", receiver)
+		} else {
+			fmt.Fprintf(&funcs, "\n// update%s updates the metrics of a %s report\n", r.typ, r.typ)
+			fmt.Fprintf(&funcs, "func (e *exporter) update%s(%s *%s) {\n", r.typ, receiver, r.typ)
+		}
+		for _, field := range s.Fields.List {
+			if field.Tag == nil || len(field.Names) != 1 {
+				continue
+			}
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			st := reflect.StructTag(tag)
+			jsonField := strings.Split(st.Get("json"), ",")[0]
+			if jsonField == "" || jsonField == "-" || st.Get("metric") == "-" {
+				continue
+			}
+			name := field.Names[0].Name
+			v := "field" + r.typ + name
+			value := receiver + "." + name
+			namespace := r.namespace
+			if ns := st.Get("namespace"); ns != "" {
+				namespace = ns
+			}
+
+			var call string
+			switch t := field.Type.(type) {
+			case *ast.Ident:
+				switch {
+				case t.Name == "float64" && r.namespace == "sat":
+					call = fmt.Sprintf("e.setSatelliteGauge(%s, prn, %s)", v, value)
+				case t.Name == "bool" && r.namespace == "sat":
+					call = fmt.Sprintf("e.setSatelliteGauge(%s, prn, boolValue(%s))", v, value)
+				case t.Name == "float64":
+					call = fmt.Sprintf("e.setFieldGauge(%s, %s)", v, value)
+				case t.Name == "bool":
+					call = fmt.Sprintf("e.setFieldGauge(%s, boolValue(%s))", v, value)
+				case t.Name == "string" && jsonField == "time":
+					call = fmt.Sprintf("e.setFieldTime(%s, %s)", v, value)
+				case t.Name == "string":
+					continue // Only timestamps are exported from strings
+				default:
+					log.Fatalf("unsupported type %s of %s.%s", t.Name, r.typ, name)
+				}
+			case *ast.StarExpr:
+				// Optional fields are only exported once a device reports them
+				if elem, ok := t.X.(*ast.Ident); !ok || elem.Name != "float64" || r.namespace == "sat" {
+					log.Fatalf("unsupported pointer type of %s.%s", r.typ, name)
+				}
+				call = fmt.Sprintf("if %s != nil {\ne.setFieldGauge(%s, *%s)\n}", value, v, value)
+			case *ast.ArrayType:
+				elem, ok := t.Elt.(*ast.Ident)
+				if !ok {
+					log.Fatalf("unsupported slice type of %s.%s", r.typ, name)
+				}
+				fmt.Fprintf(&funcs, "e.update%ss(%s)\n", elem.Name, value)
+				continue
+			default:
+				log.Fatalf("unsupported type of %s.%s", r.typ, name)
+			}
+			if st.Get("metric") == "legacy" {
+				// Superseded by a metric derived from the field, but kept under the legacy names
+				call = fmt.Sprintf("if *legacyNames {\n%s\n}", call)
+			}
+			fmt.Fprintf(&vars, "%s = &reportField{namespace: %q, field: %q, description: %q}\n", v, namespace, jsonField, st.Get("description"))
+			fmt.Fprintln(&funcs, call)
+		}
+		fmt.Fprintln(&funcs, "}")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "// Code generated by go run genmetrics.go; DO NOT EDIT.")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "package main")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "// Metrics of the fields of each report")
+	fmt.Fprintf(&out, "var (\n%s)\n", vars.String())
+	out.Write(funcs.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v\n%s", err, out.String())
+	}
+	if err := os.WriteFile("metrics_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -2,63 +2,75 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
+//go:generate go run genmetrics.go
+
 // TPV represents a gpsd TPV (time-position-velocity) class (https://gpsd.io/gpsd_json.html#_tpv)
 type TPV struct {
-	Device      string  `json:"device" description:"Name of the originating device"`
-	Mode        float64 `json:"mode" description:"NMEA mode: 0=unknown, 1=no fix, 2=2D, 3=3D"`
-	Status      float64 `json:"status" description:"GPS fix status: 0=Unknown, 1=Normal, 2=DGPS, 3=RTK Fixed, 4=RTK Floating, 5=DR, 6=GNSSDR, 7=Time (surveyed), 8=Simulated, 9=P(Y)"`
-	Time        string  `json:"time" description:"Time/date stamp in ISO8601 format, UTC. May have a fractional part of up to .001sec precision. May be absent if the mode is not 2D or 3D. May be present, but invalid, if there is no fix. Verify 3 consecutive 3D fixes before believing it is UTC. Even then it may be off by several seconds until the current leap seconds is known."`
-	AltHAE      float64 `json:"altHAE" description:"Altitude, Height Above Ellipsoid, in meters. Probably WGS84."`
-	AltMSL      float64 `json:"altMSL" description:"MSL Altitude in meters. The geoid used is rarely specified and is often inaccurate. See the comments below on geoidSep. altMSL is altHAE minus geoidSep."`
-	Climb       float64 `json:"climb" description:"Climb (positive) or sink (negative) rate, meters per second."`
-	Datum       string  `json:"datum" description:"Current datum. Hopefully WGS84."`
-	Depth       float64 `json:"depth" description:"Depth in meters. Probably depth below the keel"`
-	DGPSAge     float64 `json:"dgpsAge" description:"Age of DGPS data in seconds"`
-	DGPSStation float64 `json:"dgpsSta" description:"Station of DGPS data"`
-	EPC         float64 `json:"epc" description:"Estimated climb error in meters per second. Certainty unknown."`
-	EPD         float64 `json:"epd" description:"Estimated track (direction) error in degrees. Certainty unknown."`
-	EPH         float64 `json:"eph" description:"Estimated horizontal Position (2D) Error in meters. Also known as Estimated Position Error (epe). Certainty unknown."`
-	EPS         float64 `json:"eps" description:"Estimated speed error in meters per second. Certainty unknown."`
-	EPT         float64 `json:"ept" description:"Estimated time stamp error in seconds. Certainty unknown."`
-	EPX         float64 `json:"epx" description:"Longitude error estimate in meters. Certainty unknown."`
-	EPY         float64 `json:"epy" description:"Latitude error estimate in meters. Certainty unknown."`
-	EPV         float64 `json:"epv" description:"Estimated vertical error in meters. Certainty unknown."`
-	GeoidSep    float64 `json:"geoidSep" description:"Geoid separation is the difference between the WGS84 reference ellipsoid and the geoid (Mean Sea Level) in meters. Almost no GNSS receiver specifies how they compute their geoid.gpsd interpolates the geoid from a 5x5 degree table of EGM2008 values when the receiver does not supply a geoid separation.The gpsd computed geoidSep is usually within one meter of the \"true\" value, but can be off as much as 12 meters."`
-	Lat         float64 `json:"lat" description:"Latitude in degrees: +/- signifies North/South."`
-	LeapSeconds float64 `json:"leapseconds" description:"Current leap seconds."`
-	Lon         float64 `json:"lon" description:"Longitude in degrees: +/- signifies East/West."`
-	Track       float64 `json:"track" description:"Course over ground, degrees from true north."`
-	MagTrack    float64 `json:"magtrack" description:"Course over ground, degrees magnetic."`
-	MagVar      float64 `json:"magvar" description:"Magnetic variation, degrees.Also known as the magnetic declination (the direction of the horizontal component of the magnetic field measured clockwise from north) in degrees, Positive is West variation.Negative is East variation."`
-	Speed       float64 `json:"speed" description:"Speed over ground, meters per second."`
-	ECEFX       float64 `json:"ecefx" description:"ECEF X position in meters."`
-	ECEFY       float64 `json:"ecefy" description:"ECEF Y position in meters."`
-	ECEFZ       float64 `json:"ecefz" description:"ECEF Z position in meters."`
-	ECEFPAcc    float64 `json:"ecefpAcc" description:"ECEF position error in meters.Certainty unknown."`
-	ECEFVX      float64 `json:"ecefvx" description:"ECEF X velocity in meters per second."`
-	ECEFVY      float64 `json:"ecefvy" description:"ECEF Y velocity in meters per second."`
-	ECEFVZ      float64 `json:"ecefvz" description:"ECEF Z velocity in meters per second."`
-	ECEFVAcc    float64 `json:"ecefvAcc" description:"ECEF velocity error in meters per second. Certainty unknown."`
-	Sep         float64 `json:"sep" description:"Estimated Spherical (3D) Position Error in meters.Guessed to be 95% confidence, but many GNSS receivers do not specify, so certainty unknown."`
-	RelD        float64 `json:"relD" description:"Down component of relative position vector in meters."`
-	RelE        float64 `json:"relE" description:"East component of relative position vector in meters."`
-	RelN        float64 `json:"relN" description:"North component of relative position vector in meters."`
-	VelD        float64 `json:"velD" description:"Down velocity component in meters."`
-	VelE        float64 `json:"velE" description:"East velocity component in meters."`
-	VelN        float64 `json:"velN" description:"North velocity component in meters."`
-	WAngleM     float64 `json:"wanglem" description:"Wind angle magnetic in degrees."`
-	WAngleR     float64 `json:"wangler" description:"Wind angle relative in degrees."`
-	WAngleT     float64 `json:"wanglet" description:"Wind angle true in degrees."`
-	WSpeedR     float64 `json:"wspeedr" description:"Wind speed relative in meters per second."`
-	WSpeedT     float64 `json:"wspeedt" description:"Wind speed true in meters per second."`
+	Device      string   `json:"device" description:"Name of the originating device"`
+	Mode        float64  `json:"mode" description:"NMEA mode"`
+	Status      float64  `json:"status" description:"GPS fix status"`
+	Time        string   `json:"time" description:"Time/date stamp in ISO8601 format, UTC. May have a fractional part of up to .001sec precision. May be absent if the mode is not 2D or 3D. May be present, but invalid, if there is no fix. Verify 3 consecutive 3D fixes before believing it is UTC. Even then it may be off by several seconds until the current leap seconds is known."`
+	AltHAE      float64  `json:"altHAE" description:"Altitude, Height Above Ellipsoid, in meters. Probably WGS84."`
+	AltMSL      float64  `json:"altMSL" description:"MSL Altitude in meters. The geoid used is rarely specified and is often inaccurate. See the comments below on geoidSep. altMSL is altHAE minus geoidSep."`
+	Alt         float64  `json:"alt" metric:"-" description:"Altitude in meters, sent by gpsd releases before 3.20 in place of altHAE and altMSL."`
+	Climb       float64  `json:"climb" description:"Climb (positive) or sink (negative) rate, meters per second."`
+	Datum       string   `json:"datum" description:"Current datum. Hopefully WGS84."`
+	Depth       *float64 `json:"depth,omitempty" namespace:"marine" description:"Depth in meters. Probably depth below the keel"`
+	DGPSAge     float64  `json:"dgpsAge" description:"Age of DGPS data in seconds"`
+	DGPSStation float64  `json:"dgpsSta" metric:"legacy" description:"Station of DGPS data"`
+	EPC         float64  `json:"epc" description:"Estimated climb error in meters per second. Certainty unknown."`
+	EPD         float64  `json:"epd" description:"Estimated track (direction) error in degrees. Certainty unknown."`
+	EPH         float64  `json:"eph" description:"Estimated horizontal Position (2D) Error in meters. Also known as Estimated Position Error (epe). Certainty unknown."`
+	EPS         float64  `json:"eps" description:"Estimated speed error in meters per second. Certainty unknown."`
+	EPT         float64  `json:"ept" description:"Estimated time stamp error in seconds. Certainty unknown."`
+	EPX         float64  `json:"epx" description:"Longitude error estimate in meters. Certainty unknown."`
+	EPY         float64  `json:"epy" description:"Latitude error estimate in meters. Certainty unknown."`
+	EPV         float64  `json:"epv" description:"Estimated vertical error in meters. Certainty unknown."`
+	GeoidSep    float64  `json:"geoidSep" description:"Geoid separation is the difference between the WGS84 reference ellipsoid and the geoid (Mean Sea Level) in meters. Almost no GNSS receiver specifies how they compute their geoid.gpsd interpolates the geoid from a 5x5 degree table of EGM2008 values when the receiver does not supply a geoid separation.The gpsd computed geoidSep is usually within one meter of the \"true\" value, but can be off as much as 12 meters."`
+	Lat         float64  `json:"lat" description:"Latitude in degrees: +/- signifies North/South."`
+	LeapSeconds float64  `json:"leapseconds" description:"Current leap seconds."`
+	Lon         float64  `json:"lon" description:"Longitude in degrees: +/- signifies East/West."`
+	Track       float64  `json:"track" description:"Course over ground, degrees from true north."`
+	MagTrack    float64  `json:"magtrack" description:"Course over ground, degrees magnetic."`
+	MagVar      float64  `json:"magvar" description:"Magnetic variation, degrees.Also known as the magnetic declination (the direction of the horizontal component of the magnetic field measured clockwise from north) in degrees, Positive is West variation.Negative is East variation."`
+	Speed       float64  `json:"speed" description:"Speed over ground, meters per second."`
+	ECEFX       float64  `json:"ecefx" description:"ECEF X position in meters."`
+	ECEFY       float64  `json:"ecefy" description:"ECEF Y position in meters."`
+	ECEFZ       float64  `json:"ecefz" description:"ECEF Z position in meters."`
+	ECEFPAcc    float64  `json:"ecefpAcc" description:"ECEF position error in meters.Certainty unknown."`
+	ECEFVX      float64  `json:"ecefvx" description:"ECEF X velocity in meters per second."`
+	ECEFVY      float64  `json:"ecefvy" description:"ECEF Y velocity in meters per second."`
+	ECEFVZ      float64  `json:"ecefvz" description:"ECEF Z velocity in meters per second."`
+	ECEFVAcc    float64  `json:"ecefvAcc" description:"ECEF velocity error in meters per second. Certainty unknown."`
+	Sep         float64  `json:"sep" description:"Estimated Spherical (3D) Position Error in meters.Guessed to be 95% confidence, but many GNSS receivers do not specify, so certainty unknown."`
+	RelD        float64  `json:"relD" description:"Down component of relative position vector in meters."`
+	RelE        float64  `json:"relE" description:"East component of relative position vector in meters."`
+	RelN        float64  `json:"relN" description:"North component of relative position vector in meters."`
+	VelD        float64  `json:"velD" description:"Down velocity component in meters."`
+	VelE        float64  `json:"velE" description:"East velocity component in meters."`
+	VelN        float64  `json:"velN" description:"North velocity component in meters."`
+	WAngleM     *float64 `json:"wanglem,omitempty" namespace:"marine" description:"Wind angle magnetic in degrees."`
+	WAngleR     *float64 `json:"wangler,omitempty" namespace:"marine" description:"Wind angle relative in degrees."`
+	WAngleT     *float64 `json:"wanglet,omitempty" namespace:"marine" description:"Wind angle true in degrees."`
+	WSpeedR     *float64 `json:"wspeedr,omitempty" namespace:"marine" description:"Wind speed relative in meters per second."`
+	WSpeedT     *float64 `json:"wspeedt,omitempty" namespace:"marine" description:"Wind speed true in meters per second."`
+	Ant         float64  `json:"ant" description:"Antenna status reported by the receiver."`
+	Temp        float64  `json:"temp" description:"Receiver temperature in degrees Celsius."`
+	WTemp       *float64 `json:"wtemp,omitempty" namespace:"marine" description:"Water temperature in degrees Celsius."`
+	ClockBias   float64  `json:"clockbias" description:"Receiver clock bias in nanoseconds."`
+	ClockDrift  float64  `json:"clockdrift" description:"Receiver clock drift in nanoseconds per second."`
+	BaseS       float64  `json:"baseS" description:"RTK base station status."`
+	BaseL       *float64 `json:"baseL,omitempty" metric:"-" description:"Length of the baseline to the RTK base station or moving base antenna in meters."`
 }
 
 // SKY represents a gpsd SKY (satellite position sky view) class (https://gpsd.io/gpsd_json.html#_sky)
@@ -69,7 +81,7 @@ type SKY struct {
 	HDOP       float64     `json:"hdop" description:"Horizontal dilution of precision, a dimensionless factor which should be multiplied by a base UERE to get a circular error estimate."`
 	PDOP       float64     `json:"pdop" description:"Position (spherical/3D) dilution of precision, a dimensionless factor which should be multiplied by a base UERE to get an error estimate."`
 	PRRes      float64     `json:"prRes" description:"Pseudorange residue in meters"`
-	Qual       float64     `json:"qual" description:"Quality Indicator: 0 = no signal, 1 = searching signal, 2 = signal acquired, 3 = signal detected but unusable, 4 = code locked and time synchronized, 5, 6, 7 = code and carrier locked and time synchronized"`
+	Qual       *float64    `json:"qual,omitempty" description:"Quality Indicator"`
 	Satellites []Satellite `json:"satellites" description:"List of satellite objects in skyview"`
 	TDOP       float64     `json:"tdop" description:"Time dilution of precision, a dimensionless factor which should be multiplied by a base UERE to get an error estimate."`
 	Time       string      `json:"time" description:"Time/date stamp in ISO8601 format, UTC. May have a fractional part of up to .001sec precision."`
@@ -81,18 +93,24 @@ type SKY struct {
 
 // Satellite represents a gpsd Satellite (satellite object) class (https://gpsd.io/gpsd_json.html#_satellite)
 type Satellite struct {
-	PRN       float64 `json:"PRN" description:"PRN ID of the satellite. 1-63 are GNSS satellites, 64-96 are GLONASS satellites, 100-164 are SBAS satellites"`
+	PRN       float64 `json:"PRN" metric:"-" description:"PRN ID of the satellite. 1-63 are GNSS satellites, 64-96 are GLONASS satellites, 100-164 are SBAS satellites"`
 	Azimuth   float64 `json:"az" description:"Azimuth, degrees from true north."`
 	Elevation float64 `json:"el" description:"Elevation in degrees."`
 	SNR       float64 `json:"ss" description:"Signal to Noise ratio in dBHz."`
 	Used      bool    `json:"used"  description:"Used in current solution? (SBAS/WAAS/EGNOS satellites may be flagged used if the solution has corrections from them, but not all drivers make this information available.)"`
-	GNSSID    float64 `json:"gnssid" description:"The GNSS ID, as defined by u-blox, not NMEA. 0=GPS, 2=Galileo, 3=Beidou, 5=QZSS, 6-GLONASS."`
+	GNSSID    float64 `json:"gnssid" description:"The GNSS ID, as defined by u-blox, not NMEA."`
 	SVID      float64 `json:"svid" description:"The satellite ID within its constellation. As defined by u-blox, not NMEA)."`
 	SigID     float64 `json:"sigid" description:"The signal ID of this signal. As defined by u-blox, not NMEA. See u-blox doc for details."`
 	FreqID    float64 `json:"freqid" description:"For GLONASS satellites only: the frequency ID of the signal. As defined by u-blox, range 0 to 13. The freqid is the frequency slot plus 7."`
-	Health    float64 `json:"health" description:"The health of this satellite. 0 is unknown, 1 is OK, and 2 is unhealthy."`
+	Health    float64 `json:"health" description:"The health of this satellite."`
+	PR        float64 `json:"pr" description:"Pseudorange in meters."`
+	PRRate    float64 `json:"prRate" description:"Pseudorange rate of change in meters per second."`
+	PRRes     float64 `json:"prRes" description:"Pseudorange residue in meters."`
 }
 
+// pseudorangeFields are the Satellite fields only exported with -metrics.pseudoranges, since they change with every report
+var pseudorangeFields = map[string]bool{"pr": true, "prRate": true, "prRes": true}
+
 // GST represents a gpsd GST (pseudorange noise report) class (https://gpsd.io/gpsd_json.html#_gst)
 type GST struct {
 	Device string  `json:"device" description:"Name of originating device"`
@@ -136,210 +154,495 @@ type OSC struct {
 	Delta       float64 `json:"delta" description:"The time difference (in nanoseconds) between the GPS-disciplined oscillator PPS output pulse and the most recent GPS PPS input pulse."`
 }
 
-func updateSatellite(sat *Satellite) {
-	v := reflect.ValueOf(sat)
-	for v.Kind() == reflect.Ptr { // Dereference pointer types
+// ATT represents a gpsd ATT (attitude) class (https://gpsd.io/gpsd_json.html#_att).
+// Only the reports of NMEA2000 devices are exported, under the n2k namespace, and the heading of moving-base receivers with -gpsd.heading.
+type ATT struct {
+	Device  string  `json:"device" description:"Name of the originating device."`
+	Time    string  `json:"time" namespace:"n2k" description:"Time/date stamp in ISO8601 format, UTC. May have a fractional part of up to .001sec precision."`
+	Heading float64 `json:"heading" namespace:"n2k" description:"Heading, degrees from true north."`
+	Pitch   float64 `json:"pitch" namespace:"n2k" description:"Pitch in degrees."`
+	Roll    float64 `json:"roll" namespace:"n2k" description:"Roll in degrees."`
+	Yaw     float64 `json:"yaw" namespace:"n2k" description:"Yaw in degrees."`
+	Depth   float64 `json:"depth" namespace:"n2k" description:"Water depth in meters."`
+	Temp    float64 `json:"temp" namespace:"n2k" description:"Temperature at the sensor, degrees centigrade."`
+}
+
+// n2kDevicePrefix starts the paths of the NMEA2000 CAN devices gpsd reads, such as nmea2000://can0
+const n2kDevicePrefix = "nmea2000://"
+
+// reportDevice returns the device a report originated from
+func reportDevice(report any) string {
+	v := reflect.ValueOf(report)
+	for v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
-	vType := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		key := "gpsd_sat_" + vType.Field(i).Tag.Get("json")
-		if key == "gpsd_sat_PRN" {
-			continue
-		}
-		log.Tracef("%s = %+v\n", key, field.Interface())
-
-		// Create the metrics if they don't exist
-		switch field.Type().Kind() {
-		case reflect.Bool, reflect.Float64:
-			log.Tracef("Creating gaugevec metric %s", key)
-			if _, exists := dynMetricGaugeVecs[key]; !exists {
-				dynMetricGaugeVecs[key] = promauto.NewGaugeVec(prometheus.GaugeOpts{
-					Name: key,
-					Help: vType.Field(i).Tag.Get("description"),
-				}, []string{"prn"})
-			}
-		default:
-			log.Fatalf("Unsupported type %s for %s", field.Type().Kind(), key)
-		}
+	if f := v.FieldByName("Device"); f.IsValid() {
+		return f.String()
+	}
+	return ""
+}
 
-		prnStr := fmt.Sprintf("%d", int(sat.PRN))
-
-		// Update the metrics
-		switch field.Type().Kind() {
-		case reflect.Bool:
-			if field.Interface().(bool) {
-				log.Tracef("Setting %s to 1\n", key)
-				dynMetricGaugeVecs[key].With(map[string]string{"prn": prnStr}).Set(1)
-			} else {
-				log.Tracef("Setting %s to 0\n", key)
-				dynMetricGaugeVecs[key].With(map[string]string{"prn": prnStr}).Set(0)
-			}
-		case reflect.Float64:
-			log.Tracef("Setting %s to %f\n", key, field.Interface().(float64))
-			dynMetricGaugeVecs[key].With(map[string]string{"prn": prnStr}).Set(field.Interface().(float64))
+// reportTime returns the gpsd timestamp of a report in ISO8601 form, empty if it has none
+func reportTime(report any) string {
+	switch r := report.(type) {
+	case *TPV:
+		return r.Time
+	case *SKY:
+		return r.Time
+	case *GST:
+		return r.Time
+	case *PPS:
+		return secondsTime(r.RealSec, r.RealNsec)
+	case *TOFF:
+		return secondsTime(r.RealSec, r.RealNsec)
+	case *ATT:
+		return r.Time
+	}
+	return ""
+}
+
+// reportAgeNames are the names of the report age gauges of the classes gpsd streams
+var reportAgeNames = classMetricNames("gpsd_%s_report_age_seconds")
+
+// updateReportAge records how long ago gpsd timestamped a report, exposing buffering and clock skew between gpsd and the exporter
+func (e *exporter) updateReportAge(class string, report any) {
+	t := reportTime(report)
+	if t == "" {
+		return
+	}
+	timestamp, err := parseTime(t)
+	if err != nil {
+		return // Counted by updateMetrics
+	}
+	key, ok := reportAgeNames[class]
+	if !ok {
+		key = fmt.Sprintf("gpsd_%s_report_age_seconds", class)
+	}
+	if _, exists := e.gauges[key]; !exists {
+		e.gauges[key] = e.factory.NewGauge(prometheus.GaugeOpts{
+			Name: key,
+			Help: fmt.Sprintf("Time between the gpsd timestamp of the latest %s report and when the exporter received it", strings.ToUpper(class)),
+		})
+	}
+	e.gauges[key].Set(time.Since(timestamp).Seconds())
+}
+
+// timeLayouts are the timestamp formats gpsd emits. Releases and drivers differ in fractional seconds, zone suffix, and separator.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// parseTime parses an ISO8601 timestamp from gpsd, assuming UTC when the zone is missing.
+// A leap second, 23:59:60, which time.Parse rejects, is taken as the first instant of the next day.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	value, leap := s, time.Duration(0)
+	if len(s) >= 19 && s[16:19] == ":60" {
+		value, leap = s[:17]+"59"+s[19:], time.Second
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.Add(leap), nil
 		}
 	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
 }
 
-func updateMetrics(t any, namespace string) {
-	v := reflect.ValueOf(t)
-	for v.Kind() == reflect.Ptr { // Dereference pointer types
-		v = v.Elem()
+// secondsTime formats a seconds and nanoseconds pair from gpsd as an ISO8601 timestamp
+func secondsTime(sec, nsec float64) string {
+	if sec == 0 {
+		return ""
+	}
+	return time.Unix(int64(sec), int64(nsec)).UTC().Format(time.RFC3339Nano)
+}
+
+// reportField is a report field exported as a metric by the update functions generated by genmetrics.go.
+// Its metric name depends on flags, so it's resolved on first use.
+type reportField struct {
+	namespace   string
+	field       string // Name in gpsd's JSON
+	description string
+
+	once  sync.Once
+	name  string
+	help  string
+	scale float64
+}
+
+func (f *reportField) resolve() *reportField {
+	f.once.Do(func() {
+		f.name, f.scale = metricName(f.namespace, f.field)
+		f.help = fieldHelp(f.namespace, f.field, f.description)
+	})
+	return f
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fieldGauge returns the gauge of a report field, creating it if it doesn't exist
+func (e *exporter) fieldGauge(f *reportField) prometheus.Gauge {
+	g, exists := e.gauges[f.name]
+	if !exists {
+		log.Tracef("Creating gauge metric %s", f.name)
+		g = e.factory.NewGauge(prometheus.GaugeOpts{Name: f.name, Help: f.help})
+		e.gauges[f.name] = g
+	}
+	return g
+}
+
+// setFieldGauge exports the value of a numeric report field
+func (e *exporter) setFieldGauge(f *reportField, v float64) {
+	if privacy.redacts(f.namespace, f.field) {
+		return
+	}
+	e.fieldGauge(f.resolve()).Set(v * f.scale)
+}
+
+// setFieldTime exports a report timestamp in seconds, or milliseconds with legacy names
+func (e *exporter) setFieldTime(f *reportField, s string) {
+	g := e.fieldGauge(f.resolve())
+	if s == "" {
+		return
+	}
+	timestamp, err := parseTime(s)
+	if err != nil {
+		log.Warnf("Failed to parse %s: %v", f.name, err)
+		e.timeParseErrors.Inc()
+		return
+	}
+	if *legacyNames {
+		g.Set(float64(timestamp.UnixNano() / 1000000))
+	} else {
+		g.Set(float64(timestamp.UnixNano()) / 1e9)
+	}
+}
+
+// setSatelliteGauge stages the value of a satellite field, labeled with the satellite's PRN, for the SKY report's snapshot
+func (e *exporter) setSatelliteGauge(f *reportField, prn string, v float64) {
+	if pseudorangeFields[f.field] && !*pseudoranges {
+		return
+	}
+	f.resolve()
+	e.satSnapshot.set(f.name, f.help, prn, v*f.scale)
+}
+
+// updateSatellites updates the per-satellite metrics of a SKY report
+func (e *exporter) updateSatellites(sats []Satellite) {
+	if *satelliteMetrics != "full" {
+		return
+	}
+	for i := range sats {
+		e.updateSatellite(&sats[i])
 	}
-	vType := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		key := fmt.Sprintf("gpsd_%s_%s", namespace, vType.Field(i).Tag.Get("json"))
-		log.Tracef("%s = %+v\n", key, field.Interface())
+}
 
-		if field.Type().Kind() == reflect.String && vType.Field(i).Tag.Get("json") != "time" {
-			continue
+// updateMetrics updates the metrics of the fields of a report
+func (e *exporter) updateMetrics(report any) {
+	switch r := report.(type) {
+	case *TPV:
+		e.updateTPV(r)
+	case *SKY:
+		e.updateSKY(r)
+	case *GST:
+		e.updateGST(r)
+	case *PPS:
+		e.updatePPS(r)
+	case *TOFF:
+		e.updateTOFF(r)
+	case *OSC:
+		e.updateOSC(r)
+	case *ATT:
+		if strings.HasPrefix(r.Device, n2kDevicePrefix) {
+			e.updateATT(r)
 		}
+	default:
+		log.Fatalf("Unsupported report type %T", report)
+	}
+}
 
-		// Create the metrics if they don't exist
-		switch field.Type().Kind() {
-		case reflect.Bool, reflect.Float64, reflect.String:
-			log.Tracef("Creating gauge metric %s", key)
-			if _, exists := dynMetricGauges[key]; !exists {
-				dynMetricGauges[key] = promauto.NewGauge(prometheus.GaugeOpts{
-					Name: key,
-					Help: vType.Field(i).Tag.Get("description"),
-				})
-			}
-		case reflect.Slice:
-			if key != "gpsd_sky_satellites" {
-				log.Fatalf("Found slice that isn't a satellite slice: %s", key)
-			}
+// pollClasses are the report arrays in a POLL response
+var pollClasses = []string{"tpv", "sky", "gst", "pps", "toff", "osc"}
 
-			// Handle satellite slice
-			for j := 0; j < field.Len(); j++ {
-				satellite := field.Index(j).Interface().(Satellite)
-				updateSatellite(&satellite)
-			}
-		default:
-			log.Fatalf("Unsupported type %s for %s", field.Type().Kind(), key)
+// handleReport updates metrics and subscribers from a parsed report
+func (e *exporter) handleReport(class string, report any) {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	if !e.admitDevice(report) {
+		return
+	}
+	// POLL responses repeat reports that have already been exported, which mustn't revive expired metrics
+	if !e.countReport(class, report) {
+		return
+	}
+	report = e.limitSatellites(report)
+	public := privacy.filter(report)
+	if e.minimal != nil {
+		e.updateMinimal(public)
+		e.recordReport(class, report, public)
+		return
+	}
+	if tpv, ok := report.(*TPV); ok && smoothing.mode != "off" {
+		e.updateRaw(public.(*TPV))
+		public = privacy.filter(e.smooth(tpv))
+	}
+	e.updateMetrics(public)
+	e.observeHistograms(report)
+	e.updateReportAge(class, report)
+	e.updateFreshness(class, report)
+	if tpv, ok := report.(*TPV); ok {
+		e.updateMotion(tpv) // Distances don't reveal where the device is
+		e.updateAntenna(tpv)
+		e.updateDGPS(tpv)
+		e.checkAnomalies(tpv)
+		e.recordHistory(tpv)
+		if *movingBase {
+			e.updateBaseline(tpv)
 		}
+	}
+	if att, ok := report.(*ATT); ok && *movingBase && !strings.HasPrefix(att.Device, n2kDevicePrefix) {
+		e.updateMovingBaseHeading(att)
+	}
+	if osc, ok := report.(*OSC); ok {
+		e.updateOscillator(osc)
+	}
+	e.updateOffsetCheck(report)
+	if toff, ok := report.(*TOFF); ok {
+		e.updateDrift(toff)
+	}
+	if sky, ok := report.(*SKY); ok {
+		if *satelliteMetrics == "full" {
+			e.updateVisibility(sky)
+		}
+		if *satelliteMetrics != "off" {
+			e.updateConstellations(sky)
+			e.updateSectors(sky)
+		}
+		e.updateDOPBreaches(sky)
+		e.updateDeviceDOPs(sky)
+		e.updateSNR(sky)
+		e.satSnapshot.publish()
+		e.updateQuality(sky)
+	}
+	e.recordReport(class, report, public)
+}
 
-		// Update the metrics
-		switch field.Type().Kind() {
-		case reflect.Bool:
-			if field.Interface().(bool) {
-				log.Tracef("Setting %s to 1\n", key)
-				dynMetricGauges[key].Set(1)
-			} else {
-				log.Tracef("Setting %s to 0\n", key)
-				dynMetricGauges[key].Set(0)
-			}
-		case reflect.String:
-			timeStr := field.Interface().(string)
-			if timeStr != "" {
-				timestamp, err := time.Parse(time.RFC3339Nano, timeStr)
-				if err != nil {
-					log.Fatalf("Failed to parse time %s: %s", timeStr, err)
-				}
-				dynMetricGauges[key].Set(float64(timestamp.UnixNano() / 1000000))
-			}
-		case reflect.Float64:
-			log.Tracef("Setting %s to %f\n", key, field.Interface().(float64))
-			dynMetricGauges[key].Set(field.Interface().(float64))
+// recordReport notes when a report was exported and passes it on to the SNMP agent, the event stream and onReport
+func (e *exporter) recordReport(class string, report, public any) {
+	e.lastSeen[class] = time.Now()
+	e.latest[class] = public
+	if e.onReport != nil {
+		e.onReport(class, report)
+	}
+	events.publish(class, public)
+}
+
+// parsedClasses are the message classes timed separately by gpsd_exporter_parse_duration_seconds, others are timed as "other"
+var parsedClasses = map[string]bool{
+	"VERSION": true, "DEVICES": true, "WATCH": true, "DEVICE": true, "ERROR": true, "POLL": true,
+	"TPV": true, "SKY": true, "GST": true, "PPS": true, "TOFF": true, "OSC": true, "ATT": true,
+}
+
+// POLL represents a gpsd POLL (current fix) response (https://gpsd.io/gpsd_json.html#_poll)
+type POLL struct {
+	Active   float64 `json:"active"`
+	TPV      []TPV   `json:"tpv"`
+	SKY      []SKY   `json:"sky"`
+	Fixes    []TPV   `json:"fixes"`    // tpv before gpsd 3.20
+	Skyviews []SKY   `json:"skyviews"` // sky before gpsd 3.20
+	GST      []GST   `json:"gst"`
+	PPS      []PPS   `json:"pps"`
+	TOFF     []TOFF  `json:"toff"`
+	OSC      []OSC   `json:"osc"`
+}
+
+// pollKeys are the keys of a POLL response other than its report arrays
+var pollKeys = map[string]bool{"class": true, "active": true, "time": true}
+
+// legacyPollArrays are the report arrays of POLL responses before gpsd 3.20, by the class of their reports
+var legacyPollArrays = map[string]string{"fixes": "tpv", "skyviews": "sky"}
+
+// classPrefix starts every message gpsd sends
+const classPrefix = `{"class":"`
+
+// peekClass returns the class of a message without decoding all of it.
+// gpsd writes the class first, so decoding is only needed for messages from elsewhere.
+func peekClass(line string) (string, error) {
+	if rest := strings.TrimPrefix(line, classPrefix); rest != line {
+		if class, _, ok := strings.Cut(rest, `"`); ok {
+			return class, nil
 		}
 	}
+	var header struct {
+		Class string `json:"class"`
+	}
+	err := json.Unmarshal([]byte(line), &header)
+	return header.Class, err
 }
 
-func processLine(line string) {
+func (e *exporter) processLine(line string) error {
 	if len(line) < 16 {
-		return
+		return nil
+	}
+	start := time.Now()
+	class := "other"
+	defer func() {
+		e.parseObservers[class].Observe(time.Since(start).Seconds())
+	}()
+	cl, err := peekClass(line)
+	if err != nil {
+		return err
+	}
+	if !collected(cl) {
+		return nil // Skipped before decoding
 	}
-	var f interface{}
-	if err := json.Unmarshal([]byte(line), &f); err != nil {
-		log.Fatal(err)
+	if parsedClasses[cl] {
+		class = strings.ToLower(cl)
 	}
 
-	m := f.(map[string]interface{})
-	cl := m["class"]
 	switch cl {
-	case "VERSION":
-		metricVersion.With(
-			map[string]string{
-				"version": fmt.Sprintf("GPSD v%s", m["release"].(string)),
-			},
-		).Set(1)
+	case "VERSION", "ERROR":
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			return err
+		}
+		if cl == "ERROR" {
+			return e.processError(m)
+		}
+		e.setVersion(m)
+		events.publish("version", m)
+		if err := e.setProtocol(m); err != nil {
+			return err
+		}
+	case "DEVICES":
+		return e.processDevices(line)
+	case "WATCH":
+		return e.processWatch(line)
+	case "DEVICE":
+		return e.processDevice(line)
+	case "TPV", "SKY", "GST", "PPS", "TOFF", "OSC":
+		// Reports are streamed continuously in watcher mode, but only read from there when ?POLL isn't available,
+		// except for PPS with the pps WATCH option since POLL responses only include the latest pulse
+		if e.streaming() || cl == "PPS" && watchOptions["pps"] {
+			return e.processStreamed(cl, line)
+		}
+	case "ATT":
+		// POLL responses don't include attitude, so it's always read from the reports streamed with -gpsd.nmea2000 or -gpsd.heading
+		return e.processStreamed(cl, line)
 	case "POLL":
-		for pollClass := range m {
-			switch pollClass {
-			case "sky":
-				var skyFrame struct {
-					Sky []SKY `json:"sky"`
-				}
-				if err := json.Unmarshal([]byte(line), &skyFrame); err != nil {
-					log.Warnf("Error unmarshalling SKY: %v", err)
-				}
-				log.Tracef("SKY: %+v", skyFrame.Sky)
-				for _, sky := range skyFrame.Sky {
-					updateMetrics(sky, "sky")
-				}
-			case "tpv":
-				var tpvFrame struct {
-					TPV []TPV `json:"tpv"`
-				}
-				if err := json.Unmarshal([]byte(line), &tpvFrame); err != nil {
-					log.Warnf("Error unmarshalling TPV: %v", err)
-				}
-				log.Tracef("TPV: %+v", tpvFrame.TPV)
-				for _, tpv := range tpvFrame.TPV {
-					updateMetrics(tpv, "tpv")
-				}
-			case "gst":
-				var gstFrame struct {
-					GST []GST `json:"gst"`
-				}
-				if err := json.Unmarshal([]byte(line), &gstFrame); err != nil {
-					log.Warnf("Error unmarshalling GST: %v", err)
-				}
-				log.Tracef("GST: %+v", gstFrame.GST)
-				for _, gst := range gstFrame.GST {
-					updateMetrics(gst, "gst")
-				}
-			case "pps":
-				var ppsFrame struct {
-					PPS []PPS `json:"pps"`
-				}
-				if err := json.Unmarshal([]byte(line), &ppsFrame); err != nil {
-					log.Warnf("Error unmarshalling PPS: %v", err)
-				}
-				log.Tracef("PPS: %+v", ppsFrame.PPS)
-				for _, pps := range ppsFrame.PPS {
-					updateMetrics(pps, "pps")
-				}
-			case "toff":
-				var toffFrame struct {
-					Toff []TOFF `json:"toff"`
-				}
-				if err := json.Unmarshal([]byte(line), &toffFrame); err != nil {
-					log.Warnf("Error unmarshalling TOFF: %v", err)
-				}
-				log.Tracef("TOFF: %+v", toffFrame.Toff)
-				for _, toff := range toffFrame.Toff {
-					updateMetrics(toff, "toff")
-				}
-			case "osc":
-				var oscFrame struct {
-					OSC []OSC `json:"osc"`
+		return e.processPoll(line)
+	default:
+		if *strict {
+			e.noteUnknown(strings.ToLower(cl), "")
+		}
+	}
+	return nil
+}
+
+// processPoll updates metrics from the reports of a POLL response, decoding it once into its report structs
+func (e *exporter) processPoll(line string) error {
+	e.pollSize.Observe(float64(len(line)))
+	var poll POLL
+	if err := json.Unmarshal([]byte(line), &poll); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return fmt.Errorf("unmarshalling POLL: %w", err)
+		}
+		log.Warnf("Error unmarshalling POLL: %v", err) // The rest of the response is still decoded
+	}
+	log.Tracef("POLL: %+v", poll)
+	legacy := e.legacyReports()
+	if legacy {
+		poll.TPV = append(poll.TPV, poll.Fixes...)
+		poll.SKY = append(poll.SKY, poll.Skyviews...)
+	}
+	e.pollActive.Set(poll.Active)
+	counts := [...]int{len(poll.TPV), len(poll.SKY), len(poll.GST), len(poll.PPS), len(poll.TOFF), len(poll.OSC)} // In the order of pollClasses
+	for i, class := range pollClasses {
+		e.pollClassPresent[class].Set(boolValue(counts[i] > 0))
+	}
+	// POLL responses are decoded as a whole, but the reports of classes that aren't collected are dropped unexported
+	if !collected("tpv") {
+		poll.TPV = nil
+	}
+	if !collected("sky") {
+		poll.SKY = nil
+	}
+	if !collected("gst") {
+		poll.GST = nil
+	}
+	if !collected("pps") {
+		poll.PPS = nil
+	}
+	if !collected("toff") {
+		poll.TOFF = nil
+	}
+	if !collected("osc") {
+		poll.OSC = nil
+	}
+
+	for i := range poll.TPV {
+		if legacy {
+			upgradeReport(&poll.TPV[i])
+		}
+		e.handleReport("tpv", &poll.TPV[i])
+	}
+	for i := range poll.SKY {
+		if legacy {
+			upgradeReport(&poll.SKY[i])
+		}
+		e.handleReport("sky", &poll.SKY[i])
+	}
+	for i := range poll.GST {
+		e.handleReport("gst", &poll.GST[i])
+	}
+	for i := range poll.PPS {
+		e.handleReport("pps", &poll.PPS[i])
+	}
+	for i := range poll.TOFF {
+		e.handleReport("toff", &poll.TOFF[i])
+	}
+	for i := range poll.OSC {
+		e.handleReport("osc", &poll.OSC[i])
+	}
+
+	// Unknown keys and fields are only looked for when asked to, as that takes decoding the response again
+	if *strict || *autoDiscover {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			return nil
+		}
+		for key := range m {
+			if _, known := e.pollClassPresent[key]; !known && !pollKeys[key] && legacyPollArrays[key] == "" {
+				log.Infof("Unknown poll type: %s in line %s", key, line)
+				if *strict {
+					e.noteUnknown("poll", key)
 				}
-				if err := json.Unmarshal([]byte(line), &oscFrame); err != nil {
-					log.Warnf("Error unmarshalling OSC: %v", err)
+			}
+		}
+		for _, class := range pollClasses {
+			reports, _ := m[class].([]interface{})
+			for _, report := range reports {
+				if raw, ok := report.(map[string]interface{}); ok {
+					e.inspectFields(class, raw)
 				}
-				log.Tracef("OSC: %+v", oscFrame.OSC)
-				for _, osc := range oscFrame.OSC {
-					updateMetrics(osc, "osc")
+			}
+		}
+		for key, class := range legacyPollArrays {
+			reports, _ := m[key].([]interface{})
+			for _, report := range reports {
+				if raw, ok := report.(map[string]interface{}); ok {
+					e.inspectFields(class, raw)
 				}
-			case "class", "active", "time":
-				// Ignore
-			default:
-				log.Printf("Unknown poll type: %s in line %s", pollClass, line)
 			}
 		}
 	}
+	return nil
 }
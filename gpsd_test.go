@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// benchSKYLine and benchPOLLLine are gpsd messages as a receiver tracking 20 satellites sends them
+var (
+	benchSKYLine = func() string {
+		sats := make([]string, 20)
+		for i := range sats {
+			sats[i] = fmt.Sprintf(`{"PRN":%d,"el":%d,"az":%d,"ss":%d,"used":%t,"gnssid":0,"svid":%d}`, i+1, i*4, i*17, 20+i, i%2 == 0, i+1)
+		}
+		return `{"class":"SKY","device":"/dev/ttyACM0","time":"2024-06-01T12:00:00.000Z","xdop":0.6,"ydop":0.7,"vdop":1.1,"tdop":0.9,` +
+			`"hdop":0.9,"gdop":1.7,"pdop":1.4,"nSat":20,"uSat":10,"satellites":[` + strings.Join(sats, ",") + `]}`
+	}()
+	benchTPVLine = `{"class":"TPV","device":"/dev/ttyACM0","mode":3,"status":1,"time":"2024-06-01T12:00:00.000Z","ept":0.005,` +
+		`"lat":37.7749,"lon":-122.4194,"altHAE":30.1,"altMSL":62.3,"epx":2.1,"epy":2.5,"epv":5.1,"track":90.0,"speed":1.2,"climb":0.1,"eph":3.1}`
+	benchPOLLLine = `{"class":"POLL","time":"2024-06-01T12:00:00.000Z","active":1,"tpv":[` + benchTPVLine + `],"gst":[],"sky":[` + benchSKYLine + `]}`
+)
+
+// doubleDecode decodes a streamed report as processLine did before peeking at the class: into a map to find the class, then into its struct.
+// It's the baseline BenchmarkDecode compares against.
+func doubleDecode(line string) (any, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		return nil, err
+	}
+	class, _ := m["class"].(string)
+	report := streamedReports[class]()
+	return report, json.Unmarshal([]byte(line), report)
+}
+
+// peekDecode decodes a streamed report as processLine does, peeking at the class before decoding it into its struct
+func peekDecode(line string) (any, error) {
+	class, err := peekClass(line)
+	if err != nil {
+		return nil, err
+	}
+	report := streamedReports[class]()
+	return report, json.Unmarshal([]byte(line), report)
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, decode := range []struct {
+		name string
+		f    func(string) (any, error)
+	}{
+		{"peek", peekDecode},
+		{"double", doubleDecode},
+	} {
+		b.Run("SKY/"+decode.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decode.f(benchSKYLine); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkProcessLine measures a POLL response through processLine. Repeats of a report are recognized and not exported again,
+// as happens when gpsd answers polls faster than the receiver reports, so after the first iteration this is mostly decoding.
+func BenchmarkProcessLine(b *testing.B) {
+	e := newExporter("localhost:2947", prometheus.NewRegistry())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := e.processLine(benchPOLLLine); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, tt := range []struct {
+		name, in string
+		want     time.Time
+		err      bool
+	}{
+		{name: "milliseconds", in: "2024-06-01T12:00:00.123Z", want: time.Date(2024, 6, 1, 12, 0, 0, 123e6, time.UTC)},
+		{name: "nanoseconds", in: "2024-06-01T12:00:00.123456789Z", want: time.Date(2024, 6, 1, 12, 0, 0, 123456789, time.UTC)},
+		{name: "whole seconds", in: "2024-06-01T12:00:00Z", want: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "offset", in: "2024-06-01T14:00:00.5+02:00", want: time.Date(2024, 6, 1, 12, 0, 0, 5e8, time.UTC)},
+		{name: "missing zone", in: "2024-06-01T12:00:00.250", want: time.Date(2024, 6, 1, 12, 0, 0, 25e7, time.UTC)},
+		{name: "missing zone without fraction", in: "2024-06-01T12:00:00", want: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "space separator", in: "2024-06-01 12:00:00.5Z", want: time.Date(2024, 6, 1, 12, 0, 0, 5e8, time.UTC)},
+		{name: "space separator without zone", in: "2024-06-01 12:00:00", want: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "surrounding space", in: " 2024-06-01T12:00:00Z\n", want: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "leap second", in: "2016-12-31T23:59:60.000Z", want: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leap second with fraction", in: "2016-12-31T23:59:60.5Z", want: time.Date(2017, 1, 1, 0, 0, 0, 5e8, time.UTC)},
+		{name: "leap second without zone", in: "2016-12-31T23:59:60", want: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "second 61", in: "2016-12-31T23:59:61Z", err: true},
+		{name: "empty", in: "", err: true},
+		{name: "blank", in: "  ", err: true},
+		{name: "date only", in: "2024-06-01", err: true},
+		{name: "garbage", in: "yesterday", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("got %s, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "math"
+
+// angleDiff returns a-b in degrees, normalized to [-180, 180)
+func angleDiff(a, b float64) float64 {
+	return math.Mod(math.Mod(a-b+180, 360)+360, 360) - 180
+}
+
+// updateHeading exports the difference between magnetic and true track and whether it agrees with the magnetic variation, which gpsd adds to the true track.
+// gpsd only reports the magnetic track when it knows the variation, so TPVs with neither are skipped.
+func (e *exporter) updateHeading(tpv *TPV) {
+	if tpv.MagTrack == 0 && tpv.MagVar == 0 {
+		return
+	}
+	deviation := angleDiff(tpv.MagTrack, tpv.Track)
+	e.series(e.headingDeviation, tpv.Device).Set(deviation)
+	if math.Abs(angleDiff(deviation, tpv.MagVar)) > *headingTolerance {
+		e.series(e.headingInconsistent, tpv.Device).Set(1)
+	} else {
+		e.series(e.headingInconsistent, tpv.Device).Set(0)
+	}
+}
+
+// updateMovingBaseHeading exports the heading a dual-antenna receiver measures along the baseline from its moving base antenna,
+// which gpsd reports as the ATT of the rover device
+func (e *exporter) updateMovingBaseHeading(att *ATT) {
+	e.movingBases[att.Device] = true
+	e.series(e.movingBaseHeading, att.Device).Set(att.Heading)
+}
+
+// updateBaseline exports the state of the baseline of a device that reported a moving-base heading, from the base fields of its TPV.
+// The heading is only as good as the baseline, which needs a fixed carrier phase solution for centimeter accuracy.
+func (e *exporter) updateBaseline(tpv *TPV) {
+	if !e.movingBases[tpv.Device] {
+		return
+	}
+	e.series(e.baselineValid, tpv.Device).Set(boolValue(tpv.BaseS == 2))
+	if tpv.BaseL != nil {
+		e.series(e.baselineLength, tpv.Device).Set(*tpv.BaseL)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// nativeBucketFactor bounds the growth between native histogram buckets to 10%, fine enough for PPS offsets spanning nanoseconds to milliseconds
+const nativeBucketFactor = 1.1
+
+// histogramOpts adds native histogram settings to opts when enabled. Classic buckets are still exported for scrapers that don't support native histograms.
+func histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if *nativeHistograms {
+		opts.NativeHistogramBucketFactor = nativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.NativeHistogramZeroThreshold = 1e-9 // 1ns, below the resolution of any PPS source
+	}
+	return opts
+}
+
+// observeHistograms records the distributions derived from a report
+func (e *exporter) observeHistograms(report any) {
+	switch r := report.(type) {
+	case *PPS:
+		e.observePPSOffset(r)
+		if r.RealSec != 0 {
+			// Reports are already deduplicated by device, unlike the pulses of observePPSOffset
+			e.observeQErr(r)
+			e.observePulse(r, r.RealSec+r.RealNsec/1e9)
+		}
+	case *TPV:
+		e.observeFix(r)
+		e.observeErrors(r)
+	case *SKY:
+		if *satelliteMetrics == "off" {
+			return
+		}
+		for _, sat := range r.Satellites {
+			if sat.SNR > 0 {
+				e.snr.Observe(sat.SNR)
+			}
+		}
+	}
+}
+
+// observePPSOffset records the offset of the system clock from a PPS pulse, with the device and pulse time as an exemplar.
+// POLL responses repeat the latest pulse until the next one arrives.
+func (e *exporter) observePPSOffset(pps *PPS) {
+	pulse := pps.RealSec + pps.RealNsec/1e9
+	if pps.RealSec != 0 && pulse != e.lastPulse {
+		e.lastPulse = pulse
+		setExemplar(e.exemplar, pps.Device, secondsTime(pps.RealSec, pps.RealNsec))
+		e.ppsOffset.(prometheus.ExemplarObserver).ObserveWithExemplar(pps.ClockSec-pps.RealSec+(pps.ClockNsec-pps.RealNsec)/1e9, e.exemplar)
+	}
+}
+
+// errorObjectives are the quantiles exported for position error estimates, with their allowed error
+var errorObjectives = map[float64]float64{0.5: 0.05, 0.95: 0.01}
+
+// errorSummary creates a summary of a position error estimate over -metrics.error-window
+func errorSummary(factory promauto.Factory, name, help string) *prometheus.SummaryVec {
+	return factory.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       name,
+		Help:       help,
+		Objectives: errorObjectives,
+		MaxAge:     *errorWindow,
+		AgeBuckets: 5,
+	}, []string{"device"})
+}
+
+// observeErrors records the position error estimates of a TPV report, skipping those the receiver doesn't report
+func (e *exporter) observeErrors(tpv *TPV) {
+	for summary, value := range map[*prometheus.SummaryVec]float64{
+		e.ephSummary: tpv.EPH,
+		e.epvSummary: tpv.EPV,
+		e.sepSummary: tpv.Sep,
+	} {
+		if value > 0 {
+			summary.WithLabelValues(tpv.Device).Observe(value)
+		}
+	}
+}
+
+// fixState tracks fix outages of a device
+type fixState struct {
+	fix  bool
+	lost time.Time // When the fix was lost, zero if the device hasn't had one since connecting
+}
+
+// observeFix counts the fixes a device loses and records how long it went without one once it has one again
+func (e *exporter) observeFix(tpv *TPV) {
+	f, ok := e.fixes[tpv.Device]
+	if !ok {
+		f = &fixState{}
+		e.fixes[tpv.Device] = f
+	}
+	now := time.Now()
+	switch {
+	case tpv.Mode < 2 && f.fix:
+		f.fix, f.lost = false, now
+		e.fixLosses.WithLabelValues(tpv.Device).Inc()
+	case tpv.Mode >= 2 && !f.fix:
+		f.fix = true
+		if !f.lost.IsZero() {
+			e.fixOutage.Observe(now.Sub(f.lost).Seconds())
+		} else if !e.connected.IsZero() {
+			e.fixReacquisition.Observe(now.Sub(e.connected).Seconds())
+		}
+	}
+}
+
+// resetFixes restarts the reacquisition time of every device from a new connection to the source
+func (e *exporter) resetFixes() {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	e.fixes = map[string]*fixState{}
+	e.connected = time.Now()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// historyPoint is a fix kept in the position history
+type historyPoint struct {
+	time          time.Time
+	lat, lon, alt float64
+}
+
+// recordHistory adds a fix to the position history of its device with -history.retention, at most once every -history.interval.
+// Positions are kept as limited by the privacy mode, and not at all when it redacts them.
+func (e *exporter) recordHistory(tpv *TPV) {
+	if *historyRetention <= 0 {
+		return
+	}
+	t, ok := fixTime(tpv)
+	if !ok {
+		return
+	}
+	lat, lon, ok := privacy.position(tpv.Lat, tpv.Lon)
+	if !ok {
+		return
+	}
+	points := e.history[tpv.Device]
+	if n := len(points); n > 0 && t.Sub(points[n-1].time) < *historyInterval {
+		return
+	}
+	points = append(points, historyPoint{time: t, lat: lat, lon: lon, alt: tpv.AltMSL})
+	i := 0
+	for i < len(points) && t.Sub(points[i].time) > *historyRetention {
+		i++
+	}
+	e.history[tpv.Device] = points[i:]
+}
+
+// historyBetween returns the position history of each device between from and to
+func (e *exporter) historyBetween(from, to time.Time) map[string][]historyPoint {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	history := map[string][]historyPoint{}
+	for device, points := range e.history {
+		start := sort.Search(len(points), func(i int) bool { return !points[i].time.Before(from) })
+		end := sort.Search(len(points), func(i int) bool { return points[i].time.After(to) })
+		if end-start > 0 {
+			history[device] = append([]historyPoint{}, points[start:end]...)
+		}
+	}
+	return history
+}
+
+// segmentDistance returns the distance in meters of p from the segment between a and b, on a plane tangent at a
+func segmentDistance(p, a, b historyPoint) float64 {
+	scale := math.Cos(a.lat * math.Pi / 180)
+	px, py := (p.lon-a.lon)*scale, p.lat-a.lat
+	bx, by := (b.lon-a.lon)*scale, b.lat-a.lat
+	if l := bx*bx + by*by; l > 0 {
+		t := math.Max(0, math.Min(1, (px*bx+py*by)/l))
+		px, py = px-t*bx, py-t*by
+	}
+	return math.Hypot(px, py) * earthRadius * math.Pi / 180
+}
+
+// simplify returns the points kept by the Douglas-Peucker algorithm with a tolerance of epsilon meters
+func simplify(points []historyPoint, epsilon float64) []historyPoint {
+	if len(points) < 3 {
+		return points
+	}
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		farthest, distance := 0, 0.0
+		for i := span[0] + 1; i < span[1]; i++ {
+			if d := segmentDistance(points[i], points[span[0]], points[span[1]]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if distance > epsilon {
+			keep[farthest] = true
+			stack = append(stack, [2]int{span[0], farthest}, [2]int{farthest, span[1]})
+		}
+	}
+	var kept []historyPoint
+	for i, p := range points {
+		if keep[i] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// downsample simplifies points with the smallest Douglas-Peucker tolerance, to within a centimeter, that keeps at most max of them
+func downsample(points []historyPoint, max int) []historyPoint {
+	if len(points) <= max {
+		return points
+	}
+	low, high := 0.0, 1.0
+	for len(simplify(points, high)) > max {
+		high *= 2
+	}
+	for high-low > 0.01 {
+		mid := (low + high) / 2
+		if len(simplify(points, mid)) > max {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return simplify(points, high)
+}
+
+// geoJSONFeature is a GeoJSON feature with a LineString geometry
+type geoJSONFeature struct {
+	Type     string `json:"type"`
+	Geometry struct {
+		Type        string      `json:"type"`
+		Coordinates [][]float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// parseHistoryTime parses a from or to parameter as an RFC 3339 timestamp or Unix time in seconds
+func parseHistoryTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected RFC 3339 or Unix seconds)", value)
+	}
+	return t, nil
+}
+
+// historyHandler serves the position history of every device between the from and to parameters as a GeoJSON feature collection
+// with a LineString per device, downsampled to at most max_points positions each
+func historyHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		from, err := parseHistoryTime(r.URL.Query().Get("from"), now.Add(-*historyRetention))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := parseHistoryTime(r.URL.Query().Get("to"), now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		maxPoints := 1000
+		if value := r.URL.Query().Get("max_points"); value != "" {
+			if maxPoints, err = strconv.Atoi(value); err != nil || maxPoints < 2 {
+				http.Error(w, fmt.Sprintf("invalid max_points %q (expected at least 2)", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		features := []geoJSONFeature{}
+		for _, e := range sources.list() {
+			for device, points := range e.historyBetween(from, to) {
+				if len(points) < 2 {
+					continue // Not a line
+				}
+				simplified := downsample(points, maxPoints)
+				f := geoJSONFeature{Type: "Feature", Properties: map[string]any{
+					"target": e.target,
+					"device": device,
+					"start":  points[0].time.UTC(),
+					"end":    points[len(points)-1].time.UTC(),
+					"points": len(points),
+				}}
+				f.Geometry.Type = "LineString"
+				for _, p := range simplified {
+					position := []float64{p.lon, p.lat}
+					if p.alt != 0 {
+						position = append(position, p.alt)
+					}
+					f.Geometry.Coordinates = append(f.Geometry.Coordinates, position)
+				}
+				features = append(features, f)
+			}
+		}
+		sort.Slice(features, func(i, j int) bool {
+			a, b := features[i].Properties, features[j].Properties
+			return a["target"].(string)+a["device"].(string) < b["target"].(string)+b["device"].(string)
+		})
+
+		w.Header().Set("Content-Type", "application/geo+json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"type": "FeatureCollection", "features": features})
+	}
+}
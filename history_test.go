@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// degreeMeters is the length of a degree of latitude, and of longitude at the equator
+const degreeMeters = earthRadius * math.Pi / 180
+
+// point returns a history point offset from the origin by north and east meters, at the equator so both scale the same
+func point(north, east float64) historyPoint {
+	return historyPoint{lat: north / degreeMeters, lon: east / degreeMeters}
+}
+
+func TestSegmentDistance(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		p, a, b historyPoint
+		want    float64
+	}{
+		{"on the segment", point(0, 50), point(0, 0), point(0, 100), 0},
+		{"beside the segment", point(10, 50), point(0, 0), point(0, 100), 10},
+		{"beyond the end", point(0, 130), point(0, 0), point(0, 100), 30},
+		{"before the start", point(-30, -40), point(0, 0), point(0, 100), 50},
+		{"degenerate segment", point(30, 40), point(0, 0), point(0, 0), 50},
+		{"diagonal", point(0, 100), point(0, 0), point(100, 100), 100 / math.Sqrt2},
+		// A degree of longitude at 60° north is half as long as at the equator
+		{"scaled by latitude", historyPoint{lat: 60, lon: 1}, historyPoint{lat: 60, lon: 0}, historyPoint{lat: 61, lon: 0}, degreeMeters / 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := segmentDistance(tt.p, tt.a, tt.b); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("got %v meters, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		points  []historyPoint
+		epsilon float64
+		want    []historyPoint
+	}{
+		{"empty", nil, 1, nil},
+		{"two points", []historyPoint{point(0, 0), point(5, 5)}, 1, []historyPoint{point(0, 0), point(5, 5)}},
+		{"straight line", []historyPoint{point(0, 0), point(0, 10), point(0, 20), point(0, 30)}, 1,
+			[]historyPoint{point(0, 0), point(0, 30)}},
+		{"noise within the tolerance", []historyPoint{point(0, 0), point(0.5, 10), point(-0.5, 20), point(0, 30)}, 1,
+			[]historyPoint{point(0, 0), point(0, 30)}},
+		{"corner", []historyPoint{point(0, 0), point(0, 10), point(0, 20), point(10, 20), point(20, 20)}, 1,
+			[]historyPoint{point(0, 0), point(0, 20), point(20, 20)}},
+		{"spike", []historyPoint{point(0, 0), point(0, 10), point(50, 15), point(0, 20), point(0, 30)}, 1,
+			[]historyPoint{point(0, 0), point(0, 10), point(50, 15), point(0, 20), point(0, 30)}},
+		{"spike within a larger tolerance", []historyPoint{point(0, 0), point(0, 10), point(50, 15), point(0, 20), point(0, 30)}, 60,
+			[]historyPoint{point(0, 0), point(0, 30)}},
+		{"return to the start", []historyPoint{point(0, 0), point(0, 10), point(0, 20), point(0, 10), point(0, 0)}, 1,
+			[]historyPoint{point(0, 0), point(0, 20), point(0, 0)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := simplify(tt.points, tt.epsilon)
+			if len(got) != len(tt.want) {
+				t.Fatalf("kept %d points, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("point %d is %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	// A winding track of 500 fixes a second apart
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var track []historyPoint
+	for i := 0; i < 500; i++ {
+		p := point(100*math.Sin(float64(i)/20), float64(i))
+		p.time = start.Add(time.Duration(i) * time.Second)
+		track = append(track, p)
+	}
+	for _, max := range []int{2, 3, 10, 100, 499, 500, 1000} {
+		got := downsample(track, max)
+		if len(got) > max {
+			t.Errorf("max %d: kept %d points", max, len(got))
+		}
+		if max >= len(track) && len(got) != len(track) {
+			t.Errorf("max %d: kept %d of %d points", max, len(got), len(track))
+		}
+		if got[0] != track[0] || got[len(got)-1] != track[len(track)-1] {
+			t.Errorf("max %d: endpoints not kept", max)
+		}
+		for i := 1; i < len(got); i++ {
+			if !got[i].time.After(got[i-1].time) {
+				t.Fatalf("max %d: points out of order at %d", max, i)
+			}
+		}
+	}
+	// The tolerance is the smallest that fits, so nearly as many points as allowed are kept
+	if got := downsample(track, 100); len(got) < 90 {
+		t.Errorf("kept %d points when 100 were allowed", len(got))
+	}
+}
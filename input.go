@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// defaultNMEAPort is the conventional NMEA 0183 over IP port
+const defaultNMEAPort = "10110"
+
+// nmeaInput reads NMEA sentences from a multiplexer instead of gpsd
+type nmeaInput struct {
+	url     string // As given on the command line, used as the device and target name
+	network string // udp to listen for broadcasts, tcp to connect to a multiplexer
+	addr    string
+
+	dialer   proxy.ContextDialer
+	exporter *exporter
+	decoder  *nmeaDecoder
+}
+
+// inputsFlag is a repeatable flag of NMEA inputs in udp-nmea://[host]:port or tcp-nmea://host:port form
+type inputsFlag []*nmeaInput
+
+func (f *inputsFlag) String() string {
+	var urls []string
+	for _, in := range *f {
+		urls = append(urls, in.url)
+	}
+	return strings.Join(urls, ", ")
+}
+
+func (f *inputsFlag) Set(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	in := &nmeaInput{url: value, addr: u.Host}
+	switch u.Scheme {
+	case "udp-nmea":
+		in.network = "udp"
+	case "tcp-nmea":
+		in.network = "tcp"
+		if u.Hostname() == "" {
+			return fmt.Errorf("tcp-nmea input %s needs a host to connect to", value)
+		}
+	default:
+		return fmt.Errorf("unsupported input %s (expected udp-nmea:// or tcp-nmea://)", value)
+	}
+	in.addr = normalizeAddr(in.addr, defaultNMEAPort)
+	*f = append(*f, in)
+	return nil
+}
+
+// run reads from the input forever, or until it can't listen for UDP datagrams
+func (in *nmeaInput) run() error {
+	in.decoder = newNMEADecoder(in.url)
+	if in.network == "udp" {
+		return in.listen()
+	}
+	for {
+		log.Infof("Connecting to NMEA source %s", in.addr)
+		conn, err := in.dialer.DialContext(context.Background(), "tcp", in.addr)
+		if err != nil {
+			log.Warnf("Error connecting to NMEA source %s: %v", in.addr, err)
+			in.exporter.connError(err)
+		} else {
+			in.setUp(conn.RemoteAddr())
+			in.read(conn)
+			_ = conn.Close()
+			in.setDown()
+		}
+		time.Sleep(*pollInterval)
+	}
+}
+
+// listen processes sentences from UDP datagrams, each of which may hold several lines
+func (in *nmeaInput) listen() error {
+	conn, err := net.ListenPacket("udp", in.addr)
+	if err != nil {
+		in.exporter.connError(err)
+		return fmt.Errorf("listening for NMEA on %s: %w", in.addr, err)
+	}
+	log.Infof("Listening for NMEA on udp %s", conn.LocalAddr())
+	in.setUp(conn.LocalAddr())
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Warnf("Error reading NMEA from %s: %v", in.addr, err)
+			in.exporter.connError(err)
+			continue
+		}
+		in.exporter.connRead(n)
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				in.process(line)
+			}
+		}
+	}
+}
+
+// read processes sentences from a TCP connection until it fails or the read deadline passes
+func (in *nmeaInput) read(conn net.Conn) {
+	scanner := bufio.NewScanner(countingReader{conn, in.exporter})
+	for {
+		if *readTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(*readTimeout))
+		}
+		if !scanner.Scan() {
+			break
+		}
+		in.process(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warnf("Error reading from NMEA source %s: %v", in.addr, err)
+		in.exporter.connError(err)
+	} else {
+		log.Warnf("NMEA source %s closed the connection", in.addr)
+		in.exporter.connError(io.EOF)
+	}
+}
+
+// process decodes a sentence and exports any report it completes
+func (in *nmeaInput) process(line string) {
+	in.exporter.connMessage()
+	s, err := parseNMEA(line)
+	recentMessages.add(in.url, line, err)
+	if err != nil {
+		log.Debugf("Error parsing NMEA from %s: %v", in.addr, err)
+		in.exporter.connError(err)
+		return
+	}
+	if class, report := in.decoder.decode(s); report != nil {
+		in.exporter.handleReport(class, report)
+		in.exporter.setLastPoll(time.Now())
+	}
+}
+
+func (in *nmeaInput) setUp(addr net.Addr) {
+	in.exporter.resetFixes()
+	in.exporter.up.Set(1)
+	in.exporter.connectionInfo.With(prometheus.Labels{"address": addr.String()}).Set(1)
+	in.exporter.connUp(addr)
+}
+
+func (in *nmeaInput) setDown() {
+	in.exporter.up.Set(0)
+	in.exporter.connectionInfo.Reset()
+	in.exporter.connDown()
+	if *resetOnDisconnect {
+		in.exporter.resetReports()
+	}
+}
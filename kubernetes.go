@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// constLabels are added to every metric, such as the Kubernetes pod the exporter runs in
+var constLabels prometheus.Labels
+
+// withConstLabels wraps reg to add constLabels to the metrics registered with it
+func withConstLabels(reg prometheus.Registerer) prometheus.Registerer {
+	if len(constLabels) == 0 {
+		return reg
+	}
+	return prometheus.WrapRegistererWith(constLabels, reg)
+}
+
+// kubernetesEnv maps the environment variables a pod spec sets from the Downward API to the labels they're exported as
+var kubernetesEnv = map[string]string{
+	"NODE_NAME":     "kubernetes_node",
+	"POD_NAMESPACE": "kubernetes_namespace",
+	"POD_NAME":      "kubernetes_pod",
+}
+
+// kubernetesLabels returns labels identifying the pod the exporter runs in from the Downward API: the node, namespace,
+// and pod from environment variables, and the pod labels named in podLabels from the labels file, if it exists
+func kubernetesLabels(labelsFile string, podLabels []string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for env, label := range kubernetesEnv {
+		if value := os.Getenv(env); value != "" {
+			labels[label] = value
+		}
+	}
+	if len(podLabels) == 0 {
+		return labels, nil
+	}
+
+	f, err := os.Open(labelsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return labels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are key="value", with the value quoted as a Go string
+		key, quoted, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod label %s in %s: %w", key, labelsFile, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, key := range podLabels {
+		if value, ok := values[key]; ok {
+			labels["kubernetes_label_"+invalidMetricChars.ReplaceAllString(key, "_")] = value
+		}
+	}
+	return labels, nil
+}
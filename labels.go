@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// prnLabels are the prn label values of the PRNs gpsd assigns, formatted once rather than for every satellite of every SKY report
+var prnLabels = func() (labels [512]string) {
+	for i := range labels {
+		labels[i] = strconv.Itoa(i)
+	}
+	return labels
+}()
+
+// prnLabel returns the prn label value of a satellite
+func prnLabel(prn float64) string {
+	if i := int(prn); i >= 0 && i < len(prnLabels) {
+		return prnLabels[i]
+	}
+	return strconv.Itoa(int(prn))
+}
+
+// seriesKey identifies a child of a gauge vector by its label values
+type seriesKey struct {
+	vec           *prometheus.GaugeVec
+	value, value2 string // value2 is empty for vectors with a single label
+}
+
+// series returns the child of a gauge vector with a single label for a label value.
+// Children are cached, so steady-state updates neither allocate the label values nor hash them to look the child up,
+// and must be deleted with dropSeries or dropVec rather than on the vector directly. Must be called with reportMu held.
+func (e *exporter) series(vec *prometheus.GaugeVec, value string) prometheus.Gauge {
+	key := seriesKey{vec: vec, value: value}
+	g, ok := e.children[key]
+	if !ok {
+		g = vec.WithLabelValues(value)
+		e.children[key] = g
+	}
+	return g
+}
+
+// pairSeries returns the child of a gauge vector with two labels for their label values, cached like series
+func (e *exporter) pairSeries(vec *prometheus.GaugeVec, value, value2 string) prometheus.Gauge {
+	key := seriesKey{vec, value, value2}
+	g, ok := e.children[key]
+	if !ok {
+		g = vec.WithLabelValues(value, value2)
+		e.children[key] = g
+	}
+	return g
+}
+
+// dropSeries deletes the child of a gauge vector for a label value
+func (e *exporter) dropSeries(vec *prometheus.GaugeVec, value string) {
+	vec.DeleteLabelValues(value)
+	delete(e.children, seriesKey{vec: vec, value: value})
+}
+
+// dropPairSeries deletes the child of a gauge vector with two labels for their label values
+func (e *exporter) dropPairSeries(vec *prometheus.GaugeVec, value, value2 string) {
+	vec.DeleteLabelValues(value, value2)
+	delete(e.children, seriesKey{vec, value, value2})
+}
+
+// dropVec deletes every child of a gauge vector
+func (e *exporter) dropVec(vec *prometheus.GaugeVec) {
+	vec.Reset()
+	for key := range e.children {
+		if key.vec == vec {
+			delete(e.children, key)
+		}
+	}
+}
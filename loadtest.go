@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// loadtestVersion is the banner of the synthetic gpsd. Protocol 3.0 predates ?POLL, so the exporter reads every streamed report.
+const loadtestVersion = `{"class":"VERSION","release":"loadtest","rev":"loadtest","proto_major":3,"proto_minor":0}` + "\r\n"
+
+// loadtestPRNs are the PRNs of the synthetic satellites, spread over GPS, GLONASS, Galileo and BeiDou
+var loadtestPRNs = func() (prns []int) {
+	for i := 0; i < 32; i++ {
+		prns = append(prns, 1+i, 65+i, 301+i, 201+i)
+	}
+	return prns
+}()
+
+// loadtestResult is the outcome of a load test
+type loadtestResult struct {
+	Duration        float64 `json:"duration_seconds"`
+	Sent            int     `json:"messages_sent"`
+	Processed       int     `json:"messages_processed"`
+	Dropped         int     `json:"messages_dropped"`
+	Throughput      float64 `json:"messages_per_second"`
+	MeanParse       float64 `json:"mean_parse_seconds"`
+	AllocsPerMsg    float64 `json:"allocs_per_message"`
+	BytesPerMsg     float64 `json:"bytes_per_message"`
+	GCCycles        uint32  `json:"gc_cycles"`
+	GCPause         float64 `json:"gc_pause_seconds"`
+	HeapBytes       uint64  `json:"heap_bytes"`
+	Series          int     `json:"series"`
+	ScrapeDuration  float64 `json:"scrape_seconds"`
+	ScrapeSizeBytes int     `json:"scrape_bytes"`
+}
+
+// loadGenerator writes synthetic TPV and SKY reports, formatting them into a reused buffer so it doesn't skew the allocation counts
+type loadGenerator struct {
+	satellites int
+	buf        []byte
+}
+
+func (g *loadGenerator) appendFloat(key string, v float64) {
+	g.buf = append(g.buf, `,"`...)
+	g.buf = append(g.buf, key...)
+	g.buf = append(g.buf, `":`...)
+	g.buf = strconv.AppendFloat(g.buf, v, 'f', -1, 64)
+}
+
+func (g *loadGenerator) appendHeader(class, device string, t time.Time) {
+	g.buf = append(g.buf, `{"class":"`...)
+	g.buf = append(g.buf, class...)
+	g.buf = append(g.buf, `","device":"`...)
+	g.buf = append(g.buf, device...)
+	g.buf = append(g.buf, `","time":"`...)
+	g.buf = t.AppendFormat(g.buf, "2006-01-02T15:04:05.000000000Z")
+	g.buf = append(g.buf, '"')
+}
+
+// tpv appends the nth TPV report of a device, wandering around a fixed position
+func (g *loadGenerator) tpv(device string, n int, t time.Time) {
+	phase := float64(n) / 100
+	g.appendHeader("TPV", device, t)
+	g.appendFloat("mode", 3)
+	g.appendFloat("status", 1)
+	g.appendFloat("lat", 37.7749+math.Sin(phase)*1e-4)
+	g.appendFloat("lon", -122.4194+math.Cos(phase)*1e-4)
+	g.appendFloat("altHAE", 30+math.Sin(phase))
+	g.appendFloat("altMSL", 62+math.Sin(phase))
+	g.appendFloat("speed", 1+math.Abs(math.Sin(phase)))
+	g.appendFloat("track", math.Mod(float64(n), 360))
+	g.appendFloat("climb", math.Cos(phase)/10)
+	g.appendFloat("velN", math.Sin(phase))
+	g.appendFloat("velE", math.Cos(phase))
+	g.appendFloat("velD", -math.Cos(phase)/10)
+	g.appendFloat("eph", 3+math.Sin(phase))
+	g.appendFloat("epv", 5+math.Cos(phase))
+	g.appendFloat("epx", 2.1)
+	g.appendFloat("epy", 2.5)
+	g.appendFloat("ept", 0.005)
+	g.appendFloat("leapseconds", 18)
+	g.buf = append(g.buf, "}\r\n"...)
+}
+
+// sky appends the nth SKY report of a device, with satellites slowly rising, setting and fading
+func (g *loadGenerator) sky(device string, n int, t time.Time) {
+	g.appendHeader("SKY", device, t)
+	g.appendFloat("hdop", 0.9)
+	g.appendFloat("vdop", 1.1)
+	g.appendFloat("pdop", 1.4)
+	g.appendFloat("gdop", 1.7)
+	g.appendFloat("nSat", float64(g.satellites))
+	g.appendFloat("uSat", float64(g.satellites*3/4))
+	g.buf = append(g.buf, `,"satellites":[`...)
+	for i := 0; i < g.satellites; i++ {
+		if i > 0 {
+			g.buf = append(g.buf, ',')
+		}
+		prn := loadtestPRNs[i%len(loadtestPRNs)]
+		phase := float64(n)/1000 + float64(i)
+		g.buf = append(g.buf, `{"PRN":`...)
+		g.buf = strconv.AppendInt(g.buf, int64(prn), 10)
+		g.appendFloat("el", math.Round(45+40*math.Sin(phase)))
+		g.appendFloat("az", math.Round(math.Mod(float64(i)*37+float64(n)/100, 360)))
+		g.appendFloat("ss", math.Round(35+10*math.Cos(phase)))
+		g.buf = append(g.buf, `,"used":`...)
+		g.buf = strconv.AppendBool(g.buf, i < g.satellites*3/4)
+		g.buf = append(g.buf, '}')
+	}
+	g.buf = append(g.buf, "]}\r\n"...)
+}
+
+// runLoadtest streams synthetic reports through an exporter connected to an in-process gpsd and reports how it kept up,
+// so performance regressions in the parsing and metric path can be caught
+func runLoadtest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	duration := fs.Duration("duration", 10*time.Second, "how long to stream reports for")
+	tpvRate := fs.Float64("tpv-rate", 100, "TPV reports per second per device")
+	skyRate := fs.Float64("sky-rate", 10, "SKY reports per second per device")
+	devices := fs.Int("devices", 1, "number of devices to stream reports from")
+	satellites := fs.Int("satellites", 24, "satellites in each SKY report")
+	format := fs.String("format", "text", "result format (text or json)")
+	maxAllocs := fs.Float64("max-allocs", 0, "exit with status 1 if more allocations than this are made per message (0 for no limit)")
+	maxDropped := fs.Float64("max-dropped", 0, "exit with status 1 if more than this fraction of messages is dropped")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s loadtest [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Unknown loadtest format %q", *format)
+	}
+	if *satellites < 0 || *satellites > len(loadtestPRNs) {
+		log.Fatalf("-satellites must be between 0 and %d", len(loadtestPRNs))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	e := newExporter(ln.Addr().String(), registry)
+	var processed uint64
+	e.onReport = func(string, any) { atomic.AddUint64(&processed, 1) } // Every synthetic report is new
+	client := &gpsdClient{
+		addr:         ln.Addr().String(),
+		pollInterval: time.Second,
+		dialer:       &net.Dialer{},
+		exporter:     e,
+	}
+	go client.run()
+	conn, err := ln.Accept()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_ = ln.Close()
+	go func() { _, _ = io.Copy(io.Discard, conn) }() // Commands from the exporter
+	w := bufio.NewWriterSize(conn, 64*1024)
+	if _, err := w.WriteString(loadtestVersion); err != nil {
+		log.Fatal(err)
+	}
+
+	names := make([]string, *devices)
+	for i := range names {
+		names[i] = fmt.Sprintf("/dev/ttyLOAD%d", i)
+	}
+	g := &loadGenerator{satellites: *satellites}
+	log.Infof("Streaming %.0f TPV and %.0f SKY reports per second from each of %d device(s) for %s", *tpvRate, *skyRate, *devices, *duration)
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	var tpvs, skies, sent int
+	ticker := time.NewTicker(time.Millisecond)
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		if elapsed > *duration {
+			elapsed = *duration
+		}
+		// Reports are due at their rate since the start, and timestamped when due so each is new to the exporter
+		for due := int(elapsed.Seconds() * *tpvRate); tpvs < due; tpvs++ {
+			t := start.Add(time.Duration(float64(tpvs) / *tpvRate * float64(time.Second)))
+			for _, device := range names {
+				g.buf = g.buf[:0]
+				g.tpv(device, tpvs, t)
+				_, err = w.Write(g.buf)
+				sent++
+			}
+		}
+		for due := int(elapsed.Seconds() * *skyRate); skies < due; skies++ {
+			t := start.Add(time.Duration(float64(skies) / *skyRate * float64(time.Second)))
+			for _, device := range names {
+				g.buf = g.buf[:0]
+				g.sky(device, skies, t)
+				_, err = w.Write(g.buf)
+				sent++
+			}
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			log.Fatalf("Error streaming to the exporter: %v", err)
+		}
+		if elapsed == *duration {
+			break
+		}
+	}
+	ticker.Stop()
+
+	// The exporter may still be working through its queue
+	var dropped int
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var m dto.Metric
+		_ = e.droppedLines.Write(&m)
+		dropped = int(m.GetCounter().GetValue())
+		if int(atomic.LoadUint64(&processed))+dropped >= sent {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	_ = conn.Close()
+
+	r := loadtestResult{
+		Duration:  elapsed.Seconds(),
+		Sent:      sent,
+		Processed: int(atomic.LoadUint64(&processed)),
+		Dropped:   dropped,
+		GCCycles:  after.NumGC - before.NumGC,
+		GCPause:   float64(after.PauseTotalNs-before.PauseTotalNs) / 1e9,
+		HeapBytes: after.HeapAlloc,
+	}
+	if r.Processed > 0 {
+		r.Throughput = float64(r.Processed) / elapsed.Seconds()
+		r.MeanParse = parseSeconds(registry) / float64(r.Processed)
+		r.AllocsPerMsg = float64(after.Mallocs-before.Mallocs) / float64(r.Processed)
+		r.BytesPerMsg = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Processed)
+	}
+
+	// A scrape of everything the reports created, as Prometheus would see it
+	scrapeStart := time.Now()
+	families, err := registry.Gather()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var scrape countingWriter
+	enc := expfmt.NewEncoder(&scrape, expfmt.FmtText)
+	for _, mf := range families {
+		_ = enc.Encode(mf)
+		r.Series += len(mf.GetMetric())
+	}
+	r.ScrapeDuration = time.Since(scrapeStart).Seconds()
+	r.ScrapeSizeBytes = int(scrape)
+
+	if *format == "json" {
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "  ")
+		_ = out.Encode(r)
+	} else {
+		fmt.Printf("Messages sent:       %d in %.1fs\n", r.Sent, r.Duration)
+		fmt.Printf("Messages processed:  %d (%.0f/s)\n", r.Processed, r.Throughput)
+		fmt.Printf("Messages dropped:    %d\n", r.Dropped)
+		fmt.Printf("Mean parse time:     %s\n", time.Duration(r.MeanParse*1e9))
+		fmt.Printf("Allocations:         %.1f per message, %.0f bytes per message\n", r.AllocsPerMsg, r.BytesPerMsg)
+		fmt.Printf("Garbage collection:  %d cycles, %s paused\n", r.GCCycles, time.Duration(r.GCPause*1e9))
+		fmt.Printf("Heap in use:         %d bytes\n", r.HeapBytes)
+		fmt.Printf("Scrape:              %d series, %d bytes in %s\n", r.Series, r.ScrapeSizeBytes, time.Duration(r.ScrapeDuration*1e9))
+	}
+
+	failed := false
+	if *maxAllocs > 0 && r.AllocsPerMsg > *maxAllocs {
+		log.Errorf("%.1f allocations per message exceed -max-allocs %.1f", r.AllocsPerMsg, *maxAllocs)
+		failed = true
+	}
+	if r.Sent > 0 && float64(r.Sent-r.Processed)/float64(r.Sent) > *maxDropped {
+		log.Errorf("%d of %d messages weren't processed, more than -max-dropped %g", r.Sent-r.Processed, r.Sent, *maxDropped)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseSeconds returns the time the exporter spent parsing TPV and SKY reports, from its own metrics
+func parseSeconds(registry *prometheus.Registry) float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		return 0
+	}
+	var seconds float64
+	for _, mf := range families {
+		if mf.GetName() != "gpsd_exporter_parse_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "class" && (l.GetValue() == "tpv" || l.GetValue() == "sky") {
+					seconds += m.GetHistogram().GetSampleSum()
+				}
+			}
+		}
+	}
+	return seconds
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter int
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
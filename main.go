@@ -1,44 +1,148 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	gpsdAddr      = flag.String("d", "localhost:2947", "gpsd address")
-	metricsListen = flag.String("l", ":9978", "metrics listen address")
-	pollInterval  = flag.Duration("p", time.Second*10, "gpsd poll interval")
-	verbose       = flag.Bool("v", false, "enable verbose logging")
-	trace         = flag.Bool("vv", false, "enable extra verbose logging")
+	dialTimeout          = flag.Duration("gpsd.dial-timeout", 5*time.Second, "timeout for each connection attempt to gpsd")
+	readTimeout          = flag.Duration("gpsd.read-timeout", time.Minute, "reconnect if nothing is received from gpsd for this long (0 to disable)")
+	writeTimeout         = flag.Duration("gpsd.write-timeout", 5*time.Second, "timeout for sending commands to gpsd")
+	proxyURL             = flag.String("gpsd.proxy", "", "proxy to connect to gpsd through (socks5://[user:pass@]host:port or http://[user:pass@]host:port)")
+	sshTarget            = flag.String("gpsd.ssh", "", "tunnel the gpsd connection through SSH to [user@]host[:port]")
+	sshKey               = flag.String("gpsd.ssh-key", "", "SSH private key file (default ~/.ssh/id_ed25519, id_ecdsa, or id_rsa)")
+	sshKnownHosts        = flag.String("gpsd.ssh-known-hosts", "", "SSH known hosts file (default ~/.ssh/known_hosts)")
+	stallTimeout         = flag.Duration("gpsd.stall-timeout", 2*time.Minute, "reconnect if no gpsd report is parsed for this long (0 to disable)")
+	strict               = flag.Bool("strict", false, "log and count unknown classes and fields received from gpsd, to notice protocol changes")
+	maxLineLength        = flag.Int("gpsd.max-line-length", 64*1024, "longest line accepted from gpsd in bytes, longer ones are discarded")
+	queueSize            = flag.Int("gpsd.queue-size", 1024, "number of lines read from gpsd that may wait to be parsed, further lines are dropped")
+	nmea2000             = flag.Bool("gpsd.nmea2000", false, "stream reports alongside polling to export the attitude of NMEA2000 devices as gpsd_n2k_*")
+	movingBase           = flag.Bool("gpsd.heading", false, "stream reports alongside polling to export the heading of dual-antenna moving-base receivers, such as u-blox F9P pairs, as gpsd_moving_base_heading_*")
+	strictVersion        = flag.Bool("gpsd.strict-version", false, "refuse to poll gpsd instances speaking an unsupported protocol version")
+	addressFile          = flag.String("gpsd.address-file", "", "file persisting gpsd addresses changed through the admin API across restarts (empty to not persist them)")
+	adminAllowedTargets  = flag.String("web.admin-allowed-targets", "", "comma separated gpsd addresses besides the targets that /api/v1/admin/address may point a target at")
+	targetsFile          = flag.String("targets.file", "", "JSON or YAML file listing further gpsd targets with labels, in Prometheus file_sd format, reloaded as it changes")
+	targetsRefresh       = flag.Duration("targets.refresh-interval", 5*time.Second, "interval between refreshes of discovered gpsd targets")
+	targetsSRV           = flag.String("targets.dns-srv", "", "DNS SRV record to discover further gpsd targets from, e.g. _gpsd._tcp.example.com")
+	consulService        = flag.String("targets.consul-service", "", "Consul service to discover further gpsd targets from, using the instances passing their health checks")
+	consulAddress        = flag.String("targets.consul-address", "localhost:8500", "Consul agent address as host:port or URL")
+	consulTokenFile      = flag.String("targets.consul-token-file", "", "file holding a Consul ACL token")
+	keepAlive            = flag.Duration("gpsd.keepalive", 30*time.Second, "TCP keepalive interval for the gpsd connection, also used for SSH keepalives with -gpsd.ssh (0 to disable)")
+	webListen            = flag.String("web.listen", ":9978", "metrics listen address, unix:/path for a Unix socket, or systemd for the socket passed by systemd socket activation (empty to disable the HTTP server)")
+	pollInterval         = flag.Duration("p", time.Second*10, "default gpsd poll interval")
+	devicesInterval      = flag.Duration("gpsd.devices-interval", time.Minute, "interval between ?DEVICES requests to notice devices added to or removed from gpsd (0 to disable)")
+	adaptivePoll         = flag.Bool("poll.adaptive", false, "poll every -poll.min-interval while a device is moving and every -poll.max-interval while all are stationary")
+	minPollInterval      = flag.Duration("poll.min-interval", 2*time.Second, "poll interval while a device is moving with -poll.adaptive")
+	maxPollInterval      = flag.Duration("poll.max-interval", 30*time.Second, "poll interval while all devices are stationary with -poll.adaptive")
+	verbose              = flag.Bool("v", false, "enable verbose logging")
+	trace                = flag.Bool("vv", false, "enable extra verbose logging")
+	legacyNames          = flag.Bool("metrics.legacy-names", false, "export metrics under their previous names and units (deprecated, to be removed in the next release)")
+	noGoCollector        = flag.Bool("metrics.disable-go-collector", false, "don't export Go runtime metrics")
+	noProcessCollector   = flag.Bool("metrics.disable-process-collector", false, "don't export process metrics")
+	nativeHistograms     = flag.Bool("metrics.native-histograms", false, "also export histograms as Prometheus native histograms (requires scraping with protobuf)")
+	pseudoranges         = flag.Bool("metrics.pseudoranges", false, "export the pseudorange, its rate and residual of each satellite, which add three per-satellite series")
+	receiverLabel        = flag.Bool("metrics.receiver-label", false, "label per-device metrics with the receiver gpsd identified behind the device, from its driver and subtype")
+	autoDiscover         = flag.Bool("metrics.auto-discover", false, "export numeric report fields unknown to this release as gpsd_<class>_<field>")
+	profile              = flag.String("profile", "full", "metrics to export: full, or minimal for only the fix mode, satellites used, position, horizontal error and PPS offset, to save memory on constrained devices")
+	satelliteMetrics     = flag.String("collector.satellites", "full", "per-satellite metrics to export: full, aggregate for only constellation counts and the SNR histogram, or off")
+	maxSatellites        = flag.Int("metrics.max-satellites", 256, "maximum number of distinct satellite PRNs to export, dropping further ones (0 for no limit)")
+	maxDevices           = flag.Int("metrics.max-devices", 16, "maximum number of distinct devices to export per target, dropping reports from further ones (0 for no limit)")
+	errorWindow          = flag.Duration("metrics.error-window", 10*time.Minute, "window over which quantiles of the position error estimates are computed")
+	debugMessages        = flag.Int("debug.messages", 0, "number of recent gpsd messages to keep for /debug/messages, which include positions unless -privacy.position limits them (0 to disable)")
+	textfileDir          = flag.String("textfile.directory", "", "periodically write metrics to gpsd.prom in this directory for node_exporter's textfile collector")
+	textfileInterval     = flag.Duration("textfile.interval", 15*time.Second, "interval between textfile writes")
+	webReadTimeout       = flag.Duration("web.read-timeout", 10*time.Second, "maximum time to read an HTTP request")
+	webWriteTimeout      = flag.Duration("web.write-timeout", 30*time.Second, "maximum time to serve an HTTP request, except the event stream (0 to disable)")
+	webIdleTimeout       = flag.Duration("web.idle-timeout", 2*time.Minute, "maximum time to keep idle HTTP connections open")
+	webMaxHeaderBytes    = flag.Int("web.max-header-bytes", 16<<10, "maximum size of HTTP request headers")
+	webMaxRequests       = flag.Int("web.max-requests", 10, "maximum number of concurrent scrapes, further scrapes get a 503 (0 for no limit)")
+	staleAction          = flag.String("metrics.stale-action", "delete", "how to expire stale metrics: delete the series or set them to nan")
+	resetOnDisconnect    = flag.Bool("metrics.reset-on-disconnect", false, "delete metrics derived from gpsd reports when the connection is lost")
+	adminAPI             = flag.Bool("web.enable-admin-api", false, "serve admin endpoints under /api/v1/admin and the effective configuration at /config")
+	rawCommands          = flag.Bool("web.enable-raw-commands", false, "allow sending raw commands to gpsd through /api/v1/admin/command (requires -web.enable-admin-api)")
+	deviceCommands       = flag.Bool("web.enable-device-commands", false, "also allow ?DEVICE commands that reconfigure a device through /api/v1/admin/command (requires -web.enable-raw-commands)")
+	adminTokenFile       = flag.String("web.admin-token-file", "", "file holding the bearer token required by the admin endpoints (required with -web.enable-admin-api)")
+	odometerMinStep      = flag.Float64("odometer.min-step", 5, "minimum movement in meters added to the distance traveled, larger than position noise when stationary")
+	odometerMaxEPH       = flag.Float64("odometer.max-eph", 50, "ignore fixes with a horizontal error estimate above this many meters for the distance traveled (0 to disable)")
+	odometerMaxSpeed     = flag.Float64("odometer.max-speed", 100, "ignore position jumps implying a speed above this many meters per second for the distance traveled")
+	averageWindow        = flag.Duration("position.average-window", 0, "window over which the error-weighted average position is computed, the target's current poll interval if zero")
+	referencePos         = flag.String("reference.position", "", "known position of a static antenna as lat,lon[,alt] to measure drift from")
+	stateFile            = flag.String("state.file", "", "file persisting the distance traveled, trip and fix loss counts, and maxima of each device across restarts (empty to disable)")
+	stateInterval        = flag.Duration("state.interval", time.Minute, "interval between saves of -state.file, which is also saved on SIGINT and SIGTERM")
+	referenceAuto        = flag.Duration("reference.auto", 0, "learn the reference position as the median position over this long after the first fix, unless -reference.position is set (0 to disable)")
+	referenceFile        = flag.String("reference.file", "gpsd-reference.json", "file persisting learned reference positions across restarts")
+	climbSamples         = flag.Int("motion.climb-samples", 10, "number of 3D fixes the smoothed climb rate is averaged over")
+	movingSpeed          = flag.Float64("motion.moving-speed", 1, "speed in meters per second above which a stationary device is considered moving")
+	stationarySpeed      = flag.Float64("motion.stationary-speed", 0.5, "speed in meters per second below which a moving device is considered stationary")
+	dgpsMaxAge           = flag.Duration("dgps.max-age", 30*time.Second, "age of DGPS corrections above which gpsd_dgps_corrections_stale is set")
+	ppsWatch             = flag.Bool("pps.watch", false, "have gpsd report every PPS pulse rather than only polling the latest, to count missing pulses")
+	ppsCadence           = flag.Duration("pps.interval", time.Second, "expected interval between PPS pulses with -pps.watch")
+	sectorWindow         = flag.Duration("sky.sector-window", time.Hour, "window over which the used satellites in each azimuth sector are averaged")
+	toffDriftWindow      = flag.Duration("toff.drift-window", 10*time.Minute, "window of TOFF offsets over which the frequency error of the system clock is estimated")
+	toffStepThreshold    = flag.Duration("toff.step-threshold", 128*time.Millisecond, "departure of a TOFF offset from the trend of the previous ones counted as a step of the system clock")
+	qErrWindow           = flag.Duration("pps.qerr-window", time.Minute, "window over which the RMS of the PPS quantization error is computed")
+	anomalyMaxSpeed      = flag.Float64("anomaly.max-speed", 300, "speed in meters per second between consecutive fixes above which a position jump is flagged as a possible spoofing sign (0 to disable)")
+	anomalyMaxTimeStep   = flag.Duration("anomaly.max-time-step", 3*time.Second, "difference between the GPS time and system time elapsed since the previous fix above which a time jump is flagged (0 to disable)")
+	headingTolerance     = flag.Float64("heading.tolerance", 1, "degrees the magnetic track may differ from the true track plus magnetic variation before gpsd_heading_inconsistent is set")
+	tripStartSpeed       = flag.Float64("trip.start-speed", 1, "speed in meters per second above which a device is moving and a trip starts")
+	tripDwell            = flag.Duration("trip.dwell", 5*time.Minute, "end a trip once the device has been below the start speed for this long")
+	historyRetention     = flag.Duration("history.retention", 0, "how long to keep the position history of each device in memory for /api/v1/history.geojson (0 to disable)")
+	historyInterval      = flag.Duration("history.interval", time.Second, "minimum time between positions kept in the position history")
+	tripHistory          = flag.Int("trip.history", 50, "number of completed trips to keep for /api/v1/trips")
+	kubernetes           = flag.Bool("kubernetes.labels", false, "label every metric with the Kubernetes node, namespace, and pod from the NODE_NAME, POD_NAMESPACE, and POD_NAME environment variables")
+	kubernetesPodLabels  = flag.String("kubernetes.pod-labels", "", "comma separated pod labels to add as kubernetes_label_<name> from -kubernetes.labels-file")
+	kubernetesLabelsFile = flag.String("kubernetes.labels-file", "/etc/podinfo/labels", "pod labels file projected by a Downward API volume")
+	relayListen          = flag.String("relay.listen", "", "TCP address to re-serve the JSON reports of the gpsd target to gpsd clients such as xgps on, such as :2948 (empty to disable)")
+	snmpListen           = flag.String("snmp.listen", "", "UDP address to answer SNMPv1/v2c requests for the gpsd MIB on, such as :161 (empty to disable)")
+	snmpCommunity        = flag.String("snmp.community", "", "SNMP community required by the agent, which refuses to start without one")
+	snmpOIDPrefix        = flag.String("snmp.oid-prefix", "1.3.6.1.4.1.32473.2947", "OID the gpsd MIB is rooted at, under your own enterprise number (the default is the documentation one)")
+	snmpPPSTimeout       = flag.Duration("snmp.pps-timeout", 30*time.Second, "time without a PPS report after which the SNMP PPS status is missing")
+	apiTokenFile         = flag.String("web.api-token-file", "", "file holding a bearer token required by the JSON, streaming and debug endpoints, which browsers can exchange for a session cookie at /api/v1/session")
+	corsOrigins          = flag.String("web.cors-origins", "", "comma separated origins allowed to make cross-origin requests to the JSON and streaming endpoints, or * for any")
+	webUI                = flag.Bool("web.ui", false, "serve the web UI at /ui and the event stream at /api/v1/stream")
 )
 
 var (
-	metricLastPoll = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "gpsd_last_poll",
-		Help: "Last time the GPSD daemon was polled",
-	})
-	metricVersion = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "gpsd_version",
-		Help: "GPSD version",
-	}, []string{"version"})
+	gpsdTargets   targetsFlag
+	nmeaInputs    inputsFlag
+	deviceConfigs deviceConfigsFlag
+	staleness     = stalenessFlag{}
+	privacy       = privacyFlag{mode: "off"}
+	dopThresholds = dopThresholdsFlag{}
+	smoothing     = smoothingFlag{mode: "off"}
+	watchOptions  = watchOptionsFlag{}
 )
 
-var (
-	dynMetricGauges    = map[string]prometheus.Gauge{}
-	dynMetricGaugeVecs = map[string]*prometheus.GaugeVec{}
-)
+func init() {
+	flag.StringVar(webListen, "l", *webListen, "deprecated alias of -web.listen")
+	flag.Var(&gpsdTargets, "d", "gpsd address as host, host:port, or IPv6 literal, optionally followed by @interval to override the poll interval (repeatable, default localhost:2947 unless an -input is given)")
+	flag.Var(watchOptions, "gpsd.watch", "WATCH options to enable on every connection: scaled, split24, pps, or timing (comma separated or repeatable)")
+	flag.Var(&deviceConfigs, "gpsd.device-config", "configure a device through gpsd on connect as path,key=value,... with bps, parity, stopbits, native, or cycle (repeatable)")
+	flag.Var(staleness, "metrics.stale-after", "expire metrics of a report class when no new report arrives for this long, as a duration for all classes or class=duration (comma separated or repeatable)")
+	flag.Var(dopThresholds, "dop.threshold", "count periods of poor satellite geometry when a DOP rises above a threshold, as dop=value with gdop, hdop, pdop, tdop, vdop, xdop, or ydop (comma separated or repeatable)")
+	flag.Var(&smoothing, "smoothing", "smooth exported positions and speeds with an exponential filter (alpha:A, 0 < A <= 1) or a Kalman filter using the error estimates (kalman:Q, variance growth in m² per second), exporting raw values with a _raw suffix (default off)")
+	flag.Var(&privacy, "privacy.position", "export positions as is (off), truncated to N decimal places (truncate:N), or not at all (redact)")
+	flag.Var(&nmeaInputs, "input", "read NMEA sentences instead of gpsd, listening on udp-nmea://[host]:port or connecting to tcp-nmea://host:port (repeatable)")
+}
 
 func main() {
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "l" {
+			log.Warn("-l is deprecated, use -web.listen instead")
+		}
+	})
+	if *ppsWatch {
+		watchOptions["pps"] = true
+	}
 	if *verbose {
 		log.SetLevel(log.DebugLevel)
 		log.Debug("Running in verbose mode")
@@ -48,54 +152,247 @@ func main() {
 		log.Debug("Running in trace mode")
 	}
 
-	var conn net.Conn
-	var scanner *bufio.Scanner
-	go func() {
-		for {
-			if conn == nil {
-				log.Infof("Connecting to gpsd on %s", *gpsdAddr)
-				var err error
-				conn, err = net.Dial("tcp", *gpsdAddr)
-				if err != nil {
-					log.Fatal(err)
-				}
-				if _, err := conn.Write([]byte("?WATCH={\"enable\": true}\n?POLL;\n")); err != nil {
-					log.Warnf("Error sending POLL command: %v", err)
-					_ = conn.Close()
-					conn = nil
-				}
-				rdr := bufio.NewReader(conn)
-				scanner = bufio.NewScanner(rdr)
-				scanner.Split(bufio.ScanLines)
-			}
-			for scanner.Scan() {
-				processLine(scanner.Text())
-			}
-		}
-	}()
-
-	// Poll for updates
-	pollTicker := time.NewTicker(*pollInterval)
-	go func() {
-		log.Debug("Starting poll ticker")
-		for range pollTicker.C {
-			if conn != nil {
-				log.Debug("Sending POLL command")
-				if _, err := conn.Write([]byte("?WATCH={\"enable\": true}\n?POLL;\n")); err != nil {
-					log.Warnf("Error sending POLL command: %v", err)
-					_ = conn.Close()
-					conn = nil
-				}
-				metricLastPoll.Set(float64(time.Now().UTC().UnixNano() / 1000000))
-			} else {
-				log.Debug("Not connected, not sending POLL command")
-			}
-		}
-	}()
+	if flag.Arg(0) == "rules" {
+		runRules(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "docs" {
+		runDocs(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "dump" {
+		runDump(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "survey" {
+		runSurvey(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "loadtest" {
+		runLoadtest(flag.Args()[1:])
+		return
+	}
+
+	if *webUI {
+		events = newEventStream()
+	}
+	if *debugMessages > 0 {
+		recentMessages = newMessageRing(*debugMessages)
+	}
+
+	if *staleAction != "delete" && *staleAction != "nan" {
+		log.Fatalf("Invalid -metrics.stale-action %q (expected delete or nan)", *staleAction)
+	}
+	if *adaptivePoll && (*minPollInterval <= 0 || *maxPollInterval < *minPollInterval) {
+		log.Fatalf("Invalid -poll.min-interval %s and -poll.max-interval %s (expected 0 < min <= max)", *minPollInterval, *maxPollInterval)
+	}
+	if *profile != "full" && *profile != "minimal" {
+		log.Fatalf("Invalid -profile %q (expected full or minimal)", *profile)
+	}
+	if *satelliteMetrics != "full" && *satelliteMetrics != "aggregate" && *satelliteMetrics != "off" {
+		log.Fatalf("Invalid -collector.satellites %q (expected full, aggregate, or off)", *satelliteMetrics)
+	}
+	if *maxLineLength < 256 {
+		log.Fatalf("-gpsd.max-line-length must be at least 256")
+	}
+	if *queueSize < 1 {
+		log.Fatalf("-gpsd.queue-size must be at least 1")
+	}
+	if *climbSamples < 1 {
+		log.Fatalf("-motion.climb-samples must be at least 1")
+	}
+	if *stationarySpeed > *movingSpeed {
+		log.Fatalf("-motion.stationary-speed must not be above -motion.moving-speed")
+	}
+	if *adminAPI && *adminTokenFile == "" {
+		log.Fatalf("-web.enable-admin-api requires -web.admin-token-file")
+	}
+
+	if *kubernetes {
+		var podLabels []string
+		if *kubernetesPodLabels != "" {
+			podLabels = strings.Split(*kubernetesPodLabels, ",")
+		}
+		labels, err := kubernetesLabels(*kubernetesLabelsFile, podLabels)
+		if err != nil {
+			log.Fatalf("Error reading pod labels: %v", err)
+		}
+		constLabels = labels
+		log.Debugf("Labeling metrics with %v", constLabels)
+	}
+	registry := prometheus.NewRegistry()
+	root := withConstLabels(registry)
+	if !*noGoCollector {
+		root.MustRegister(collectors.NewGoCollector())
+	}
+	if !*noProcessCollector {
+		root.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
+
+	if len(gpsdTargets) == 0 && len(nmeaInputs) == 0 && !discovering() {
+		_ = gpsdTargets.Set("localhost:2947")
+	}
+	dialer, err := newDialer(*proxyURL, *sshTarget)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *relayListen != "" {
+		if len(gpsdTargets) != 1 || len(nmeaInputs) > 0 || discovering() {
+			log.Fatal("-relay.listen requires exactly one gpsd target")
+		}
+		l, err := net.Listen("tcp", *relayListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		relay = newLineRelay(root)
+		log.Infof("Relaying gpsd reports on %s", *relayListen)
+		go relay.serve(l)
+	}
+	sources := &sourceSet{}
+	for _, t := range gpsdTargets {
+		// Label each target's metrics when exporting more than one
+		reg := root
+		if multipleSources() {
+			reg = prometheus.WrapRegistererWith(prometheus.Labels{"target": t.addr}, reg)
+		}
+		client, err := startTarget(t, reg, dialer, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources.add(client.exporter, client)
+	}
+	if *targetsFile != "" {
+		go sources.watchTargets(*targetsFile, *targetsRefresh, dialer, func() (map[string]discoveredTarget, error) {
+			return readTargetsFile(*targetsFile)
+		})
+	}
+	if *targetsSRV != "" {
+		go sources.watchTargets("DNS SRV "+*targetsSRV, *targetsRefresh, dialer, func() (map[string]discoveredTarget, error) {
+			return lookupSRV(*targetsSRV)
+		})
+	}
+	if *consulService != "" {
+		token, err := readToken(*consulTokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go sources.watchTargets("Consul service "+*consulService, *targetsRefresh, dialer, func() (map[string]discoveredTarget, error) {
+			return lookupConsul(*consulAddress, *consulService, token)
+		})
+	}
+
+	for _, in := range nmeaInputs {
+		reg := root
+		if multipleSources() {
+			reg = prometheus.WrapRegistererWith(prometheus.Labels{"target": in.url}, reg)
+		}
+		in.dialer = dialer
+		in.exporter = newExporter(in.url, reg)
+		if err := in.exporter.loadReference(); err != nil {
+			log.Fatal(err)
+		}
+		if err := in.exporter.loadState(); err != nil {
+			log.Fatal(err)
+		}
+		sources.add(in.exporter, nil)
+		if len(staleness) > 0 {
+			go in.exporter.supervise("expire", nil, func() { in.exporter.expireStale(nil) })
+		}
+		go in.exporter.superviseErr("connection", nil, in.run)
+	}
+
+	var gatherer prometheus.Gatherer = prometheus.Gatherers{registry, sources}
+	if *receiverLabel {
+		gatherer = receiverGatherer{gatherer}
+	}
+	if *stateFile != "" {
+		go persistState(sources, *stateInterval)
+	}
+	if *textfileDir != "" {
+		go writeTextfile(*textfileDir, *textfileInterval, gatherer)
+	}
+	if *webListen == "" {
+		select {}
+	}
 
 	// Metrics server
 	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", promhttp.Handler())
-	log.Infof("Starting metrics exporter on %s/metrics", *metricsListen)
-	log.Fatal(http.ListenAndServe(*metricsListen, metricsMux))
+	metricsMux.Handle("/metrics", metricsHandler(root, gatherer))
+	apiToken, err := readToken(*apiTokenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api := newAPIAccess(apiToken, *corsOrigins)
+	metricsMux.Handle("/api/v1/metric-catalog", api.wrap(http.HandlerFunc(catalogHandler)))
+	metricsMux.Handle("/api/v1/trips", api.wrap(tripsHandler(sources)))
+	if *historyRetention > 0 {
+		metricsMux.Handle("/api/v1/history.geojson", api.wrap(historyHandler(sources)))
+	}
+	if *webUI {
+		ui := uiHandler()
+		metricsMux.Handle("/ui", ui)
+		metricsMux.Handle("/ui/", ui)
+		log.Infof("Serving web UI on %s/ui", *webListen)
+	}
+	metricsMux.Handle("/api/v1/session", api.wrap(http.HandlerFunc(api.sessionHandler)))
+	if recentMessages != nil {
+		metricsMux.Handle("/debug/messages", api.wrap(recentMessages))
+	}
+	metricsMux.Handle("/debug/connections", api.wrap(connectionsHandler(sources)))
+	if *adminAPI {
+		token, err := readToken(*adminTokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		metricsMux.HandleFunc("/api/v1/admin/reset", adminHandler(token, adminResetHandler(sources)))
+		metricsMux.HandleFunc("/api/v1/admin/reset-maxima", adminHandler(token, adminResetMaximaHandler(sources)))
+		metricsMux.HandleFunc("/api/v1/admin/reconnect", adminHandler(token, adminClientsHandler(sources, "reconnect to", (*gpsdClient).reconnect)))
+		metricsMux.HandleFunc("/api/v1/admin/address", adminHandler(token, adminAddressHandler(sources)))
+		metricsMux.HandleFunc("/api/v1/admin/poll", adminHandler(token, adminClientsHandler(sources, "poll", pollNow)))
+		if *rawCommands {
+			metricsMux.HandleFunc("/api/v1/admin/command", adminHandler(token, adminCommandHandler(sources)))
+		}
+		metricsMux.HandleFunc("/config", authenticated(token, configHandler(sources)))
+	}
+	handler := withWriteTimeout(metricsMux)
+	if *webUI {
+		// The event stream stays open, so it's served outside the write timeout
+		root := http.NewServeMux()
+		root.Handle("/api/v1/stream", api.wrap(events))
+		root.Handle("/", handler)
+		handler = root
+	}
+
+	if *snmpListen != "" {
+		if *snmpCommunity == "" {
+			log.Fatalf("-snmp.listen requires -snmp.community")
+		}
+		prefix, err := parseOID(*snmpOIDPrefix)
+		if err != nil {
+			log.Fatalf("Invalid -snmp.oid-prefix: %v", err)
+		}
+		conn, err := net.ListenPacket("udp", *snmpListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("Starting SNMP agent on %s under %s", *snmpListen, prefix)
+		go (&snmpAgent{community: *snmpCommunity, prefix: prefix, sources: sources}).serve(conn)
+	}
+
+	listener, err := listen(*webListen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Starting metrics exporter on %s/metrics", *webListen)
+	log.Fatal(newServer(handler).Serve(listener))
+}
+
+// multipleSources reports whether metrics need a target label to tell gpsd instances and NMEA inputs apart
+func multipleSources() bool {
+	return len(gpsdTargets)+len(nmeaInputs) > 1 || discovering()
+}
+
+// discovering reports whether gpsd targets are discovered at runtime
+func discovering() bool {
+	return *targetsFile != "" || *targetsSRV != "" || *consulService != ""
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// message is a raw line received from gpsd
+type message struct {
+	Time   time.Time `json:"time"`
+	Target string    `json:"target"`
+	Line   string    `json:"line"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// messageRing keeps the most recent messages received from gpsd
+type messageRing struct {
+	mu       sync.Mutex
+	messages []message
+	next     int
+	full     bool
+}
+
+// recentMessages is nil when the ring buffer is disabled
+var recentMessages *messageRing
+
+func newMessageRing(size int) *messageRing {
+	return &messageRing{messages: make([]message, size)}
+}
+
+// add records a line from target and the result of parsing it
+func (r *messageRing) add(target, line string, err error) {
+	if r == nil {
+		return
+	}
+	m := message{Time: time.Now().UTC(), Target: target, Line: privacy.filterLine(line)}
+	if err != nil {
+		m.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages[r.next] = m
+	r.next = (r.next + 1) % len(r.messages)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the buffered messages, oldest first
+func (r *messageRing) list() []message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]message{}, r.messages[:r.next]...)
+	}
+	return append(append([]message{}, r.messages[r.next:]...), r.messages[:r.next]...)
+}
+
+// ServeHTTP writes the buffered messages as JSON
+func (r *messageRing) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(r.list())
+}
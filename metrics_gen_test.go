@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// benchTPV and benchSKY are a typical 3D fix and sky view with 20 satellites
+var (
+	benchTPV = &TPV{
+		Device: "/dev/ttyACM0", Mode: 3, Status: 1, Time: "2024-06-01T12:00:00.000Z",
+		Lat: 37.7749, Lon: -122.4194, AltHAE: 30.1, AltMSL: 62.3, EPH: 3.1, EPV: 5.1, EPX: 2.1, EPY: 2.5,
+		Track: 90, MagTrack: 103, MagVar: 13, Speed: 1.2, Climb: 0.1, EPS: 0.4, EPC: 10.2, GeoidSep: -32.2,
+	}
+	benchSKY = func() *SKY {
+		sky := &SKY{Device: "/dev/ttyACM0", Time: "2024-06-01T12:00:00.000Z", HDOP: 0.9, VDOP: 1.1, PDOP: 1.4, GDOP: 1.7, TDOP: 0.9, XDOP: 0.6, YDOP: 0.7}
+		for i := 1; i <= 20; i++ {
+			sky.Satellites = append(sky.Satellites, Satellite{PRN: float64(i), Elevation: float64(i * 4), Azimuth: float64(i * 17), SNR: 20 + float64(i), Used: i%2 == 0})
+		}
+		sky.NSat, sky.USat = 20, 10
+		return sky
+	}()
+)
+
+// reflectUpdate sets the metrics of a report by walking its fields with reflection and resolving metric names per report,
+// as updateMetrics did before update functions were generated. It's the baseline BenchmarkUpdateMetrics compares against.
+func reflectUpdate(gauges map[string]prometheus.Gauge, vecs map[string]*prometheus.GaugeVec, report any, namespace string) {
+	v := reflect.ValueOf(report).Elem()
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field, sf := v.Field(i), t.Field(i)
+		jsonField := sf.Tag.Get("json")
+		ns := namespace
+		if tag := sf.Tag.Get("namespace"); tag != "" {
+			ns = tag
+		}
+		key, scale := metricName(ns, jsonField)
+		g, ok := gauges[key]
+		if !ok && (field.Kind() == reflect.Float64 || jsonField == "time") {
+			g = prometheus.NewGauge(prometheus.GaugeOpts{Name: key, Help: fieldHelp(ns, jsonField, sf.Tag.Get("description"))})
+			gauges[key] = g
+		}
+		switch field.Kind() {
+		case reflect.Float64:
+			g.Set(field.Float() * scale)
+		case reflect.String:
+			if jsonField == "time" {
+				if ts, err := parseTime(field.String()); err == nil {
+					g.Set(float64(ts.UnixNano()) / 1e9)
+				}
+			}
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				sat := field.Index(j).Interface().(Satellite)
+				sv := reflect.ValueOf(&sat).Elem()
+				for k := 0; k < sv.NumField(); k++ {
+					satField := sv.Type().Field(k).Tag.Get("json")
+					if satField == "PRN" {
+						continue
+					}
+					satKey, satScale := metricName("sat", satField)
+					vec, ok := vecs[satKey]
+					if !ok {
+						vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: satKey, Help: satKey}, []string{"prn"})
+						vecs[satKey] = vec
+					}
+					value := 0.0
+					switch f := sv.Field(k); f.Kind() {
+					case reflect.Bool:
+						if f.Bool() {
+							value = 1
+						}
+					case reflect.Float64:
+						value = f.Float() * satScale
+					}
+					vec.With(prometheus.Labels{"prn": strconv.Itoa(int(sat.PRN))}).Set(value)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkUpdateMetrics(b *testing.B) {
+	for _, report := range []struct {
+		name      string
+		namespace string
+		report    any
+	}{
+		{"TPV", "tpv", benchTPV},
+		{"SKY", "sky", benchSKY},
+	} {
+		b.Run(report.name+"/generated", func(b *testing.B) {
+			e := newExporter("localhost:2947", prometheus.NewRegistry())
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				e.updateMetrics(report.report)
+			}
+		})
+		b.Run(report.name+"/reflection", func(b *testing.B) {
+			gauges, vecs := map[string]prometheus.Gauge{}, map[string]*prometheus.GaugeVec{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				reflectUpdate(gauges, vecs, report.report, report.namespace)
+			}
+		})
+	}
+}
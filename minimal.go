@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// minimalFields are the report fields exported with -profile minimal
+var minimalFields = []*reportField{fieldTPVMode, fieldTPVLat, fieldTPVLon, fieldTPVEPH, fieldSKYUSat}
+
+// minimalMetrics are the gauges of the report fields exported with -profile minimal, created up front so reports never create metrics
+type minimalMetrics map[*reportField]prometheus.Gauge
+
+// newMinimalMetrics registers the gauges of -profile minimal with reg, under the same names as the full profile
+func newMinimalMetrics(reg prometheus.Registerer) minimalMetrics {
+	factory := promauto.With(reg)
+	m := minimalMetrics{}
+	for _, f := range minimalFields {
+		if privacy.redacts(f.namespace, f.field) {
+			continue
+		}
+		f.resolve()
+		m[f] = factory.NewGauge(prometheus.GaugeOpts{Name: f.name, Help: f.help})
+	}
+	return m
+}
+
+func (m minimalMetrics) set(f *reportField, v float64) {
+	if g, ok := m[f]; ok {
+		g.Set(v * f.scale)
+	}
+}
+
+// updateMinimal exports the fields of a report in the fixed set of -profile minimal
+func (e *exporter) updateMinimal(report any) {
+	switch r := report.(type) {
+	case *TPV:
+		e.minimal.set(fieldTPVMode, r.Mode)
+		e.minimal.set(fieldTPVLat, r.Lat)
+		e.minimal.set(fieldTPVLon, r.Lon)
+		e.minimal.set(fieldTPVEPH, r.EPH)
+	case *SKY:
+		e.minimal.set(fieldSKYUSat, r.USat)
+	case *PPS:
+		e.observePPSOffset(r)
+	}
+}
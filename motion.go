@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// earthRadius is the WGS84 mean radius in meters
+const earthRadius = 6371008.8
+
+// motionState tracks the movement of a device across TPV reports
+type motionState struct {
+	// Position the odometer last advanced from
+	anchored   bool
+	anchorLat  float64
+	anchorLon  float64
+	anchorTime time.Time
+
+	// Maxima since the exporter started or they were reset
+	maxSpeed    float64
+	maxAltitude float64
+	hasAltitude bool
+
+	climbs                 []float64        // Climb rates of the latest 3D fixes, oldest first
+	samples                []positionSample // Fixes within the average window, oldest first
+	averaged               bool             // Set once the average position is known
+	averageLat, averageLon float64
+
+	// Moving state with hysteresis, and when the device last stopped
+	moving          bool
+	stationarySince time.Time
+
+	trip       *trip     // Trip in progress, nil when stopped
+	lastMoving time.Time // Time of the last fix above the trip start speed
+}
+
+// distance returns the great-circle distance in meters between two positions in degrees
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// fixTime returns the time of a TPV fix, or false if it has no usable position
+func fixTime(tpv *TPV) (time.Time, bool) {
+	if tpv.Mode < 2 || (tpv.Lat == 0 && tpv.Lon == 0) {
+		return time.Time{}, false
+	}
+	t, err := parseTime(tpv.Time)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// updateMotion updates the movement metrics of a device from a new TPV report, which must be called with reportMu held
+func (e *exporter) updateMotion(tpv *TPV) {
+	t, ok := fixTime(tpv)
+	if !ok {
+		return
+	}
+	m, ok := e.motion[tpv.Device]
+	if !ok {
+		m = &motionState{}
+		e.motion[tpv.Device] = m
+	}
+	e.updateMaxima(m, tpv)
+	e.updateAverage(m, tpv, t)
+	e.updateReference(m, tpv, t)
+	e.updateVelocity(m, tpv)
+	e.updateHeading(tpv)
+	e.updateMoving(m, tpv, t)
+	d := e.updateOdometer(m, tpv, t)
+	e.updateTrip(m, tpv, t, d)
+}
+
+// updateOdometer adds the distance moved since the anchor position once it exceeds the position noise, returning the distance added.
+// Jumps faster than the maximum speed, as seen while a receiver acquires its first good fix, move the anchor without adding distance.
+func (e *exporter) updateOdometer(m *motionState, tpv *TPV, t time.Time) float64 {
+	if !m.anchored || t.Before(m.anchorTime) {
+		m.anchored, m.anchorLat, m.anchorLon, m.anchorTime = true, tpv.Lat, tpv.Lon, t
+		return 0
+	}
+	if tpv.EPH > *odometerMaxEPH && *odometerMaxEPH > 0 {
+		return 0
+	}
+
+	d := distance(m.anchorLat, m.anchorLon, tpv.Lat, tpv.Lon)
+	if d < *odometerMinStep || d < tpv.EPH {
+		return 0
+	}
+	dt := t.Sub(m.anchorTime).Seconds()
+	m.anchorLat, m.anchorLon, m.anchorTime = tpv.Lat, tpv.Lon, t
+	if dt > 0 && d/dt > *odometerMaxSpeed {
+		log.Debugf("Ignoring %.0fm jump in %.1fs from %s", d, dt, tpv.Device)
+		return 0
+	}
+	e.distance.WithLabelValues(tpv.Device).Add(d)
+	return d
+}
+
+// updateMaxima raises the session maximum speed and altitude of a device, only trusting altitudes from 3D fixes
+func (e *exporter) updateMaxima(m *motionState, tpv *TPV) {
+	if tpv.Speed > m.maxSpeed {
+		m.maxSpeed = tpv.Speed
+	}
+	e.series(e.maxSpeed, tpv.Device).Set(m.maxSpeed)
+
+	alt := tpv.AltMSL
+	if alt == 0 {
+		alt = tpv.AltHAE
+	}
+	if tpv.Mode < 3 || alt == 0 {
+		return
+	}
+	if !m.hasAltitude || alt > m.maxAltitude {
+		m.maxAltitude, m.hasAltitude = alt, true
+	}
+	e.series(e.maxAltitude, tpv.Device).Set(m.maxAltitude)
+}
+
+// resetMaxima restarts the session maximum speed and altitude of every device from the next fix
+func (e *exporter) resetMaxima() {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	for _, m := range e.motion {
+		m.maxSpeed, m.maxAltitude, m.hasAltitude = 0, 0, false
+	}
+	e.dropVec(e.maxSpeed)
+	e.dropVec(e.maxAltitude)
+}
+
+// updateMoving switches a device to moving above the moving speed and back to stationary below the stationary speed,
+// so speed noise around a single threshold doesn't flap the state
+func (e *exporter) updateMoving(m *motionState, tpv *TPV, t time.Time) {
+	switch {
+	case !m.moving && tpv.Speed >= *movingSpeed:
+		m.moving = true
+	case m.moving && tpv.Speed < *stationarySpeed, !m.moving && m.stationarySince.IsZero():
+		m.moving, m.stationarySince = false, t
+	}
+
+	if m.moving {
+		e.series(e.moving, tpv.Device).Set(1)
+		e.series(e.stationaryDuration, tpv.Device).Set(0)
+		return
+	}
+	e.series(e.moving, tpv.Device).Set(0)
+	e.series(e.stationaryDuration, tpv.Device).Set(t.Sub(m.stationarySince).Seconds())
+}
+
+// updateVelocity exports the 3D speed and the climb rate averaged over recent fixes, since the instantaneous climb of consumer receivers is noisy
+func (e *exporter) updateVelocity(m *motionState, tpv *TPV) {
+	if tpv.Mode < 3 {
+		return // Vertical velocity needs a 3D fix
+	}
+	north, east, down := tpv.VelN, tpv.VelE, tpv.VelD
+	if north == 0 && east == 0 && down == 0 {
+		// Receivers without velocity components still report speed and climb
+		north, down = tpv.Speed, -tpv.Climb
+	}
+	e.series(e.velocity3D, tpv.Device).Set(math.Sqrt(north*north + east*east + down*down))
+
+	m.climbs = append(m.climbs, tpv.Climb)
+	if len(m.climbs) > *climbSamples {
+		m.climbs = m.climbs[len(m.climbs)-*climbSamples:]
+	}
+	var sum float64
+	for _, climb := range m.climbs {
+		sum += climb
+	}
+	e.series(e.climbSmoothed, tpv.Device).Set(sum / float64(len(m.climbs)))
+}
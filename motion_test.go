@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatheredValue returns the value of the counter or gauge name for device, or false if it isn't exported
+func gatheredValue(t *testing.T, reg *prometheus.Registry, name, device string) (float64, bool) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "device" && l.GetValue() == device {
+					return m.GetCounter().GetValue() + m.GetGauge().GetValue(), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestOdometer(t *testing.T) {
+	const device = "/dev/ttyACM0"
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	// fix is a position north of the start, in meters, with its horizontal error estimate
+	type fix struct{ north, eph float64 }
+	lat := func(north float64) float64 { return 37.7749 + north/earthRadius*180/math.Pi }
+	for _, tt := range []struct {
+		name  string
+		fixes []fix
+		want  float64 // Meters
+	}{
+		{name: "driving", fixes: []fix{{0, 3}, {100, 3}, {200, 3}, {300, 3}}, want: 300},
+		{name: "bad fix jump", fixes: []fix{{0, 3}, {100, 3}, {5000, 800}, {200, 3}, {300, 3}}, want: 300},
+		{name: "jump faster than the maximum speed", fixes: []fix{{0, 3}, {100, 3}, {20000, 3}, {200, 3}, {300, 3}, {400, 3}}, want: 300},
+		{name: "first fix off", fixes: []fix{{-30000, 3}, {0, 3}, {100, 3}}, want: 100},
+		{name: "stationary noise", fixes: []fix{{0, 3}, {2, 3}, {-1, 3}, {3, 3}}},
+		{name: "moves within the error estimate", fixes: []fix{{0, 30}, {20, 30}, {10, 30}, {25, 30}}},
+		{name: "no fix", fixes: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			e := newExporter("localhost:2947", reg)
+			for i, f := range tt.fixes {
+				e.handleReport("tpv", &TPV{
+					Device: device,
+					Mode:   3,
+					Time:   start.Add(time.Duration(i) * 10 * time.Second).Format(time.RFC3339Nano),
+					Lat:    lat(f.north),
+					Lon:    -122.4194,
+					EPH:    f.eph,
+				})
+			}
+			got, _ := gatheredValue(t, reg, "gpsd_distance_traveled_meters_total", device)
+			if math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("traveled %.2fm, want %.2fm", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fieldMetric describes the conventional metric name and unit for a gpsd report field
+type fieldMetric struct {
+	name  string         // Base name in snake case
+	unit  string         // Base unit suffix, empty for dimensionless values
+	scale float64        // Multiplier converting gpsd's unit to the base unit, zero for none
+	enum  map[int]string // Meaning of each value of an enumerated field
+}
+
+// Meanings of the values of enumerated fields
+var (
+	modeEnum       = map[int]string{0: "unknown", 1: "no fix", 2: "2D", 3: "3D"}
+	statusEnum     = map[int]string{0: "unknown", 1: "normal", 2: "DGPS", 3: "RTK fixed", 4: "RTK floating", 5: "DR", 6: "GNSSDR", 7: "time (surveyed)", 8: "simulated", 9: "P(Y)"}
+	antennaEnum    = map[int]string{0: "unknown", 1: "OK", 2: "open", 3: "short"}
+	baseStatusEnum = map[int]string{0: "no corrections", 1: "float", 2: "fixed"}
+	qualityEnum    = map[int]string{
+		0: "no signal",
+		1: "searching signal",
+		2: "signal acquired",
+		3: "signal detected but unusable",
+		4: "code locked and time synchronized",
+		5: "code and carrier locked and time synchronized",
+		6: "code and carrier locked and time synchronized",
+		7: "code and carrier locked and time synchronized",
+	}
+	healthEnum = map[int]string{0: "unknown", 1: "OK", 2: "unhealthy"}
+)
+
+// fieldMetrics maps namespace.jsonField to the metric exported for it
+var fieldMetrics = map[string]fieldMetric{
+	// TPV
+	"tpv.mode":        {name: "mode", enum: modeEnum},
+	"tpv.status":      {name: "status", enum: statusEnum},
+	"tpv.time":        {name: "timestamp", unit: "seconds"},
+	"tpv.altHAE":      {name: "altitude_hae", unit: "meters"},
+	"tpv.altMSL":      {name: "altitude_msl", unit: "meters"},
+	"tpv.climb":       {name: "climb", unit: "meters_per_second"},
+	"tpv.dgpsAge":     {name: "dgps_age", unit: "seconds"},
+	"tpv.epc":         {name: "climb_error", unit: "meters_per_second"},
+	"tpv.epd":         {name: "track_error", unit: "degrees"},
+	"tpv.eph":         {name: "horizontal_error", unit: "meters"},
+	"tpv.eps":         {name: "speed_error", unit: "meters_per_second"},
+	"tpv.ept":         {name: "time_error", unit: "seconds"},
+	"tpv.epx":         {name: "longitude_error", unit: "meters"},
+	"tpv.epy":         {name: "latitude_error", unit: "meters"},
+	"tpv.epv":         {name: "vertical_error", unit: "meters"},
+	"tpv.geoidSep":    {name: "geoid_separation", unit: "meters"},
+	"tpv.lat":         {name: "latitude", unit: "degrees"},
+	"tpv.leapseconds": {name: "leap", unit: "seconds"},
+	"tpv.lon":         {name: "longitude", unit: "degrees"},
+	"tpv.track":       {name: "track", unit: "degrees"},
+	"tpv.magtrack":    {name: "magnetic_track", unit: "degrees"},
+	"tpv.magvar":      {name: "magnetic_variation", unit: "degrees"},
+	"tpv.speed":       {name: "speed", unit: "meters_per_second"},
+	"tpv.ecefx":       {name: "ecef_x", unit: "meters"},
+	"tpv.ecefy":       {name: "ecef_y", unit: "meters"},
+	"tpv.ecefz":       {name: "ecef_z", unit: "meters"},
+	"tpv.ecefpAcc":    {name: "ecef_position_error", unit: "meters"},
+	"tpv.ecefvx":      {name: "ecef_velocity_x", unit: "meters_per_second"},
+	"tpv.ecefvy":      {name: "ecef_velocity_y", unit: "meters_per_second"},
+	"tpv.ecefvz":      {name: "ecef_velocity_z", unit: "meters_per_second"},
+	"tpv.ecefvAcc":    {name: "ecef_velocity_error", unit: "meters_per_second"},
+	"tpv.sep":         {name: "spherical_error", unit: "meters"},
+	"tpv.relD":        {name: "relative_down", unit: "meters"},
+	"tpv.relE":        {name: "relative_east", unit: "meters"},
+	"tpv.relN":        {name: "relative_north", unit: "meters"},
+	"tpv.velD":        {name: "velocity_down", unit: "meters_per_second"},
+	"tpv.velE":        {name: "velocity_east", unit: "meters_per_second"},
+	"tpv.velN":        {name: "velocity_north", unit: "meters_per_second"},
+	"tpv.ant":         {name: "antenna_status", enum: antennaEnum},
+	"tpv.temp":        {name: "temperature", unit: "celsius"},
+	"tpv.clockbias":   {name: "clock_bias", unit: "seconds", scale: 1e-9},
+	"tpv.clockdrift":  {name: "clock_drift", unit: "seconds_per_second", scale: 1e-9},
+	"tpv.baseS":       {name: "base_status", enum: baseStatusEnum},
+
+	// Marine TPV fields, only exported once a device reports them
+	"marine.depth":   {name: "depth", unit: "meters"},
+	"marine.wtemp":   {name: "water_temperature", unit: "celsius"},
+	"marine.wanglem": {name: "wind_angle_magnetic", unit: "degrees"},
+	"marine.wangler": {name: "wind_angle_relative", unit: "degrees"},
+	"marine.wanglet": {name: "wind_angle_true", unit: "degrees"},
+	"marine.wspeedr": {name: "wind_speed_relative", unit: "meters_per_second"},
+	"marine.wspeedt": {name: "wind_speed_true", unit: "meters_per_second"},
+
+	// SKY
+	"sky.nSat":  {name: "satellites_visible"},
+	"sky.gdop":  {name: "gdop"},
+	"sky.hdop":  {name: "hdop"},
+	"sky.pdop":  {name: "pdop"},
+	"sky.prRes": {name: "pseudorange_residual", unit: "meters"},
+	"sky.qual":  {name: "quality", enum: qualityEnum},
+	"sky.tdop":  {name: "tdop"},
+	"sky.time":  {name: "timestamp", unit: "seconds"},
+	"sky.uSat":  {name: "satellites_used"},
+	"sky.vdop":  {name: "vdop"},
+	"sky.xdop":  {name: "xdop"},
+	"sky.ydop":  {name: "ydop"},
+
+	// Satellite
+	"sat.az":     {name: "azimuth", unit: "degrees"},
+	"sat.el":     {name: "elevation", unit: "degrees"},
+	"sat.ss":     {name: "snr", unit: "dbhz"},
+	"sat.used":   {name: "used"},
+	"sat.gnssid": {name: "gnss_id", enum: gnssNames},
+	"sat.svid":   {name: "sv_id"},
+	"sat.sigid":  {name: "signal_id"},
+	"sat.freqid": {name: "frequency_id"},
+	"sat.health": {name: "health", enum: healthEnum},
+	"sat.pr":     {name: "pseudorange", unit: "meters"},
+	"sat.prRate": {name: "pseudorange_rate", unit: "meters_per_second"},
+	"sat.prRes":  {name: "pseudorange_residual", unit: "meters"},
+
+	// GST
+	"gst.time":   {name: "timestamp", unit: "seconds"},
+	"gst.rms":    {name: "range_deviation", unit: "meters"},
+	"gst.major":  {name: "semi_major_deviation", unit: "meters"},
+	"gst.minor":  {name: "semi_minor_deviation", unit: "meters"},
+	"gst.orient": {name: "orientation", unit: "degrees"},
+	"gst.lat":    {name: "latitude_deviation", unit: "meters"},
+	"gst.lon":    {name: "longitude_deviation", unit: "meters"},
+	"gst.alt":    {name: "altitude_deviation", unit: "meters"},
+
+	// TOFF
+	"toff.real_sec":   {name: "real", unit: "seconds"},
+	"toff.real_nsec":  {name: "real_fraction", unit: "seconds", scale: 1e-9},
+	"toff.clock_sec":  {name: "clock", unit: "seconds"},
+	"toff.clock_nsec": {name: "clock_fraction", unit: "seconds", scale: 1e-9},
+
+	// PPS
+	"pps.real_sec":   {name: "real", unit: "seconds"},
+	"pps.real_nsec":  {name: "real_fraction", unit: "seconds", scale: 1e-9},
+	"pps.clock_sec":  {name: "clock", unit: "seconds"},
+	"pps.clock_nsec": {name: "clock_fraction", unit: "seconds", scale: 1e-9},
+	"pps.precision":  {name: "precision"},
+	"pps.qErr":       {name: "quantization_error", unit: "seconds", scale: 1e-12},
+
+	// ATT of NMEA2000 devices
+	"n2k.time":    {name: "timestamp", unit: "seconds"},
+	"n2k.heading": {name: "heading", unit: "degrees"},
+	"n2k.pitch":   {name: "pitch", unit: "degrees"},
+	"n2k.roll":    {name: "roll", unit: "degrees"},
+	"n2k.yaw":     {name: "yaw", unit: "degrees"},
+	"n2k.depth":   {name: "water_depth", unit: "meters"},
+	"n2k.temp":    {name: "temperature", unit: "celsius"},
+
+	// OSC
+	"osc.running":     {name: "running"},
+	"osc.reference":   {name: "reference"},
+	"osc.disciplined": {name: "disciplined"},
+	"osc.delta":       {name: "delta", unit: "seconds", scale: 1e-9},
+}
+
+// legacyNamespaces are the namespaces of fields exported under another class's namespace before their own
+var legacyNamespaces = map[string]string{"marine": "tpv"}
+
+// metricName returns the metric name for a gpsd field and the factor to scale its value by
+func metricName(namespace, field string) (string, float64) {
+	legacyNamespace := namespace
+	if ns, ok := legacyNamespaces[namespace]; ok {
+		legacyNamespace = ns
+	}
+	legacy := fmt.Sprintf("gpsd_%s_%s", legacyNamespace, field)
+	m, ok := fieldMetrics[namespace+"."+field]
+	if *legacyNames || !ok {
+		return legacy, 1
+	}
+
+	name := fmt.Sprintf("gpsd_%s_%s", namespace, m.name)
+	if m.unit != "" {
+		name += "_" + m.unit
+	}
+	scale := m.scale
+	if scale == 0 {
+		scale = 1
+	}
+	return name, scale
+}
+
+// fieldHelp returns the HELP text of the metric exported for a gpsd field: its description, the meaning of each value of enumerated fields, and the unit it's exported in
+func fieldHelp(namespace, field, description string) string {
+	help := strings.TrimSuffix(strings.TrimSpace(description), ".")
+	m := fieldMetrics[namespace+"."+field]
+	if len(m.enum) > 0 {
+		values := make([]int, 0, len(m.enum))
+		for v := range m.enum {
+			values = append(values, v)
+		}
+		sort.Ints(values)
+		meanings := make([]string, len(values))
+		for i, v := range values {
+			meanings[i] = fmt.Sprintf("%d=%s", v, m.enum[v])
+		}
+		help += ": " + strings.Join(meanings, ", ")
+	}
+	if m.unit != "" && !*legacyNames {
+		help += ". Exported in " + strings.ReplaceAll(m.unit, "_", " ")
+	}
+	return help
+}
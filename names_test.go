@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestMetricName(t *testing.T) {
+	defer func(legacy bool) { *legacyNames = legacy }(*legacyNames)
+	for _, tt := range []struct {
+		namespace, field string
+		legacy           bool
+		want             string
+		scale            float64
+	}{
+		{"tpv", "altMSL", false, "gpsd_tpv_altitude_msl_meters", 1},
+		{"tpv", "altMSL", true, "gpsd_tpv_altMSL", 1},
+		{"marine", "depth", false, "gpsd_marine_depth_meters", 1},
+		{"marine", "depth", true, "gpsd_tpv_depth", 1},
+		{"pps", "real_sec", false, "gpsd_pps_real_seconds", 1},
+		{"pps", "real_nsec", false, "gpsd_pps_real_fraction_seconds", 1e-9},
+		{"pps", "clock_nsec", false, "gpsd_pps_clock_fraction_seconds", 1e-9},
+		{"pps", "clock_nsec", true, "gpsd_pps_clock_nsec", 1},
+		{"toff", "real_nsec", false, "gpsd_toff_real_fraction_seconds", 1e-9},
+		{"toff", "clock_nsec", false, "gpsd_toff_clock_fraction_seconds", 1e-9},
+		{"toff", "clock_nsec", true, "gpsd_toff_clock_nsec", 1},
+		{"pps", "qErr", false, "gpsd_pps_quantization_error_seconds", 1e-12},
+		{"tpv", "wander", false, "gpsd_tpv_wander", 1},
+	} {
+		*legacyNames = tt.legacy
+		if name, scale := metricName(tt.namespace, tt.field); name != tt.want || scale != tt.scale {
+			t.Errorf("%s.%s with legacy names %t is %s scaled by %g, want %s scaled by %g", tt.namespace, tt.field, tt.legacy, name, scale, tt.want, tt.scale)
+		}
+	}
+}
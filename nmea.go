@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// knotsToMetersPerSecond converts NMEA speeds to the units gpsd reports
+const knotsToMetersPerSecond = 0.514444
+
+var errNMEAChecksum = errors.New("checksum mismatch")
+
+// nmeaSentence is a parsed NMEA 0183 sentence such as $GPRMC,...*hh
+type nmeaSentence struct {
+	talker string // GP, GN, GL, ...
+	kind   string // RMC, GGA, ...
+	fields []string
+}
+
+// parseNMEA splits an NMEA sentence into its fields, verifying the checksum if present
+func parseNMEA(line string) (nmeaSentence, error) {
+	line = strings.TrimSpace(line)
+	if len(line) < 7 || (line[0] != '$' && line[0] != '!') {
+		return nmeaSentence{}, fmt.Errorf("not an NMEA sentence: %q", line)
+	}
+	body := line[1:]
+	if i := strings.LastIndexByte(body, '*'); i >= 0 {
+		want, err := strconv.ParseUint(body[i+1:], 16, 8)
+		if err != nil {
+			return nmeaSentence{}, fmt.Errorf("invalid checksum %q", body[i+1:])
+		}
+		body = body[:i]
+		var sum byte
+		for j := 0; j < len(body); j++ {
+			sum ^= body[j]
+		}
+		if sum != byte(want) {
+			return nmeaSentence{}, fmt.Errorf("%w in %q", errNMEAChecksum, line)
+		}
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields[0]) != 5 {
+		return nmeaSentence{}, fmt.Errorf("unsupported NMEA address %q", fields[0])
+	}
+	return nmeaSentence{talker: fields[0][:2], kind: fields[0][2:], fields: fields[1:]}, nil
+}
+
+// field returns field i, or an empty string if the sentence is too short
+func (s nmeaSentence) field(i int) string {
+	if i < len(s.fields) {
+		return s.fields[i]
+	}
+	return ""
+}
+
+// float returns field i as a number, or zero if empty or invalid
+func (s nmeaSentence) float(i int) float64 {
+	v, _ := strconv.ParseFloat(s.field(i), 64)
+	return v
+}
+
+// coordinate converts a ddmm.mmmm field and its hemisphere to signed degrees
+func (s nmeaSentence) coordinate(i int) (float64, bool) {
+	raw, hemisphere := s.field(i), s.field(i+1)
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false
+	}
+	degrees := float64(int(v/100)) + (v-float64(int(v/100))*100)/60
+	if hemisphere == "S" || hemisphere == "W" {
+		degrees = -degrees
+	}
+	return degrees, true
+}
+
+// nmeaGNSSIDs maps talker IDs to u-blox GNSS IDs as used in gpsd's satellite objects
+var nmeaGNSSIDs = map[string]float64{"GP": 0, "GA": 2, "GB": 3, "BD": 3, "GQ": 5, "GL": 6}
+
+// nmeaSystemTalkers maps NMEA 4.10 GSA system IDs to the talker of that constellation's GSV sentences
+var nmeaSystemTalkers = map[string]string{"1": "GP", "2": "GL", "3": "GA", "4": "GB", "5": "GQ"}
+
+// ggaStatus maps GGA fix quality to gpsd's TPV status
+var ggaStatus = map[string]float64{"1": 1, "2": 2, "4": 3, "5": 4, "6": 5, "8": 8}
+
+// nmeaDecoder assembles gpsd-style reports from a stream of NMEA sentences
+type nmeaDecoder struct {
+	device string
+	date   string // ddmmyy from the last RMC sentence
+	tpv    TPV
+	sky    SKY
+
+	sats    map[string][]Satellite // Satellites in view by talker, from complete GSV groups
+	pending map[string][]Satellite // GSV groups being received
+	used    map[string]map[float64]bool
+}
+
+func newNMEADecoder(device string) *nmeaDecoder {
+	return &nmeaDecoder{
+		device:  device,
+		tpv:     TPV{Device: device},
+		sky:     SKY{Device: device},
+		sats:    map[string][]Satellite{},
+		pending: map[string][]Satellite{},
+		used:    map[string]map[float64]bool{},
+	}
+}
+
+// decode updates the decoder state from a sentence, returning the class and report to export if one is complete
+func (d *nmeaDecoder) decode(s nmeaSentence) (string, any) {
+	switch s.kind {
+	case "RMC":
+		d.date = s.field(8)
+		d.setTime(s.field(0))
+		if s.field(1) != "A" {
+			d.tpv.Mode = 1
+			return "tpv", d.report()
+		}
+		d.setPosition(s, 2)
+		d.tpv.Speed = s.float(6) * knotsToMetersPerSecond
+		d.tpv.Track = s.float(7)
+		if magvar := s.float(9); s.field(10) == "E" {
+			d.tpv.MagVar = -magvar
+		} else {
+			d.tpv.MagVar = magvar
+		}
+		return "tpv", d.report()
+	case "GGA":
+		d.setTime(s.field(0))
+		d.setPosition(s, 1)
+		d.tpv.Status = ggaStatus[s.field(5)]
+		// GSA carries the fix mode, but not every multiplexer forwards it
+		if s.field(5) == "0" {
+			d.tpv.Mode = 1
+		} else if d.tpv.Mode < 2 && s.field(8) != "" {
+			d.tpv.Mode = 3
+		} else if d.tpv.Mode < 2 {
+			d.tpv.Mode = 2
+		}
+		d.sky.HDOP = s.float(7)
+		d.tpv.AltMSL = s.float(8)
+		d.tpv.GeoidSep = s.float(10)
+		d.tpv.AltHAE = d.tpv.AltMSL + d.tpv.GeoidSep
+		d.tpv.DGPSAge = s.float(12)
+		d.tpv.DGPSStation = s.float(13)
+		return "tpv", d.report()
+	case "VTG":
+		d.tpv.Track = s.float(0)
+		d.tpv.MagTrack = s.float(2)
+		d.tpv.Speed = s.float(4) * knotsToMetersPerSecond
+		return "", nil
+	case "GSA":
+		d.tpv.Mode = s.float(1)
+		d.sky.PDOP, d.sky.HDOP, d.sky.VDOP = s.float(14), s.float(15), s.float(16)
+		talker := s.talker
+		if t, ok := nmeaSystemTalkers[s.field(17)]; ok {
+			talker = t
+		}
+		used := map[float64]bool{}
+		for i := 2; i < 14; i++ {
+			if prn := s.float(i); prn > 0 {
+				used[prn] = true
+			}
+		}
+		d.used[talker] = used
+		return "", nil
+	case "GSV":
+		return d.decodeGSV(s)
+	}
+	return "", nil
+}
+
+// decodeGSV collects the satellites of a GSV group, returning a SKY report once the group is complete
+func (d *nmeaDecoder) decodeGSV(s nmeaSentence) (string, any) {
+	total, num := s.float(0), s.float(1)
+	if num == 1 {
+		d.pending[s.talker] = nil
+	}
+	// Satellites are in groups of four fields after the message counts, optionally followed by a signal ID
+	for i := 3; i+3 < len(s.fields); i += 4 {
+		if s.field(i) == "" {
+			continue
+		}
+		d.pending[s.talker] = append(d.pending[s.talker], Satellite{
+			PRN:       s.float(i),
+			Elevation: s.float(i + 1),
+			Azimuth:   s.float(i + 2),
+			SNR:       s.float(i + 3),
+			GNSSID:    nmeaGNSSIDs[s.talker],
+			SVID:      s.float(i),
+		})
+	}
+	if num < total {
+		return "", nil
+	}
+	d.sats[s.talker] = d.pending[s.talker]
+	delete(d.pending, s.talker)
+
+	talkers := make([]string, 0, len(d.sats))
+	for t := range d.sats {
+		talkers = append(talkers, t)
+	}
+	sort.Strings(talkers)
+	d.sky.Satellites = nil
+	d.sky.USat = 0
+	for _, t := range talkers {
+		for _, sat := range d.sats[t] {
+			sat.Used = d.used[t][sat.PRN] || d.used["GN"][sat.PRN]
+			if sat.Used {
+				d.sky.USat++
+			}
+			d.sky.Satellites = append(d.sky.Satellites, sat)
+		}
+	}
+	d.sky.NSat = float64(len(d.sky.Satellites))
+	d.sky.Time = d.tpv.Time
+	sky := d.sky
+	return "sky", &sky
+}
+
+// setTime sets the TPV time from an hhmmss.ss field and the last RMC date
+func (d *nmeaDecoder) setTime(hms string) {
+	if len(hms) < 6 || len(d.date) != 6 {
+		return
+	}
+	frac := ""
+	if i := strings.IndexByte(hms, '.'); i >= 0 {
+		frac = hms[i:]
+	}
+	d.tpv.Time = fmt.Sprintf("20%s-%s-%sT%s:%s:%s%sZ", d.date[4:6], d.date[2:4], d.date[0:2], hms[0:2], hms[2:4], hms[4:6], frac)
+}
+
+// setPosition sets the TPV latitude and longitude from the fields starting at i
+func (d *nmeaDecoder) setPosition(s nmeaSentence, i int) {
+	if lat, ok := s.coordinate(i); ok {
+		d.tpv.Lat = lat
+	}
+	if lon, ok := s.coordinate(i + 2); ok {
+		d.tpv.Lon = lon
+	}
+}
+
+// report returns a copy of the current TPV
+func (d *nmeaDecoder) report() *TPV {
+	tpv := d.tpv
+	return &tpv
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// withChecksum frames an NMEA sentence body with its checksum
+func withChecksum(body string) string {
+	var sum byte
+	for i := 0; i < len(body); i++ {
+		sum ^= body[i]
+	}
+	return fmt.Sprintf("$%s*%02X", body, sum)
+}
+
+func TestParseNMEA(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		line  string
+		want  nmeaSentence
+		err   bool
+		errIs error
+	}{
+		{name: "GGA with checksum", line: "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47",
+			want: nmeaSentence{talker: "GP", kind: "GGA", fields: []string{"123519", "4807.038", "N", "01131.000", "E", "1", "08", "0.9", "545.4", "M", "46.9", "M", "", ""}}},
+		{name: "without checksum", line: "$GNRMC,123519,A\r\n",
+			want: nmeaSentence{talker: "GN", kind: "RMC", fields: []string{"123519", "A"}}},
+		{name: "AIS start", line: "!AIVDM,1,1,,A,13aEOK?P00PD2wVMdLDRhgvL289?,0",
+			want: nmeaSentence{talker: "AI", kind: "VDM", fields: []string{"1", "1", "", "A", "13aEOK?P00PD2wVMdLDRhgvL289?", "0"}}},
+		{name: "checksum mismatch", line: "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*48", err: true, errIs: errNMEAChecksum},
+		{name: "invalid checksum", line: "$GPGGA,123519*ZZ", err: true},
+		{name: "too short", line: "$GPGG", err: true},
+		{name: "no start", line: "GPGGA,123519,4807.038", err: true},
+		{name: "proprietary address", line: withChecksum("PUBX,00,123519"), err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNMEA(tt.line)
+			if tt.err {
+				if err == nil || (tt.errIs != nil && !errors.Is(err, tt.errIs)) {
+					t.Errorf("got %+v, %v; want an error", got, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNMEACoordinate(t *testing.T) {
+	for _, tt := range []struct {
+		raw, hemisphere string
+		want            float64
+		ok              bool
+	}{
+		{"4807.038", "N", 48.1173, true},
+		{"4807.038", "S", -48.1173, true},
+		{"01131.000", "E", 11.516666666666667, true},
+		{"12225.164", "W", -122.41940, true},
+		{"0000.000", "N", 0, true},
+		{"", "N", 0, false},
+		{"north", "N", 0, false},
+	} {
+		t.Run(tt.raw+tt.hemisphere, func(t *testing.T) {
+			got, ok := nmeaSentence{fields: []string{tt.raw, tt.hemisphere}}.coordinate(0)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, %t; want %v, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNMEADecoder(t *testing.T) {
+	type sky struct {
+		nSat, uSat float64
+		used       []float64
+	}
+	for _, tt := range []struct {
+		name      string
+		sentences []string
+		class     string
+		tpv       *TPV // Fields checked when class is tpv
+		sky       *sky // Fields checked when class is sky
+	}{
+		{
+			name:      "RMC fix",
+			sentences: []string{withChecksum("GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,010624,003.1,W")},
+			class:     "tpv",
+			tpv: &TPV{Device: "nmea", Time: "2024-06-01T12:35:19Z", Lat: 48.1173, Lon: 11.516666666666667,
+				Speed: 22.4 * knotsToMetersPerSecond, Track: 84.4, MagVar: 3.1},
+		},
+		{
+			name:      "RMC without fix",
+			sentences: []string{withChecksum("GPRMC,123519,V,,,,,,,010624,,")},
+			class:     "tpv",
+			tpv:       &TPV{Device: "nmea", Time: "2024-06-01T12:35:19Z", Mode: 1},
+		},
+		{
+			name: "GGA after RMC date",
+			sentences: []string{
+				withChecksum("GPRMC,123519.50,A,4807.038,N,01131.000,E,0,0,010624,,"),
+				"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47",
+			},
+			class: "tpv",
+			tpv: &TPV{Device: "nmea", Time: "2024-06-01T12:35:19Z", Mode: 3, Status: 1, Lat: 48.1173, Lon: 11.516666666666667,
+				AltMSL: 545.4, GeoidSep: 46.9, AltHAE: 592.3},
+		},
+		{
+			name:      "GGA without fix",
+			sentences: []string{withChecksum("GPGGA,123519,,,,,0,00,,,M,,M,,")},
+			class:     "tpv",
+			tpv:       &TPV{Device: "nmea", Mode: 1},
+		},
+		{
+			name: "GSA mode overrides GGA",
+			sentences: []string{
+				withChecksum("GPGSA,A,2,04,05,,,,,,,,,,,2.5,1.3,2.1"),
+				withChecksum("GPGGA,123519,4807.038,N,01131.000,E,2,08,0.9,545.4,M,46.9,M,3.0,0120"),
+			},
+			class: "tpv",
+			tpv: &TPV{Device: "nmea", Mode: 2, Status: 2, Lat: 48.1173, Lon: 11.516666666666667,
+				AltMSL: 545.4, GeoidSep: 46.9, AltHAE: 592.3, DGPSAge: 3, DGPSStation: 120},
+		},
+		{
+			name:      "incomplete GSV group",
+			sentences: []string{withChecksum("GPGSV,2,1,05,04,40,083,46,05,20,120,40,07,60,200,44,09,10,300,30")},
+		},
+		{
+			name: "GSV group with GSA used satellites",
+			sentences: []string{
+				withChecksum("GPGSA,A,3,04,07,,,,,,,,,,,2.5,1.3,2.1"),
+				withChecksum("GPGSV,2,1,05,04,40,083,46,05,20,120,40,07,60,200,44,09,10,300,30"),
+				withChecksum("GPGSV,2,2,05,12,05,010,"),
+			},
+			class: "sky",
+			sky:   &sky{nSat: 5, uSat: 2, used: []float64{4, 7}},
+		},
+		{
+			name: "NMEA 4.10 GSA system ID",
+			sentences: []string{
+				withChecksum("GNGSA,A,3,70,,,,,,,,,,,,2.5,1.3,2.1,2"),
+				withChecksum("GLGSV,1,1,02,70,40,083,46,71,20,120,40"),
+			},
+			class: "sky",
+			sky:   &sky{nSat: 2, uSat: 1, used: []float64{70}},
+		},
+		{
+			name:      "unsupported sentence",
+			sentences: []string{withChecksum("GPZDA,123519,23,03,1994,00,00")},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newNMEADecoder("nmea")
+			var class string
+			var report any
+			for _, line := range tt.sentences {
+				s, err := parseNMEA(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				class, report = d.decode(s)
+			}
+			if class != tt.class {
+				t.Fatalf("got class %q, want %q", class, tt.class)
+			}
+			switch r := report.(type) {
+			case *TPV:
+				r.Lat, r.Lon, r.AltHAE = round(r.Lat), round(r.Lon), round(r.AltHAE)
+				tt.tpv.Lat, tt.tpv.Lon, tt.tpv.AltHAE = round(tt.tpv.Lat), round(tt.tpv.Lon), round(tt.tpv.AltHAE)
+				if !reflect.DeepEqual(r, tt.tpv) {
+					t.Errorf("got %+v, want %+v", r, tt.tpv)
+				}
+			case *SKY:
+				var used []float64
+				for _, sat := range r.Satellites {
+					if sat.Used {
+						used = append(used, sat.PRN)
+					}
+				}
+				if r.NSat != tt.sky.nSat || r.USat != tt.sky.uSat || !reflect.DeepEqual(used, tt.sky.used) {
+					t.Errorf("got %v satellites, %v used %v; want %+v", r.NSat, r.USat, used, *tt.sky)
+				}
+			}
+		})
+	}
+}
+
+// round rounds away floating point noise from coordinate conversions
+func round(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
@@ -0,0 +1,44 @@
+package main
+
+import "math"
+
+// clockOffsets are the latest system clock offsets a device implied through its PPS and TOFF reports
+type clockOffsets struct {
+	pps, toff         float64 // Offset of the system clock, seconds
+	ppsTime, toffTime float64 // GPS time the offsets were measured at, zero until reported
+}
+
+// maxOffsetSkew is how far apart in GPS time the PPS and TOFF offsets may have been measured to still be compared
+const maxOffsetSkew = 2
+
+// updateOffsetCheck exports the difference between the system clock offsets implied by the TOFF (serial time) and PPS reports of a device.
+// TOFF includes the latency of the serial message, so a steady difference is normal while a changing one points at cabling or driver trouble.
+func (e *exporter) updateOffsetCheck(report any) {
+	var device string
+	var offset, t float64
+	switch r := report.(type) {
+	case *PPS:
+		device, offset, t = r.Device, r.ClockSec-r.RealSec+(r.ClockNsec-r.RealNsec)/1e9, r.RealSec
+	case *TOFF:
+		device, offset, t = r.Device, r.ClockSec-r.RealSec+(r.ClockNsec-r.RealNsec)/1e9, r.RealSec
+	default:
+		return
+	}
+	if t == 0 {
+		return
+	}
+	o, ok := e.offsets[device]
+	if !ok {
+		o = &clockOffsets{}
+		e.offsets[device] = o
+	}
+	if _, ok := report.(*PPS); ok {
+		o.pps, o.ppsTime = offset, t
+	} else {
+		o.toff, o.toffTime = offset, t
+	}
+	if o.ppsTime == 0 || o.toffTime == 0 || math.Abs(o.ppsTime-o.toffTime) > maxOffsetSkew {
+		return
+	}
+	e.series(e.offsetDisagreement, device).Set(o.toff - o.pps)
+}
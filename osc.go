@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// oscState tracks the discipline of an oscillator
+type oscState struct {
+	disciplinedSince time.Time // When the oscillator last became disciplined, zero while it isn't
+	lastDisciplined  time.Time // When the oscillator was last seen disciplined
+}
+
+// updateOscillator exports how long an oscillator has been disciplined and how long it has been in holdover, running on its own since it was last disciplined.
+// The magnitude of delta is observed at each report, and at each poll when polling since POLL responses repeat the latest one.
+func (e *exporter) updateOscillator(osc *OSC) {
+	s, ok := e.oscillators[osc.Device]
+	if !ok {
+		s = &oscState{}
+		e.oscillators[osc.Device] = s
+	}
+	now := time.Now()
+	disciplined, holdover := 0.0, 0.0
+	switch {
+	case osc.Disciplined:
+		if s.disciplinedSince.IsZero() {
+			s.disciplinedSince = now
+		}
+		s.lastDisciplined = now
+		disciplined = now.Sub(s.disciplinedSince).Seconds()
+	case osc.Running && !s.lastDisciplined.IsZero():
+		s.disciplinedSince = time.Time{}
+		holdover = now.Sub(s.lastDisciplined).Seconds()
+	default:
+		s.disciplinedSince = time.Time{}
+	}
+	e.series(e.oscDisciplined, osc.Device).Set(disciplined)
+	e.series(e.oscHoldover, osc.Device).Set(holdover)
+
+	if osc.Running {
+		e.oscDelta.Observe(math.Abs(osc.Delta) / 1e9)
+	}
+}
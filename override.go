@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// overrideFileMu serializes updates of the address override file, which holds the overrides of every target
+var overrideFileMu sync.Mutex
+
+// readOverrides reads the addresses that replace configured gpsd targets, by target
+func readOverrides() (map[string]string, error) {
+	overrides := map[string]string{}
+	b, err := os.ReadFile(*addressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return overrides, json.Unmarshal(b, &overrides)
+}
+
+// loadOverride connects to the address that replaced the configured one before a restart, if any
+func (c *gpsdClient) loadOverride() error {
+	if *addressFile == "" {
+		return nil
+	}
+	overrideFileMu.Lock()
+	defer overrideFileMu.Unlock()
+	overrides, err := readOverrides()
+	if err != nil {
+		return fmt.Errorf("reading address overrides from %s: %w", *addressFile, err)
+	}
+	if addr, ok := overrides[c.addr]; ok {
+		log.Infof("Connecting to %s in place of %s as set through the admin API", addr, c.addr)
+		c.override = addr
+	}
+	return nil
+}
+
+// saveOverride persists the address replacing the configured one, deleting it when empty
+func (c *gpsdClient) saveOverride(addr string) error {
+	overrideFileMu.Lock()
+	defer overrideFileMu.Unlock()
+	overrides, err := readOverrides()
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		delete(overrides, c.addr)
+	} else {
+		overrides[c.addr] = addr
+	}
+	b, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := *addressFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *addressFile)
+}
+
+// dialAddr returns the address to connect to, which the admin API may have changed from the configured one
+func (c *gpsdClient) dialAddr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.override != "" {
+		return c.override
+	}
+	return c.addr
+}
+
+// setAddr connects to addr in place of the configured address from now on, or to the configured address again if addr is empty.
+// The target keeps its configured name in logs and labels.
+func (c *gpsdClient) setAddr(addr string) error {
+	if *addressFile != "" {
+		if err := c.saveOverride(addr); err != nil {
+			return fmt.Errorf("saving address override to %s: %w", *addressFile, err)
+		}
+	}
+	c.mu.Lock()
+	c.override = addr
+	c.mu.Unlock()
+	if err := c.reconnect(); err != nil && !errors.Is(err, errNotConnected) {
+		return err
+	}
+	return nil
+}
+
+// addressAllowed reports whether the admin API may point a target at addr: the address of a configured or discovered gpsd target,
+// or one listed in -web.admin-allowed-targets, so the exporter can't be made to connect to arbitrary hosts
+func addressAllowed(sources *sourceSet, addr string) bool {
+	for _, c := range sources.gpsdClients() {
+		if c.addr == addr {
+			return true
+		}
+	}
+	for _, allowed := range strings.Split(*adminAllowedTargets, ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && normalizeAddr(allowed, defaultGPSDPort) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// adminAddressHandler changes the address of a gpsd target to the one in the request body, or back to the configured one if it's empty
+func adminAddressHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		addr := strings.TrimSpace(string(body))
+		if addr != "" {
+			addr = normalizeAddr(addr, defaultGPSDPort)
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				http.Error(w, fmt.Sprintf("invalid gpsd address %q: %v", addr, err), http.StatusBadRequest)
+				return
+			}
+			if !addressAllowed(sources, addr) {
+				http.Error(w, fmt.Sprintf("gpsd address %s is neither a target nor in -web.admin-allowed-targets", addr), http.StatusForbidden)
+				return
+			}
+		}
+
+		c, err := pickClient(sources.gpsdClients(), r.URL.Query().Get("target"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if addr == "" {
+			log.Infof("Request from %s to connect to %s at its configured address", r.RemoteAddr, c.addr)
+		} else {
+			log.Infof("Request from %s to connect to %s in place of %s", r.RemoteAddr, addr, c.addr)
+		}
+		if err := c.setAddr(addr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
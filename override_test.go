@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// overrideSources returns a configured target and a discovered one
+func overrideSources() *sourceSet {
+	sources := &sourceSet{}
+	for _, c := range []*gpsdClient{
+		{addr: "localhost:2947", exporter: newExporter("localhost:2947", prometheus.NewRegistry())},
+		{addr: "boat.local:2947", exporter: newExporter("boat.local:2947", prometheus.NewRegistry()), done: make(chan struct{})},
+	} {
+		sources.add(c.exporter, c)
+	}
+	return sources
+}
+
+func TestAddressAllowed(t *testing.T) {
+	defer func(allowed string) { *adminAllowedTargets = allowed }(*adminAllowedTargets)
+	*adminAllowedTargets = "tether.local, [fe80::1]:2948,,192.0.2.10:3000"
+	sources := overrideSources()
+	for _, tt := range []struct {
+		addr string
+		want bool
+	}{
+		{"localhost:2947", true},
+		{"boat.local:2947", true},
+		{"tether.local:2947", true},
+		{"[fe80::1]:2948", true},
+		{"192.0.2.10:3000", true},
+		{"tether.local:2948", false},
+		{"[fe80::1]:2947", false},
+		{"192.0.2.10:2947", false},
+		{"localhost:22", false},
+		{"169.254.169.254:80", false},
+		{"attacker.example.com:2947", false},
+		{"", false},
+	} {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := addressAllowed(sources, tt.addr); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	*adminAllowedTargets = ""
+	if addressAllowed(sources, "tether.local:2947") {
+		t.Error("allowed an address that's no longer listed")
+	}
+}
+
+func TestAdminAddressHandler(t *testing.T) {
+	defer func(allowed, file string) { *adminAllowedTargets, *addressFile = allowed, file }(*adminAllowedTargets, *addressFile)
+	*adminAllowedTargets, *addressFile = "tether.local", ""
+	for _, tt := range []struct {
+		name, body   string
+		status       int
+		wantOverride string
+	}{
+		{name: "allowed", body: "tether.local", status: http.StatusNoContent, wantOverride: "tether.local:2947"},
+		{name: "other target", body: "boat.local:2947", status: http.StatusNoContent, wantOverride: "boat.local:2947"},
+		{name: "configured address", body: "", status: http.StatusNoContent},
+		{name: "arbitrary host", body: "attacker.example.com:2947", status: http.StatusForbidden, wantOverride: "127.0.0.1:2947"},
+		{name: "arbitrary port", body: "localhost:22", status: http.StatusForbidden, wantOverride: "127.0.0.1:2947"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := overrideSources()
+			c := sources.gpsdClients()[0]
+			c.override = "127.0.0.1:2947" // Set before, through the address file
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/address?target=localhost:2947", strings.NewReader(tt.body))
+			adminAddressHandler(sources)(w, r)
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if c.override != tt.wantOverride {
+				t.Errorf("connects to %q, want %q", c.override, tt.wantOverride)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// privacyFlag limits how precisely positions are exported, in off, truncate:N or redact form
+type privacyFlag struct {
+	mode   string
+	digits int // Decimal places kept by truncate
+}
+
+func (f *privacyFlag) String() string {
+	if f.mode == "truncate" {
+		return fmt.Sprintf("truncate:%d", f.digits)
+	}
+	return f.mode
+}
+
+func (f *privacyFlag) Set(value string) error {
+	mode, digits, _ := strings.Cut(value, ":")
+	switch mode {
+	case "off", "redact":
+		if digits != "" {
+			return fmt.Errorf("privacy mode %s doesn't take a precision", mode)
+		}
+	case "truncate":
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid precision %q (expected truncate:N decimal places)", digits)
+		}
+		f.digits = n
+	default:
+		return fmt.Errorf("unknown privacy mode %q (expected off, truncate:N, or redact)", value)
+	}
+	f.mode = mode
+	return nil
+}
+
+// enabled reports whether positions are hidden or coarsened
+func (f *privacyFlag) enabled() bool {
+	return f.mode != "off"
+}
+
+// position returns a position as it may be exported, or false if it must not be exported at all
+func (f *privacyFlag) position(lat, lon float64) (float64, float64, bool) {
+	switch f.mode {
+	case "redact":
+		return 0, 0, false
+	case "truncate":
+		scale := math.Pow(10, float64(f.digits))
+		return math.Trunc(lat*scale) / scale, math.Trunc(lon*scale) / scale, true
+	}
+	return lat, lon, true
+}
+
+// redacts reports whether a report field must not be exported.
+// ECEF coordinates pinpoint the receiver as precisely as latitude and longitude but can't be coarsened meaningfully, so they're always dropped.
+func (f *privacyFlag) redacts(namespace, jsonField string) bool {
+	if !f.enabled() || namespace != "tpv" {
+		return false
+	}
+	switch jsonField {
+	case "ecefx", "ecefy", "ecefz":
+		return true
+	case "lat", "lon":
+		return f.mode == "redact"
+	}
+	return false
+}
+
+// filter returns the report as it may be exported, copying TPV reports rather than modifying them
+func (f *privacyFlag) filter(report any) any {
+	tpv, ok := report.(*TPV)
+	if !ok || !f.enabled() {
+		return report
+	}
+	public := *tpv
+	public.Lat, public.Lon, _ = f.position(tpv.Lat, tpv.Lon)
+	public.ECEFX, public.ECEFY, public.ECEFZ = 0, 0, 0
+	return &public
+}
+
+// filterLine returns a raw gpsd or NMEA line as it may be exported.
+// Positions in TPV and POLL reports are filtered like the metrics, and NMEA sentences keep only their type since most carry a position.
+func (f *privacyFlag) filterLine(line string) string {
+	if !f.enabled() {
+		return line
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		if i := strings.IndexByte(line, ','); i >= 0 {
+			return line[:i] + ",<redacted>"
+		}
+		return line
+	}
+	switch m["class"] {
+	case "TPV":
+		f.filterMap(m)
+	case "POLL":
+		tpvs, _ := m["tpv"].([]any)
+		for _, tpv := range tpvs {
+			if tpv, ok := tpv.(map[string]any); ok {
+				f.filterMap(tpv)
+			}
+		}
+	default:
+		return line
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// filterMap filters the position of a decoded TPV report in place
+func (f *privacyFlag) filterMap(tpv map[string]any) {
+	for field := range tpv {
+		if f.redacts("tpv", field) {
+			delete(tpv, field)
+		}
+	}
+	lat, latOK := tpv["lat"].(float64)
+	lon, lonOK := tpv["lon"].(float64)
+	if latOK && lonOK {
+		tpv["lat"], tpv["lon"], _ = f.position(lat, lon)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/proxy"
+)
+
+// privateTPVs are TPV reports of a moving device, whose positions all start 37.77 and -122.41 and lie at 2706180 meters ECEF X
+var privateTPVs = []string{
+	`{"class":"TPV","device":"/dev/ttyACM0","mode":3,"time":"2024-06-01T12:00:00.000Z","lat":37.774929,"lon":-122.419415,"altMSL":62.3,` +
+		`"eph":3.1,"epv":5.1,"speed":5.0,"track":45.0,"ecefx":-2706180.52,"ecefy":-4261060.71,"ecefz":3885735.28}`,
+	`{"class":"TPV","device":"/dev/ttyACM0","mode":3,"time":"2024-06-01T12:00:10.000Z","lat":37.775329,"lon":-122.418915,"altMSL":62.5,` +
+		`"eph":3.1,"epv":5.1,"speed":5.0,"track":45.0,"ecefx":-2706180.11,"ecefy":-4261060.02,"ecefz":3885736.01}`,
+}
+
+// privatePOLL wraps a TPV report in a POLL response
+func privatePOLL(tpv string) string {
+	return `{"class":"POLL","time":"2024-06-01T12:00:10.000Z","active":1,"tpv":[` + tpv + `],"gst":[],"sky":[]}`
+}
+
+// privacyLeaks matches coordinates more precise than truncate:2 keeps, and any coordinates once they're redacted
+var privacyLeaks = map[string]*regexp.Regexp{
+	"truncate:2": regexp.MustCompile(`37\.77\d|122\.41\d|2706180|ecef`),
+	"redact":     regexp.MustCompile(`37\.77|122\.41|2706180|ecef`),
+}
+
+func TestPrivacy(t *testing.T) {
+	defer func(mode privacyFlag, retention time.Duration) { privacy, *historyRetention = mode, retention }(privacy, *historyRetention)
+	*historyRetention = time.Hour
+	for mode, leaks := range privacyLeaks {
+		t.Run(mode, func(t *testing.T) {
+			if err := privacy.Set(mode); err != nil {
+				t.Fatal(err)
+			}
+			check := func(path, output string) {
+				t.Helper()
+				if leak := leaks.FindString(output); leak != "" {
+					t.Errorf("%s exposes %q in %s", path, leak, output)
+				}
+			}
+			number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+			reg := prometheus.NewRegistry()
+			e := newExporter("localhost:2947", reg)
+			for _, tpv := range privateTPVs {
+				if err := e.processLine(privatePOLL(tpv)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Metrics, including the average position and those derived from the position
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, family := range families {
+				for _, m := range family.GetMetric() {
+					check(family.GetName(), number(m.GetGauge().GetValue())+" "+number(m.GetCounter().GetValue())+" "+number(m.GetUntyped().GetValue()))
+				}
+			}
+			if _, ok := e.latest["tpv"].(*TPV); !ok {
+				t.Fatal("no TPV exported")
+			}
+
+			// History and trips as served by the API
+			sources := &sourceSet{}
+			sources.add(e, nil)
+			for path, h := range map[string]http.HandlerFunc{
+				"/api/v1/history.geojson": historyHandler(sources),
+				"/api/v1/trips":           tripsHandler(sources),
+			} {
+				w := httptest.NewRecorder()
+				h(w, httptest.NewRequest(http.MethodGet, path+"?from=2024-06-01T00:00:00Z&to=2024-06-02T00:00:00Z", nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("%s got status %d", path, w.Code)
+				}
+				check(path, w.Body.String())
+			}
+			if len(e.recentTrips()) != 1 {
+				t.Errorf("got %d trips, want 1", len(e.recentTrips()))
+			}
+			if points := e.historyBetween(time.Time{}, time.Now()); (mode == "redact") != (len(points) == 0) {
+				t.Errorf("kept a history of %d devices", len(points))
+			}
+
+			// SNMP latitude and longitude, in millionths of a degree
+			var snmp []string
+			for _, v := range snmpVars(oid{1, 3, 6, 1, 4, 1, 32473, 2947}, []*exporter{e}) {
+				if tag, value, _, err := readTLV(v.value); err == nil && tag == berInteger {
+					n, _ := decodeInt(value)
+					snmp = append(snmp, number(float64(n)/1e6))
+				}
+			}
+			check("SNMP", strings.Join(snmp, " "))
+
+			// Lines relayed to gpsd clients
+			r := newLineRelay(prometheus.NewRegistry())
+			client := &relayClient{lines: make(chan string, len(privateTPVs)), watching: true}
+			r.clients[client] = struct{}{}
+			for _, tpv := range privateTPVs {
+				r.publish(tpv)
+			}
+			r.publish(privatePOLL(privateTPVs[0]))
+			close(client.lines)
+			for line := range client.lines {
+				check("relay", line)
+			}
+			check("relayed POLL", r.last["POLL"])
+
+			// Recent messages, including NMEA sentences
+			messages := newMessageRing(4)
+			messages.add("localhost:2947", privateTPVs[0], nil)
+			messages.add("localhost:2947", privatePOLL(privateTPVs[1]), nil)
+			messages.add("nmea", "$GPGGA,120000,3746.4957,N,12225.1649,W,1,08,0.9,62.3,M,-32.1,M,,*4B", nil)
+			for _, m := range messages.list() {
+				check("recent messages", m.Line)
+			}
+			if got := messages.list()[2].Line; got != "$GPGGA,<redacted>" {
+				t.Errorf("recent messages kept NMEA sentence %q", got)
+			}
+
+			// Raw command output, from a gpsd answering ?POLL with the reports
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				fmt.Fprintln(conn, `{"class":"VERSION","release":"3.25","proto_major":3,"proto_minor":15}`)
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					return
+				}
+				fmt.Fprintln(conn, privatePOLL(privateTPVs[0]))
+				fmt.Fprintln(conn, privateTPVs[1])
+			}()
+			c := &gpsdClient{addr: ln.Addr().String(), dialer: proxy.Direct}
+			lines, err := c.rawCommand("?POLL;")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != 2 {
+				t.Errorf("got %d lines from the raw command, want 2", len(lines))
+			}
+			for _, line := range lines {
+				check("raw command", line)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// errUnsupportedProtocol is returned when gpsd announces a protocol version the exporter doesn't support
+var errUnsupportedProtocol = errors.New("unsupported gpsd protocol")
+
+// gpsdProtocol is a gpsd JSON protocol version as announced in the VERSION message
+type gpsdProtocol struct {
+	major, minor int
+}
+
+// minPollProtocol is the first protocol version with the ?POLL command. Older releases are read in watcher mode instead.
+var minPollProtocol = gpsdProtocol{3, 1}
+
+// modernReportProtocol is the protocol version of gpsd 3.20, which split the TPV alt into altHAE and altMSL,
+// added nSat and uSat to SKY, and named the POLL arrays tpv and sky rather than fixes and skyviews
+var modernReportProtocol = gpsdProtocol{3, 14}
+
+func (p gpsdProtocol) String() string {
+	return fmt.Sprintf("%d.%d", p.major, p.minor)
+}
+
+// known reports whether a VERSION message has been received
+func (p gpsdProtocol) known() bool {
+	return p != gpsdProtocol{}
+}
+
+// atLeast reports whether p is the same as or newer than o
+func (p gpsdProtocol) atLeast(o gpsdProtocol) bool {
+	return p.major > o.major || (p.major == o.major && p.minor >= o.minor)
+}
+
+// supported reports whether the exporter understands p. Protocol 3 is the JSON protocol gpsd has spoken since 2.90.
+func (p gpsdProtocol) supported() bool {
+	return p.major == 3
+}
+
+// streamedReports creates the report struct for each class gpsd streams in watcher mode
+var streamedReports = map[string]func() any{
+	"TPV":  func() any { return &TPV{} },
+	"SKY":  func() any { return &SKY{} },
+	"GST":  func() any { return &GST{} },
+	"PPS":  func() any { return &PPS{} },
+	"TOFF": func() any { return &TOFF{} },
+	"OSC":  func() any { return &OSC{} },
+	"ATT":  func() any { return &ATT{} },
+}
+
+// setVersion exports the gpsd release from a VERSION message, counting a restart when it differs from the one seen before reconnecting
+func (e *exporter) setVersion(m map[string]interface{}) {
+	release, _ := m["release"].(string)
+	rev, _ := m["rev"].(string)
+	identity := release + " " + rev
+
+	e.mu.Lock()
+	previous := e.identity
+	e.identity = identity
+	e.handshake = time.Now()
+	e.mu.Unlock()
+	if previous == identity {
+		return
+	}
+	if previous != "" {
+		log.Infof("gpsd changed from %s to %s", previous, identity)
+		e.restarts.Inc()
+	}
+	// Only the current version is exported, so a stale series isn't left behind after an upgrade
+	e.version.Reset()
+	e.version.With(prometheus.Labels{"version": fmt.Sprintf("GPSD v%s", release), "rev": rev}).Set(1)
+}
+
+// setProtocol records the protocol version from a VERSION message
+func (e *exporter) setProtocol(m map[string]interface{}) error {
+	major, _ := m["proto_major"].(float64)
+	minor, _ := m["proto_minor"].(float64)
+	p := gpsdProtocol{int(major), int(minor)}
+
+	e.mu.Lock()
+	e.protocol = p
+	e.mu.Unlock()
+	e.protoMajor.Set(major)
+	e.protoMinor.Set(minor)
+
+	if !p.supported() {
+		return fmt.Errorf("%w %s", errUnsupportedProtocol, p)
+	}
+	if !p.atLeast(minPollProtocol) {
+		log.Warnf("gpsd protocol %s predates ?POLL, reading watcher reports instead", p)
+	}
+	return nil
+}
+
+// streaming reports whether reports are read from watcher mode rather than POLL responses
+func (e *exporter) streaming() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.protocol.known() && !e.protocol.atLeast(minPollProtocol)
+}
+
+// legacyReports reports whether gpsd predates the report fields of gpsd 3.20, so its reports need upgradeReport
+func (e *exporter) legacyReports() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.protocol.known() && !e.protocol.atLeast(modernReportProtocol)
+}
+
+// upgradeReport fills in the fields of a report from gpsd before 3.20 that it named differently or left out
+func upgradeReport(report any) {
+	switch r := report.(type) {
+	case *TPV:
+		if r.AltMSL == 0 {
+			r.AltMSL = r.Alt
+		}
+	case *SKY:
+		if r.NSat == 0 && r.USat == 0 {
+			r.NSat = float64(len(r.Satellites))
+			for _, sat := range r.Satellites {
+				if sat.Used {
+					r.USat++
+				}
+			}
+		}
+	}
+}
+
+// processStreamed updates metrics from a single report streamed in watcher mode
+func (e *exporter) processStreamed(class, line string) error {
+	report := streamedReports[class]()
+	if err := json.Unmarshal([]byte(line), report); err != nil {
+		return fmt.Errorf("unmarshalling %s: %w", class, err)
+	}
+	log.Tracef("%s: %+v", class, report)
+	if att, ok := report.(*ATT); ok && !strings.HasPrefix(att.Device, n2kDevicePrefix) && !*movingBase {
+		return nil // Attitude of other devices is only exported for their heading with -gpsd.heading
+	}
+	if e.legacyReports() {
+		upgradeReport(report)
+	}
+	e.handleReport(strings.ToLower(class), report)
+	if *strict || *autoDiscover {
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &raw); err == nil {
+			e.inspectFields(strings.ToLower(class), raw)
+		}
+	}
+	return nil
+}
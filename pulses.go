@@ -0,0 +1,28 @@
+package main
+
+import "math"
+
+// observePulse exports the gap since the device's previous PPS pulse and counts the pulses missing from it, which needs every pulse
+// so only runs with -pps.watch or the pps WATCH option. Gaps of more than a minute are taken as gpsd or the device restarting rather than missing pulses.
+func (e *exporter) observePulse(pps *PPS, pulse float64) {
+	if !watchOptions["pps"] {
+		return
+	}
+	missing := e.missingPulses.WithLabelValues(pps.Device) // Exported from zero so increase() sees the first missing pulse
+	previous, ok := e.pulses[pps.Device]
+	if ok && pulse <= previous {
+		return // A POLL response answered after newer pulses were streamed
+	}
+	e.pulses[pps.Device] = pulse
+	if !ok {
+		return
+	}
+	interval := pulse - previous
+	e.series(e.pulseInterval, pps.Device).Set(interval)
+	if interval > 60 {
+		return
+	}
+	if n := math.Round(interval/ppsCadence.Seconds()) - 1; n > 0 {
+		missing.Add(n)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// qErrSample is a PPS quantization error kept for the rolling RMS
+type qErrSample struct {
+	time  time.Time
+	value float64 // Seconds
+}
+
+// observeQErr records the quantization error of a new PPS pulse and exports its RMS over -pps.qerr-window.
+// Receivers that don't report the sawtooth error are skipped.
+func (e *exporter) observeQErr(pps *PPS) {
+	if pps.QErr == 0 {
+		return
+	}
+	qErr := pps.QErr / 1e12
+	e.qErr.WithLabelValues(pps.Device).Observe(qErr)
+
+	now := time.Now()
+	samples := append(e.qErrSamples[pps.Device], qErrSample{now, qErr})
+	i := 0
+	for i < len(samples) && now.Sub(samples[i].time) > *qErrWindow {
+		i++
+	}
+	samples = samples[i:]
+	e.qErrSamples[pps.Device] = samples
+
+	var sum float64
+	for _, s := range samples {
+		sum += s.value * s.value
+	}
+	e.series(e.qErrRMS, pps.Device).Set(math.Sqrt(sum / float64(len(samples))))
+}
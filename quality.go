@@ -0,0 +1,27 @@
+package main
+
+// qualityLevels are the signal quality states of gpsd's quality indicator by its value, which is the highest for 5 to 7
+var qualityLevels = []string{"no_signal", "searching", "acquired", "unusable", "code_locked", "carrier_locked", "carrier_locked", "carrier_locked"}
+
+// updateQuality exports the quality indicator of a device's SKY report as a state set, with a 1 for the current level
+func (e *exporter) updateQuality(sky *SKY) {
+	if sky.Qual == nil {
+		return
+	}
+	q := int(*sky.Qual)
+	if q < 0 || q >= len(qualityLevels) {
+		return
+	}
+	e.series(e.deviceQuality, sky.Device).Set(*sky.Qual)
+	current := qualityLevels[q]
+	for i, level := range qualityLevels {
+		if i > 0 && level == qualityLevels[i-1] {
+			continue
+		}
+		if level == current {
+			e.pairSeries(e.signalQuality, sky.Device, level).Set(1)
+		} else {
+			e.pairSeries(e.signalQuality, sky.Device, level).Set(0)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// receiverIdentities holds the receiver behind each device of each target, from gpsd's DEVICES and DEVICE messages
+type receiverIdentities struct {
+	sync.Mutex
+	names map[string]map[string]string // Receiver by device by target
+}
+
+// receivers are the receivers of all targets, looked up when gathering to label per-device metrics with -metrics.receiver-label
+var receivers = &receiverIdentities{names: map[string]map[string]string{}}
+
+// receiverName returns a name identifying the receiver of a device across reboots: its driver and the first field of its subtype,
+// which is typically the model or firmware version. It's empty until gpsd has identified the driver.
+func receiverName(d DEVICE) string {
+	if d.Driver == "" {
+		return ""
+	}
+	subtype := strings.TrimSpace(strings.SplitN(d.Subtype, ",", 2)[0])
+	if subtype == "" {
+		return d.Driver
+	}
+	return d.Driver + " " + subtype
+}
+
+// lookup returns the receiver of a device of a target, or of the device of any target when target is empty
+func (r *receiverIdentities) lookup(target, device string) string {
+	r.Lock()
+	defer r.Unlock()
+	if target != "" {
+		return r.names[target][device]
+	}
+	for _, devices := range r.names {
+		if name, ok := devices[device]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// updateReceivers records the receivers of the devices gpsd listed, replacing the receivers of devices it no longer lists
+func (e *exporter) updateReceivers(devices []DEVICE) {
+	current := map[string]string{}
+	for _, d := range devices {
+		if name := receiverName(d); name != "" {
+			current[d.Path] = name
+		}
+	}
+	receivers.Lock()
+	receivers.names[e.target] = current
+	receivers.Unlock()
+
+	e.receiverInfo.Reset()
+	for _, d := range devices {
+		if name, ok := current[d.Path]; ok {
+			e.receiverInfo.WithLabelValues(d.Path, name, d.Driver, d.Subtype).Set(1)
+		}
+	}
+}
+
+// updateReceiver records the receiver of a device from a DEVICE message, which gpsd sends when it identifies a device after listing it
+func (e *exporter) updateReceiver(d DEVICE) {
+	name := receiverName(d)
+	if name == "" {
+		return
+	}
+	receivers.Lock()
+	devices, ok := receivers.names[e.target]
+	if !ok {
+		devices = map[string]string{}
+		receivers.names[e.target] = devices
+	}
+	previous := devices[d.Path]
+	devices[d.Path] = name
+	receivers.Unlock()
+
+	if previous != name {
+		e.receiverInfo.DeletePartialMatch(prometheus.Labels{"device": d.Path})
+		e.receiverInfo.WithLabelValues(d.Path, name, d.Driver, d.Subtype).Set(1)
+	}
+}
+
+// receiverGatherer adds a receiver label to the metrics of a gatherer with a device label, once gpsd has identified the device
+type receiverGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer
+func (g receiverGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	for _, family := range families {
+		for _, m := range family.Metric {
+			var target, device string
+			labelled := false
+			for _, l := range m.Label {
+				switch l.GetName() {
+				case "target":
+					target = l.GetValue()
+				case "device":
+					device = l.GetValue()
+				case "receiver":
+					labelled = true
+				}
+			}
+			if device == "" || labelled {
+				continue
+			}
+			if name := receivers.lookup(target, device); name != "" {
+				label, value := "receiver", name
+				m.Label = append(m.Label, &dto.LabelPair{Name: &label, Value: &value})
+				sort.Slice(m.Label, func(i, j int) bool { return m.Label[i].GetName() < m.Label[j].GetName() })
+			}
+		}
+	}
+	return families, err
+}
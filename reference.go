@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// referencePosition is the known position of a static antenna
+type referencePosition struct {
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+	Alt       float64   `json:"alt"` // MSL, zero if unknown
+	LearnedAt time.Time `json:"learned_at,omitempty"`
+}
+
+// parseReference parses a reference position in lat,lon[,alt] form
+func parseReference(value string) (*referencePosition, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid reference position %q (expected lat,lon[,alt])", value)
+	}
+	var coords [3]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference position %q: %w", value, err)
+		}
+		coords[i] = n
+	}
+	return &referencePosition{Lat: coords[0], Lon: coords[1], Alt: coords[2]}, nil
+}
+
+// referenceFileMu serializes updates of the reference file, which holds the learned positions of every target
+var referenceFileMu sync.Mutex
+
+// readReferences reads the learned reference positions by target
+func readReferences() (map[string]*referencePosition, error) {
+	refs := map[string]*referencePosition{}
+	b, err := os.ReadFile(*referenceFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refs, json.Unmarshal(b, &refs)
+}
+
+// loadReference sets the reference position from -reference.position or, when learning, a position learned before a restart
+func (e *exporter) loadReference() error {
+	if *referencePos != "" {
+		ref, err := parseReference(*referencePos)
+		if err != nil {
+			return err
+		}
+		e.reference.pos = ref
+		return nil
+	}
+	if *referenceAuto <= 0 {
+		return nil
+	}
+	referenceFileMu.Lock()
+	defer referenceFileMu.Unlock()
+	refs, err := readReferences()
+	if err != nil {
+		return fmt.Errorf("reading reference positions from %s: %w", *referenceFile, err)
+	}
+	if ref, ok := refs[e.target]; ok {
+		log.Infof("Using reference position %f,%f learned at %s for %s", ref.Lat, ref.Lon, ref.LearnedAt.Format(time.RFC3339), e.target)
+		e.reference.pos = ref
+	}
+	return nil
+}
+
+// saveReference persists a learned reference position so it survives restarts
+func (e *exporter) saveReference(ref *referencePosition) error {
+	referenceFileMu.Lock()
+	defer referenceFileMu.Unlock()
+	refs, err := readReferences()
+	if err != nil {
+		return err
+	}
+	refs[e.target] = ref
+	b, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := *referenceFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *referenceFile)
+}
+
+// referenceState learns and holds the reference position of a source
+type referenceState struct {
+	pos              *referencePosition // Nil until known
+	start, last      time.Time          // First and latest fix sampled while learning
+	lats, lons, alts []float64
+}
+
+// learn samples fixes at most once a second and returns the median position once -reference.auto has passed
+func (r *referenceState) learn(tpv *TPV, t time.Time) *referencePosition {
+	if r.start.IsZero() {
+		r.start = t
+	}
+	if !r.last.IsZero() && t.Sub(r.last) < time.Second {
+		return nil
+	}
+	r.last = t
+	r.lats = append(r.lats, tpv.Lat)
+	r.lons = append(r.lons, tpv.Lon)
+	if tpv.Mode >= 3 && tpv.AltMSL != 0 {
+		r.alts = append(r.alts, tpv.AltMSL)
+	}
+	if t.Sub(r.start) < *referenceAuto {
+		return nil
+	}
+	ref := &referencePosition{Lat: median(r.lats), Lon: median(r.lons), LearnedAt: t.UTC()}
+	if len(r.alts) > 0 {
+		ref.Alt = median(r.alts)
+	}
+	r.lats, r.lons, r.alts = nil, nil, nil
+	return ref
+}
+
+// updateReference exports how far a fix and the average position are from the reference position, learning it first if needed
+func (e *exporter) updateReference(m *motionState, tpv *TPV, t time.Time) {
+	r := &e.reference
+	if r.pos == nil {
+		if *referenceAuto <= 0 {
+			return
+		}
+		ref := r.learn(tpv, t)
+		e.referenceLearning.Set(math.Min(t.Sub(r.start).Seconds()/referenceAuto.Seconds(), 1))
+		if ref == nil {
+			return
+		}
+		log.Infof("Learned reference position %f,%f for %s", ref.Lat, ref.Lon, e.target)
+		if err := e.saveReference(ref); err != nil {
+			log.Warnf("Error saving reference position to %s: %v", *referenceFile, err)
+		}
+		r.pos = ref
+	}
+	e.referenceLearning.Set(1)
+
+	e.series(e.referenceDistance, tpv.Device).Set(distance(r.pos.Lat, r.pos.Lon, tpv.Lat, tpv.Lon))
+	if m.averaged {
+		e.series(e.referenceDrift, tpv.Device).Set(distance(r.pos.Lat, r.pos.Lon, m.averageLat, m.averageLon))
+	}
+	if r.pos.Alt != 0 && tpv.Mode >= 3 && tpv.AltMSL != 0 {
+		e.series(e.referenceVertical, tpv.Device).Set(tpv.AltMSL - r.pos.Alt)
+	}
+}
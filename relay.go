@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// relayBuffer is the number of lines queued for a relay client before further ones are dropped
+const relayBuffer = 256
+
+// lineRelay re-serves the JSON gpsd streams to clients speaking the gpsd protocol, such as xgps and gpspipe,
+// so they share the exporter's connection rather than each opening their own over a slow link
+type lineRelay struct {
+	mu      sync.Mutex
+	clients map[*relayClient]struct{}
+	last    map[string]string // Latest VERSION, DEVICES and POLL line, which answer the matching commands
+	active  prometheus.Gauge
+	dropped prometheus.Counter
+}
+
+// relayClient is a client connected to the relay
+type relayClient struct {
+	lines    chan string
+	watching bool // Whether the client enabled watcher mode, guarded by the relay's mu
+}
+
+// relay is nil unless -relay.listen is set
+var relay *lineRelay
+
+// unrelayedClasses are replies to the exporter's own commands, which relay clients get in reply to theirs instead
+var unrelayedClasses = map[string]bool{"VERSION": true, "WATCH": true, "POLL": true, "ERROR": true}
+
+func newLineRelay(reg prometheus.Registerer) *lineRelay {
+	factory := promauto.With(reg)
+	return &lineRelay{
+		clients: map[*relayClient]struct{}{},
+		last:    map[string]string{},
+		active: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_exporter_relay_clients",
+			Help: "Number of clients connected to the -relay.listen relay",
+		}),
+		dropped: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_exporter_relay_dropped_lines_total",
+			Help: "Number of lines dropped for relay clients too slow to keep up",
+		}),
+	}
+}
+
+// publish relays a line from gpsd to the watching clients
+func (r *lineRelay) publish(line string) {
+	if r == nil {
+		return
+	}
+	class, err := peekClass(line)
+	if err != nil {
+		return
+	}
+	line = privacy.filterLine(line)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch class {
+	case "VERSION", "DEVICES", "POLL":
+		r.last[class] = line
+	}
+	if unrelayedClasses[class] {
+		return
+	}
+	for c := range r.clients {
+		if !c.watching {
+			continue
+		}
+		select {
+		case c.lines <- line:
+		default: // Drop lines for slow clients rather than blocking the reader
+			r.dropped.Inc()
+		}
+	}
+}
+
+// serve accepts relay clients on l
+func (r *lineRelay) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Errorf("Error accepting relay client: %v", err)
+			return
+		}
+		go r.handle(conn)
+	}
+}
+
+// handle greets a client with gpsd's VERSION banner and answers its commands until it disconnects
+func (r *lineRelay) handle(conn net.Conn) {
+	log.Debugf("Relay client %s connected", conn.RemoteAddr())
+	c := &relayClient{lines: make(chan string, relayBuffer)}
+	r.mu.Lock()
+	r.clients[c] = struct{}{}
+	if version, ok := r.last["VERSION"]; ok {
+		c.lines <- version
+	}
+	r.mu.Unlock()
+	r.active.Inc()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		failed := false
+		for line := range c.lines {
+			if failed {
+				continue // Until the reader notices the connection is closed
+			}
+			if _, err := conn.Write([]byte(line + "\r\n")); err != nil {
+				failed = true
+				_ = conn.Close()
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		for _, command := range strings.Split(scanner.Text(), ";") {
+			if command = strings.TrimSpace(command); command != "" {
+				r.command(c, command)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.clients, c)
+	r.mu.Unlock()
+	close(c.lines)
+	<-done
+	_ = conn.Close()
+	r.active.Dec()
+	log.Debugf("Relay client %s disconnected", conn.RemoteAddr())
+}
+
+// command answers a command from a relay client from the latest replies gpsd sent the exporter
+func (r *lineRelay) command(c *relayClient, command string) {
+	name, arg, _ := strings.Cut(command, "=")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply := func(line string) {
+		select {
+		case c.lines <- line:
+		default:
+			r.dropped.Inc()
+		}
+	}
+	switch name {
+	case "?VERSION", "?DEVICES", "?POLL":
+		if line, ok := r.last[strings.TrimPrefix(name, "?")]; ok {
+			reply(line)
+		} else {
+			reply(relayError(fmt.Sprintf("No %s from gpsd yet", name[1:])))
+		}
+	case "?WATCH":
+		if arg != "" {
+			policy := struct {
+				Enable *bool `json:"enable"`
+			}{}
+			if err := json.Unmarshal([]byte(arg), &policy); err != nil {
+				reply(relayError("Invalid WATCH: " + err.Error()))
+				return
+			}
+			c.watching = policy.Enable == nil || *policy.Enable
+		}
+		if devices, ok := r.last["DEVICES"]; ok && c.watching {
+			reply(devices)
+		}
+		reply(fmt.Sprintf(`{"class":"WATCH","enable":%t,"json":%t}`, c.watching, c.watching))
+	default:
+		reply(relayError(fmt.Sprintf("Unrecognized request '%s'", strings.TrimPrefix(name, "?"))))
+	}
+}
+
+// relayError returns an ERROR message as gpsd sends it
+func relayError(message string) string {
+	line, _ := json.Marshal(map[string]string{"class": "ERROR", "message": message})
+	return string(line)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// rulesTemplate is a Prometheus rule file covering the most common gpsd failure modes
+var rulesTemplate = template.Must(template.New("rules").Parse(`groups:
+  - name: {{ .Namespace }}
+    rules:
+      - alert: GPSDDisconnected
+        expr: {{ .Up }} == 0
+        for: {{ .For }}
+        labels:
+          severity: critical
+        annotations:
+          summary: "gpsd-exporter on {{ "{{" }} $labels.instance {{ "}}" }} is not connected to gpsd"
+      - alert: GPSDNoFix
+        expr: {{ .Mode }} < 2
+        for: {{ .For }}
+        labels:
+          severity: critical
+        annotations:
+          summary: "GPS receiver on {{ "{{" }} $labels.instance {{ "}}" }} has no 2D or 3D fix"
+      - alert: GPSDHighDOP
+        expr: {{ .HDOP }} > {{ .MaxHDOP }}
+        for: {{ .For }}
+        labels:
+          severity: warning
+        annotations:
+          summary: "HDOP on {{ "{{" }} $labels.instance {{ "}}" }} is {{ "{{" }} $value {{ "}}" }} (threshold {{ .MaxHDOP }})"
+      - alert: GPSDSatellitesLow
+        expr: {{ .SatellitesUsed }} < {{ .MinSatellites }}
+        for: {{ .For }}
+        labels:
+          severity: warning
+        annotations:
+          summary: "Only {{ "{{" }} $value {{ "}}" }} satellites used on {{ "{{" }} $labels.instance {{ "}}" }} (threshold {{ .MinSatellites }})"
+      - alert: GPSDPPSMissing
+        expr: changes({{ .PPSSeconds }}[{{ .PPSWindow }}]) == 0
+        for: {{ .For }}
+        labels:
+          severity: critical
+        annotations:
+          summary: "No PPS pulses reported on {{ "{{" }} $labels.instance {{ "}}" }} in the last {{ .PPSWindow }}"
+      - alert: GPSDAntennaFault
+        expr: {{ .Namespace }}_antenna_status{state!="ok"} == 1
+        for: {{ .For }}
+        labels:
+          severity: critical
+        annotations:
+          summary: "Antenna of {{ "{{" }} $labels.device {{ "}}" }} on {{ "{{" }} $labels.instance {{ "}}" }} is {{ "{{" }} $labels.state {{ "}}" }}"
+      - alert: GPSDDGPSCorrectionsStale
+        expr: {{ .Namespace }}_dgps_corrections_stale == 1
+        for: {{ .For }}
+        labels:
+          severity: warning
+        annotations:
+          summary: "DGPS corrections of {{ "{{" }} $labels.device {{ "}}" }} on {{ "{{" }} $labels.instance {{ "}}" }} are stale or missing"
+      - alert: GPSDImplausibleJump
+        expr: increase({{ .Namespace }}_anomalies_total[10m]) > 0
+        labels:
+          severity: critical
+        annotations:
+          summary: "Fix of {{ "{{" }} $labels.device {{ "}}" }} on {{ "{{" }} $labels.instance {{ "}}" }} showed a {{ "{{" }} $labels.type {{ "}}" }}, a possible sign of spoofing"
+`))
+
+// runRules prints a set of alerting rules to stdout
+func runRules(args []string) {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	ruleNamespace := fs.String("namespace", "gpsd", "metric namespace, for metrics renamed when scraped")
+	forDuration := fs.Duration("for", 5*time.Minute, "duration a condition must hold before alerting")
+	maxHDOP := fs.Float64("max-hdop", 5, "HDOP above which to alert")
+	minSatellites := fs.Int("min-satellites", 4, "number of used satellites below which to alert")
+	ppsWindow := fs.Duration("pps-window", 5*time.Minute, "window without PPS pulses after which to alert")
+	_ = fs.Parse(args)
+
+	// Metric names follow -metrics.legacy-names, with the namespace swapped in
+	name := func(namespace, field string) string {
+		n, _ := metricName(namespace, field)
+		return strings.Replace(n, "gpsd_", *ruleNamespace+"_", 1)
+	}
+
+	if err := rulesTemplate.Execute(os.Stdout, struct {
+		Namespace      string
+		Up             string
+		Mode           string
+		HDOP           string
+		SatellitesUsed string
+		PPSSeconds     string
+		For            string
+		MaxHDOP        float64
+		MinSatellites  int
+		PPSWindow      string
+	}{
+		Namespace:      *ruleNamespace,
+		Up:             *ruleNamespace + "_up",
+		Mode:           name("tpv", "mode"),
+		HDOP:           name("sky", "hdop"),
+		SatellitesUsed: name("sky", "uSat"),
+		PPSSeconds:     name("pps", "real_sec"),
+		For:            promDuration(*forDuration),
+		MaxHDOP:        *maxHDOP,
+		MinSatellites:  *minSatellites,
+		PPSWindow:      promDuration(*ppsWindow),
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// promDuration formats a duration in Prometheus duration syntax (Go's "5m0s" is not valid there)
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// satelliteKey identifies a per-satellite series by metric name and PRN
+type satelliteKey struct {
+	name, prn string
+}
+
+// satelliteSnapshot exports the per-satellite metrics as of the latest complete SKY report.
+// Reports update the staged values one PRN at a time, and publish swaps in the metrics built from them, so a scrape never mixes two reports.
+type satelliteSnapshot struct {
+	descs  map[string]*prometheus.Desc // Guarded by reportMu, like staged
+	staged map[satelliteKey]float64
+
+	mu        sync.Mutex
+	published []prometheus.Metric
+}
+
+// newSatelliteSnapshot returns an empty satellite snapshot
+func newSatelliteSnapshot() *satelliteSnapshot {
+	return &satelliteSnapshot{
+		descs:  map[string]*prometheus.Desc{},
+		staged: map[satelliteKey]float64{},
+	}
+}
+
+// set stages the value of a per-satellite metric
+func (s *satelliteSnapshot) set(name, help, prn string, v float64) {
+	if _, ok := s.descs[name]; !ok {
+		s.descs[name] = prometheus.NewDesc(name, help, []string{"prn"}, nil)
+	}
+	s.staged[satelliteKey{name, prn}] = v
+}
+
+// delete unstages a per-satellite metric
+func (s *satelliteSnapshot) delete(name, prn string) {
+	delete(s.staged, satelliteKey{name, prn})
+}
+
+// deletePrefix unstages the metrics whose name starts with prefix
+func (s *satelliteSnapshot) deletePrefix(prefix string) {
+	for key := range s.staged {
+		if strings.HasPrefix(key.name, prefix) {
+			delete(s.staged, key)
+		}
+	}
+}
+
+// publish makes the staged values the ones scrapes see
+func (s *satelliteSnapshot) publish() {
+	metrics := make([]prometheus.Metric, 0, len(s.staged))
+	for key, v := range s.staged {
+		metrics = append(metrics, prometheus.MustNewConstMetric(s.descs[key.name], prometheus.GaugeValue, v, key.prn))
+	}
+	s.mu.Lock()
+	s.published = metrics
+	s.mu.Unlock()
+}
+
+// Describe sends nothing, leaving the snapshot unchecked since its metrics depend on the fields gpsd reports
+func (s *satelliteSnapshot) Describe(chan<- *prometheus.Desc) {}
+
+func (s *satelliteSnapshot) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	metrics := s.published
+	s.mu.Unlock()
+	for _, m := range metrics {
+		ch <- m
+	}
+}
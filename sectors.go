@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// skySectorDegrees is the width of the azimuth sectors used satellites are counted in
+const skySectorDegrees = 30
+
+// skySectorLabels are the sector label values, the azimuth each sector starts at
+var skySectorLabels = func() (labels [360 / skySectorDegrees]string) {
+	for i := range labels {
+		labels[i] = strconv.Itoa(i * skySectorDegrees)
+	}
+	return labels
+}()
+
+// sectorSample is the number of used satellites in each azimuth sector in a SKY report
+type sectorSample struct {
+	time   time.Time
+	counts [len(skySectorLabels)]float64
+}
+
+// sectorState holds the SKY reports of a device within -sky.sector-window and their running totals
+type sectorState struct {
+	samples []sectorSample
+	sums    [len(skySectorLabels)]float64
+}
+
+// updateSectors exports the number of used satellites in each 30° azimuth sector averaged over -sky.sector-window, so a sector
+// that becomes obstructed shows up as a drop compared to the same time a day earlier. Satellites without a position are skipped,
+// as gpsd leaves their azimuth and elevation out, and so are SKY reports without satellites.
+func (e *exporter) updateSectors(sky *SKY) {
+	if len(sky.Satellites) == 0 {
+		return
+	}
+	s, ok := e.sectors[sky.Device]
+	if !ok {
+		s = &sectorState{}
+		e.sectors[sky.Device] = s
+	}
+	now := time.Now()
+	sample := sectorSample{time: now}
+	for i := range sky.Satellites {
+		sat := &sky.Satellites[i]
+		if !sat.Used || (sat.Azimuth == 0 && sat.Elevation == 0) {
+			continue
+		}
+		az := math.Mod(math.Mod(sat.Azimuth, 360)+360, 360)
+		sample.counts[int(az/skySectorDegrees)]++
+	}
+	s.samples = append(s.samples, sample)
+	for i, count := range sample.counts {
+		s.sums[i] += count
+	}
+	i := 0
+	for i < len(s.samples) && now.Sub(s.samples[i].time) > *sectorWindow {
+		for j, count := range s.samples[i].counts {
+			s.sums[j] -= count
+		}
+		i++
+	}
+	s.samples = s.samples[i:]
+
+	for i, sum := range s.sums {
+		e.pairSeries(e.skySectorUsed, sky.Device, skySectorLabels[i]).Set(sum / float64(len(s.samples)))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// unixPrefix marks a listen address as a Unix socket path
+const unixPrefix = "unix:"
+
+// systemdListen is the listen address of a socket passed by systemd socket activation
+const systemdListen = "systemd"
+
+// systemdFirstFD is the first file descriptor passed by systemd (SD_LISTEN_FDS_START)
+const systemdFirstFD = 3
+
+// listen opens the metrics listener on a TCP address, a unix:/path socket, or the socket passed by systemd
+func listen(addr string) (net.Listener, error) {
+	if addr == systemdListen {
+		return systemdListener()
+	}
+	if path := strings.TrimPrefix(addr, unixPrefix); path != addr {
+		// A socket is left behind if the exporter wasn't shut down cleanly, anything else at the path is kept
+		if fi, err := os.Lstat(path); err == nil {
+			if fi.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and isn't a socket", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// systemdListener returns the first socket passed by systemd socket activation
+func systemdListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_PID isn't set to this process)")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_FDS isn't set)")
+	}
+	if n > 1 {
+		log.Warnf("systemd passed %d sockets, serving on the first one only", n)
+	}
+	// The variables are meant for this process only, not for anything it runs
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	syscall.CloseOnExec(systemdFirstFD)
+	f := os.NewFile(systemdFirstFD, "systemd socket")
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket passed by systemd: %w", err)
+	}
+	log.Debugf("Using socket %s passed by systemd", l.Addr())
+	return l, nil
+}
+
+// newServer returns an HTTP server with limits guarding against slow or abusive clients
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: *webReadTimeout,
+		ReadTimeout:       *webReadTimeout,
+		IdleTimeout:       *webIdleTimeout,
+		MaxHeaderBytes:    *webMaxHeaderBytes,
+	}
+}
+
+// withWriteTimeout bounds the time taken to serve each request. The server-wide write timeout can't be used since it would cut off the event stream.
+func withWriteTimeout(h http.Handler) http.Handler {
+	if *webWriteTimeout <= 0 {
+		return h
+	}
+	return http.TimeoutHandler(h, *webWriteTimeout, "request timed out\n")
+}
+
+// metricsHandler serves metrics gathered from g, limiting concurrent scrapes and instrumenting them in registry
+func metricsHandler(registry prometheus.Registerer, g prometheus.Gatherer) http.Handler {
+	// promhttp_metric_handler_requests_in_flight and promhttp_metric_handler_requests_total are added by InstrumentMetricHandler
+	return promhttp.InstrumentMetricHandler(registry, promhttp.InstrumentHandlerDuration(newScrapeDuration(registry),
+		withUnits(promhttp.HandlerFor(g, promhttp.HandlerOpts{
+			EnableOpenMetrics:   true,
+			MaxRequestsInFlight: *webMaxRequests,
+			Registry:            registry,
+		})),
+	))
+}
+
+// newScrapeDuration registers the histogram of /metrics response times with registry
+func newScrapeDuration(registry prometheus.Registerer) *prometheus.HistogramVec {
+	return promauto.With(registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gpsd_exporter_scrape_duration_seconds",
+		Help:    "Time taken to serve /metrics",
+		Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"code"})
+}
+
+// withUnits adds OpenMetrics UNIT lines, which client_golang doesn't write, for the metrics of the catalog with a unit, when OpenMetrics is negotiated.
+// Responses are compressed here rather than by h so the lines can be added to them.
+func withUnits(h http.Handler) http.Handler {
+	units := map[string]string{}
+	for _, e := range metricCatalog() {
+		// OpenMetrics names counter families without _total, and only allows units their name ends with
+		name := strings.TrimSuffix(e.Name, "_total")
+		if e.Unit != "" && strings.HasSuffix(name, "_"+e.Unit) {
+			units[name] = e.Unit
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		var out io.Writer = w
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		r = r.Clone(r.Context())
+		r.Header.Del("Accept-Encoding")
+		uw := &unitWriter{ResponseWriter: w, out: out, units: units}
+		h.ServeHTTP(uw, r)
+		uw.flush()
+	})
+}
+
+// unitWriter writes a UNIT line after the TYPE line of each metric family with a known unit
+type unitWriter struct {
+	http.ResponseWriter
+	out   io.Writer
+	units map[string]string
+	line  []byte // Incomplete line left by the last write
+}
+
+func (u *unitWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			u.line = append(u.line, p...)
+			break
+		}
+		u.line = append(u.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := u.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// flush writes the buffered line, followed by a UNIT line if it's the TYPE line of a family with a unit
+func (u *unitWriter) flush() error {
+	line := u.line
+	u.line = u.line[:0]
+	if _, err := u.out.Write(line); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(u.Header().Get("Content-Type"), "application/openmetrics-text") {
+		return nil
+	}
+	if fields := strings.Fields(string(line)); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+		if unit, ok := u.units[fields[2]]; ok {
+			_, err := fmt.Fprintf(u.out, "# UNIT %s %s\n", fields[2], unit)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metersPerDegree is the length of a degree of latitude, close enough for converting error estimates
+const metersPerDegree = 111320
+
+// smoothingFlag selects the filter applied to exported positions and speeds, in off, alpha:A or kalman:Q form
+type smoothingFlag struct {
+	mode  string
+	param float64 // Weight of each new fix for alpha, variance growth per second for kalman
+}
+
+func (f *smoothingFlag) String() string {
+	if f.mode == "off" {
+		return f.mode
+	}
+	return fmt.Sprintf("%s:%g", f.mode, f.param)
+}
+
+func (f *smoothingFlag) Set(value string) error {
+	mode, param, _ := strings.Cut(value, ":")
+	if mode == "off" && param == "" {
+		f.mode = mode
+		return nil
+	}
+	n, err := strconv.ParseFloat(param, 64)
+	switch {
+	case mode != "alpha" && mode != "kalman":
+		return fmt.Errorf("unknown smoothing filter %q (expected off, alpha:A, or kalman:Q)", value)
+	case err != nil:
+		return fmt.Errorf("invalid %s parameter %q: %w", mode, param, err)
+	case mode == "alpha" && (n <= 0 || n > 1):
+		return fmt.Errorf("alpha must be above 0 and at most 1, got %g", n)
+	case mode == "kalman" && n <= 0:
+		return fmt.Errorf("kalman process noise must be positive, got %g", n)
+	}
+	f.mode, f.param = mode, n
+	return nil
+}
+
+// filter1D smooths a single value
+type filter1D struct {
+	x, p float64 // Estimate and its variance
+	init bool
+}
+
+// update adds a measurement with the given error standard deviation, taken dt seconds after the last, and returns the new estimate.
+// scale converts meters to the measurement's unit for the Kalman filter. Measurements without an error estimate reset the Kalman filter to them.
+func (f *filter1D) update(z, sigma, dt, scale float64) float64 {
+	if !f.init {
+		f.x, f.p, f.init = z, sigma*sigma, true
+		return z
+	}
+	switch smoothing.mode {
+	case "alpha":
+		f.x += smoothing.param * (z - f.x)
+	case "kalman":
+		if sigma <= 0 {
+			f.x, f.p = z, 0
+			break
+		}
+		f.p += smoothing.param * scale * scale * dt
+		k := f.p / (f.p + sigma*sigma)
+		f.x += k * (z - f.x)
+		f.p *= 1 - k
+	}
+	return f.x
+}
+
+// smoother holds the filters of a device
+type smoother struct {
+	last                            time.Time
+	lat, lon, altHAE, altMSL, speed filter1D
+}
+
+// smoothedFields are the TPV fields replaced by their smoothed values, with the raw values exported under a _raw suffix
+var smoothedFields = []string{"lat", "lon", "altHAE", "altMSL", "speed"}
+
+// smooth returns a copy of a TPV report with its position and speed smoothed, or the report itself when smoothing is off or it has no fix
+func (e *exporter) smooth(tpv *TPV) *TPV {
+	t, ok := fixTime(tpv)
+	if smoothing.mode == "off" || !ok {
+		return tpv
+	}
+	s, ok := e.smoothers[tpv.Device]
+	if !ok || t.Before(s.last) {
+		s = &smoother{}
+		e.smoothers[tpv.Device] = s
+	}
+	dt := t.Sub(s.last).Seconds()
+	s.last = t
+
+	lonScale := 1 / (metersPerDegree * math.Cos(tpv.Lat*math.Pi/180))
+	out := *tpv
+	out.Lat = s.lat.update(tpv.Lat, tpv.EPY/metersPerDegree, dt, 1.0/metersPerDegree)
+	out.Lon = s.lon.update(tpv.Lon, tpv.EPX*lonScale, dt, lonScale)
+	out.Speed = s.speed.update(tpv.Speed, tpv.EPS, dt, 1)
+	if tpv.Mode >= 3 {
+		out.AltHAE = s.altHAE.update(tpv.AltHAE, tpv.EPV, dt, 1)
+		out.AltMSL = s.altMSL.update(tpv.AltMSL, tpv.EPV, dt, 1)
+	}
+	return &out
+}
+
+// updateRaw exports the unsmoothed values of the smoothed TPV fields
+func (e *exporter) updateRaw(raw *TPV) {
+	values := map[string]float64{"lat": raw.Lat, "lon": raw.Lon, "altHAE": raw.AltHAE, "altMSL": raw.AltMSL, "speed": raw.Speed}
+	for _, field := range smoothedFields {
+		if privacy.redacts("tpv", field) {
+			continue
+		}
+		name, scale := metricName("tpv", field)
+		name += "_raw"
+		g, ok := e.gauges[name]
+		if !ok {
+			g = e.factory.NewGauge(prometheus.GaugeOpts{
+				Name: name,
+				Help: fmt.Sprintf("Unsmoothed TPV %s", field),
+			})
+			e.gauges[name] = g
+		}
+		g.Set(values[field] * scale)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BER tags of the SNMP types the agent speaks
+const (
+	berInteger        = 0x02
+	berOctetString    = 0x04
+	berNull           = 0x05
+	berOID            = 0x06
+	berSequence       = 0x30
+	berGauge32        = 0x42
+	berNoSuchObject   = 0x80
+	berEndOfMibView   = 0x82
+	pduGetRequest     = 0xa0
+	pduGetNextRequest = 0xa1
+	pduGetResponse    = 0xa2
+	pduSetRequest     = 0xa3
+	pduTrap           = 0xa4
+	pduGetBulkRequest = 0xa5
+	pduSNMPv2Trap     = 0xa7
+	pduReport         = 0xa8
+)
+
+// Error statuses of responses
+const (
+	snmpTooBig      = 1
+	snmpNoSuchName  = 2 // SNMPv1 status of a request for a missing object, or to set one
+	snmpGenErr      = 5
+	snmpNotWritable = 17
+)
+
+// snmpMaxMessageSize caps responses to what fits in an Ethernet frame, the size managers can be expected to accept
+const snmpMaxMessageSize = 1472
+
+// snmpMaxRepetitions caps GETBULK requests so responses fit in a datagram
+const snmpMaxRepetitions = 50
+
+var errBER = errors.New("malformed BER")
+
+// oid is an SNMP object identifier
+type oid []int
+
+func parseOID(s string) (oid, error) {
+	var o oid
+	for _, part := range strings.Split(strings.Trim(s, "."), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		o = append(o, n)
+	}
+	if len(o) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	return o, nil
+}
+
+func (o oid) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// compare orders OIDs lexicographically, as MIB walks do
+func (o oid) compare(other oid) int {
+	for i := 0; i < len(o) && i < len(other); i++ {
+		if o[i] != other[i] {
+			if o[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(o) - len(other)
+}
+
+func (o oid) child(arcs ...int) oid {
+	return append(append(oid{}, o...), arcs...)
+}
+
+// readTLV splits the first BER element off b
+func readTLV(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errBER
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < size {
+			return 0, nil, nil, errBER
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if n < 0 || len(b) < n {
+		return 0, nil, nil, errBER
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+func encodeTLV(tag byte, value []byte) []byte {
+	n := len(value)
+	if n < 0x80 {
+		return append([]byte{tag, byte(n)}, value...)
+	}
+	// Long form: the number of length bytes, then the length big-endian in as few bytes as it takes
+	var length []byte
+	for ; n > 0; n >>= 8 {
+		length = append([]byte{byte(n)}, length...)
+	}
+	return append(append([]byte{tag, 0x80 | byte(len(length))}, length...), value...)
+}
+
+func encodeSequence(tag byte, elements ...[]byte) []byte {
+	var value []byte
+	for _, e := range elements {
+		value = append(value, e...)
+	}
+	return encodeTLV(tag, value)
+}
+
+// encodeInt encodes v in the fewest two's complement bytes, as INTEGER and, for non-negative values, Gauge32 need
+func encodeInt(tag byte, v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return encodeTLV(tag, b)
+}
+
+func decodeInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errBER
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+func encodeOID(o oid) []byte {
+	b := []byte{byte(40*o[0] + o[1])}
+	for _, n := range o[2:] {
+		arc := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			arc = append([]byte{byte(n&0x7f) | 0x80}, arc...)
+		}
+		b = append(b, arc...)
+	}
+	return encodeTLV(berOID, b)
+}
+
+func decodeOID(b []byte) (oid, error) {
+	if len(b) == 0 {
+		return nil, errBER
+	}
+	o := oid{int(b[0]) / 40, int(b[0]) % 40}
+	n := 0
+	for _, c := range b[1:] {
+		n = n<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			o = append(o, n)
+			n = 0
+		}
+	}
+	return o, nil
+}
+
+// snmpVar is an object exported by the agent, with its encoded value
+type snmpVar struct {
+	oid   oid
+	value []byte
+}
+
+// Columns of gpsdTable, indexed by snmpIndex of the source's target
+const (
+	snmpColTarget = iota + 2
+	snmpColConnected
+	snmpColFixMode
+	snmpColSatellitesUsed
+	snmpColLatitude
+	snmpColLongitude
+	snmpColPPSStatus
+	snmpColPPSAge
+)
+
+// PPS status values in the MIB
+const (
+	snmpPPSUnknown = 0
+	snmpPPSOK      = 1
+	snmpPPSMissing = 2
+)
+
+// snmpIndex returns the gpsdTable index of a target, a hash of its name so rows keep their index as targets come and go
+func snmpIndex(target string) int {
+	h := fnv.New32a()
+	h.Write([]byte(target))
+	if index := int(h.Sum32() & 0x7fffffff); index > 0 {
+		return index
+	}
+	return 1
+}
+
+// snmpVars returns the objects of every source in OID order: a gpsdTable row per source under prefix.1.1
+func snmpVars(prefix oid, exporters []*exporter) []snmpVar {
+	entry := prefix.child(1, 1)
+	var vars []snmpVar
+	add := func(col, index int, value []byte) {
+		vars = append(vars, snmpVar{entry.child(col, index), value})
+	}
+	truth := func(b bool) []byte {
+		if b {
+			return encodeInt(berInteger, 1)
+		}
+		return encodeInt(berInteger, 2)
+	}
+	used := map[int]bool{}
+	for _, e := range exporters {
+		index := snmpIndex(e.target)
+		for used[index] { // Colliding targets take the next free index, in the order of the targets
+			index = index%math.MaxInt32 + 1
+		}
+		used[index] = true
+		s := e.snmpState()
+		add(1, index, encodeInt(berInteger, int64(index)))
+		add(snmpColTarget, index, encodeTLV(berOctetString, []byte(e.target)))
+		add(snmpColConnected, index, truth(s.connected))
+		if s.tpv != nil {
+			add(snmpColFixMode, index, encodeInt(berInteger, int64(s.tpv.Mode)))
+		}
+		if s.sky != nil {
+			add(snmpColSatellitesUsed, index, encodeInt(berGauge32, int64(s.usedSatellites())))
+		}
+		if s.tpv != nil && s.tpv.Mode >= 2 && !privacy.redacts("tpv", "lat") {
+			add(snmpColLatitude, index, encodeInt(berInteger, int64(math.Round(s.tpv.Lat*1e6))))
+			add(snmpColLongitude, index, encodeInt(berInteger, int64(math.Round(s.tpv.Lon*1e6))))
+		}
+		status := snmpPPSUnknown
+		if !s.lastPPS.IsZero() {
+			status = snmpPPSMissing
+			age := time.Since(s.lastPPS)
+			if age <= *snmpPPSTimeout {
+				status = snmpPPSOK
+			}
+			add(snmpColPPSAge, index, encodeInt(berGauge32, int64(age.Seconds())))
+		}
+		add(snmpColPPSStatus, index, encodeInt(berInteger, int64(status)))
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].oid.compare(vars[j].oid) < 0 })
+	return vars
+}
+
+// snmpState is what the agent exports about a source
+type snmpState struct {
+	connected bool
+	tpv       *TPV
+	sky       *SKY
+	lastPPS   time.Time
+}
+
+// usedSatellites returns the number of satellites used in the solution, counting them when the SKY report doesn't
+func (s snmpState) usedSatellites() int {
+	if s.sky.USat > 0 {
+		return int(s.sky.USat)
+	}
+	n := 0
+	for _, sat := range s.sky.Satellites {
+		if sat.Used {
+			n++
+		}
+	}
+	return n
+}
+
+// snmpState returns the latest reports of the source as exported
+func (e *exporter) snmpState() snmpState {
+	e.mu.Lock()
+	s := snmpState{connected: e.conn.Connected}
+	e.mu.Unlock()
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	s.tpv, _ = e.latest["tpv"].(*TPV)
+	s.sky, _ = e.latest["sky"].(*SKY)
+	s.lastPPS = e.lastSeen["pps"]
+	return s
+}
+
+// snmpAgent answers SNMPv1 and v2c GET, GETNEXT, and GETBULK requests for the gpsd MIB, and other requests with an error
+type snmpAgent struct {
+	community string
+	prefix    oid
+	sources   *sourceSet
+}
+
+// serve answers requests on conn forever
+func (a *snmpAgent) serve(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Warnf("Error reading SNMP request: %v", err)
+			continue
+		}
+		resp, err := a.handle(buf[:n])
+		if err != nil {
+			log.Debugf("Ignoring SNMP request from %s: %v", addr, err)
+			continue
+		}
+		if _, err := conn.WriteTo(resp, addr); err != nil {
+			log.Debugf("Error sending SNMP response to %s: %v", addr, err)
+		}
+	}
+}
+
+// handle decodes a request message and returns the encoded response
+func (a *snmpAgent) handle(msg []byte) ([]byte, error) {
+	tag, body, _, err := readTLV(msg)
+	if err != nil || tag != berSequence {
+		return nil, errBER
+	}
+	tag, versionBytes, body, err := readTLV(body)
+	if err != nil || tag != berInteger {
+		return nil, errBER
+	}
+	version, err := decodeInt(versionBytes)
+	if err != nil || version > 1 {
+		return nil, fmt.Errorf("unsupported SNMP version %d", version+1)
+	}
+	tag, community, body, err := readTLV(body)
+	if err != nil || tag != berOctetString {
+		return nil, errBER
+	}
+	if string(community) != a.community {
+		return nil, errors.New("wrong community")
+	}
+	pduType, pdu, _, err := readTLV(body)
+	if err != nil {
+		return nil, err
+	}
+	switch pduType {
+	case pduGetResponse, pduTrap, pduSNMPv2Trap, pduReport:
+		return nil, fmt.Errorf("unconfirmed PDU type %#x", pduType) // Answering these could start a loop between agents
+	}
+
+	// The request ID and the two integers after it, which GETBULK uses as non-repeaters and max-repetitions
+	var fields [3][]byte
+	for i := range fields {
+		if tag, fields[i], pdu, err = readTLV(pdu); err != nil || tag != berInteger {
+			return nil, errBER
+		}
+	}
+	tag, list, _, err := readTLV(pdu)
+	if err != nil || tag != berSequence {
+		return nil, errBER
+	}
+	var requested []oid
+	var requestBindings [][]byte
+	for len(list) > 0 {
+		var binding []byte
+		rest := list
+		if tag, binding, list, err = readTLV(list); err != nil || tag != berSequence {
+			return nil, errBER
+		}
+		requestBindings = append(requestBindings, rest[:len(rest)-len(list)])
+		tag, name, _, err := readTLV(binding)
+		if err != nil || tag != berOID {
+			return nil, errBER
+		}
+		o, err := decodeOID(name)
+		if err != nil {
+			return nil, err
+		}
+		requested = append(requested, o)
+	}
+
+	var vars []snmpVar
+	var bindings [][]byte
+	errorStatus, errorIndex := 0, 0
+	// SNMPv1 has no exceptions, so a missing object fails the whole request with noSuchName
+	fail := func(i int) {
+		if version == 0 && errorStatus == 0 {
+			errorStatus, errorIndex = snmpNoSuchName, i+1
+		}
+	}
+	switch pduType {
+	case pduGetRequest, pduGetNextRequest, pduGetBulkRequest:
+		vars = snmpVars(a.prefix, a.sources.list())
+	}
+	switch pduType {
+	case pduGetRequest:
+		for i, o := range requested {
+			value, ok := lookupVar(vars, o)
+			if !ok {
+				fail(i)
+			}
+			bindings = append(bindings, encodeSequence(berSequence, encodeOID(o), value))
+		}
+	case pduGetNextRequest:
+		for i, o := range requested {
+			binding, _, ok := nextVar(vars, o)
+			if !ok {
+				fail(i)
+			}
+			bindings = append(bindings, binding)
+		}
+	case pduGetBulkRequest:
+		if version == 0 {
+			return nil, errors.New("GETBULK in an SNMPv1 request")
+		}
+		nonRepeaters, _ := decodeInt(fields[1])
+		maxRepetitions, _ := decodeInt(fields[2])
+		if maxRepetitions > snmpMaxRepetitions {
+			maxRepetitions = snmpMaxRepetitions
+		}
+		size := 0
+	bulk:
+		for i, o := range requested {
+			repetitions := maxRepetitions
+			if int64(i) < nonRepeaters {
+				repetitions = 1
+			}
+			for r := int64(0); r < repetitions; r++ {
+				binding, next, ok := nextVar(vars, o)
+				bindings = append(bindings, binding)
+				if size += len(binding); size > snmpMaxMessageSize {
+					break bulk // Already more than fits in the response
+				}
+				if !ok {
+					break
+				}
+				o = next
+			}
+		}
+	case pduSetRequest:
+		// Everything is read-only. SNMPv1 has no notWritable, so it's reported as noSuchName, as RFC 3584 maps it.
+		errorStatus, errorIndex = snmpNotWritable, 1
+		if version == 0 {
+			errorStatus = snmpNoSuchName
+		}
+	default:
+		errorStatus = snmpGenErr
+	}
+	if errorStatus != 0 {
+		bindings = requestBindings // The response echoes the request's bindings
+	}
+
+	encode := func(errorStatus, errorIndex int, bindings [][]byte) []byte {
+		response := encodeSequence(pduGetResponse,
+			encodeTLV(berInteger, fields[0]),
+			encodeInt(berInteger, int64(errorStatus)),
+			encodeInt(berInteger, int64(errorIndex)),
+			encodeSequence(berSequence, bindings...),
+		)
+		return encodeSequence(berSequence, encodeInt(berInteger, version), encodeTLV(berOctetString, community), response)
+	}
+	msg = encode(errorStatus, errorIndex, bindings)
+	if len(msg) > snmpMaxMessageSize && pduType == pduGetBulkRequest {
+		// GETBULK responses drop trailing bindings until they fit
+		for len(bindings) > 1 && len(msg) > snmpMaxMessageSize {
+			bindings = bindings[:len(bindings)-1]
+			msg = encode(errorStatus, errorIndex, bindings)
+		}
+	}
+	if len(msg) > snmpMaxMessageSize {
+		msg = encode(snmpTooBig, 0, nil)
+	}
+	return msg, nil
+}
+
+// lookupVar returns the value of an object, or the noSuchObject exception
+func lookupVar(vars []snmpVar, o oid) ([]byte, bool) {
+	for _, v := range vars {
+		if v.oid.compare(o) == 0 {
+			return v.value, true
+		}
+	}
+	return encodeTLV(berNoSuchObject, nil), false
+}
+
+// nextVar returns the variable binding of the first object after o and its OID, or the end of the MIB view
+func nextVar(vars []snmpVar, o oid) ([]byte, oid, bool) {
+	for _, v := range vars {
+		if v.oid.compare(o) > 0 {
+			return encodeSequence(berSequence, encodeOID(v.oid), v.value), v.oid, true
+		}
+	}
+	return encodeSequence(berSequence, encodeOID(o), encodeTLV(berEndOfMibView, nil)), o, false
+}
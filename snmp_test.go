@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestTLV(t *testing.T) {
+	for _, tt := range []struct {
+		size   int
+		header []byte
+	}{
+		{0, []byte{berOctetString, 0x00}},
+		{127, []byte{berOctetString, 0x7f}},
+		{128, []byte{berOctetString, 0x81, 0x80}},
+		{255, []byte{berOctetString, 0x81, 0xff}},
+		{256, []byte{berOctetString, 0x82, 0x01, 0x00}},
+		{65535, []byte{berOctetString, 0x82, 0xff, 0xff}},
+		{65536, []byte{berOctetString, 0x83, 0x01, 0x00, 0x00}},
+		{1 << 24, []byte{berOctetString, 0x84, 0x01, 0x00, 0x00, 0x00}},
+	} {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			value := bytes.Repeat([]byte{0xaa}, tt.size)
+			encoded := encodeTLV(berOctetString, value)
+			if !bytes.HasPrefix(encoded, tt.header) || len(encoded) != len(tt.header)+tt.size {
+				t.Fatalf("encoded header % x, want % x", encoded[:len(tt.header)], tt.header)
+			}
+			tag, decoded, rest, err := readTLV(append(encoded, 0x05, 0x00))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tag != berOctetString || !bytes.Equal(decoded, value) || !bytes.Equal(rest, []byte{0x05, 0x00}) {
+				t.Errorf("decoded tag %#x, %d value bytes, rest % x", tag, len(decoded), rest)
+			}
+		})
+	}
+}
+
+func TestReadTLVMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"no length", []byte{berInteger}},
+		{"short value", []byte{berInteger, 0x02, 0x01}},
+		{"indefinite length", []byte{berSequence, 0x80, 0x00, 0x00}},
+		{"long length too long", []byte{berOctetString, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		{"long length truncated", []byte{berOctetString, 0x82, 0x01}},
+		{"long length past end", []byte{berOctetString, 0x81, 0x80, 0x00}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := readTLV(tt.b); err != errBER {
+				t.Errorf("got %v, want %v", err, errBER)
+			}
+		})
+	}
+}
+
+func TestInt(t *testing.T) {
+	for _, tt := range []struct {
+		v       int64
+		encoded []byte
+	}{
+		{0, []byte{berInteger, 0x01, 0x00}},
+		{127, []byte{berInteger, 0x01, 0x7f}},
+		{128, []byte{berInteger, 0x02, 0x00, 0x80}},
+		{-1, []byte{berInteger, 0x01, 0xff}},
+		{-128, []byte{berInteger, 0x01, 0x80}},
+		{-129, []byte{berInteger, 0x02, 0xff, 0x7f}},
+		{37774900, []byte{berInteger, 0x04, 0x02, 0x40, 0x66, 0x34}},
+		{-122419400, []byte{berInteger, 0x04, 0xf8, 0xb4, 0x07, 0x38}},
+		{4294967295, []byte{berInteger, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		t.Run(fmt.Sprint(tt.v), func(t *testing.T) {
+			encoded := encodeInt(berInteger, tt.v)
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("encoded % x, want % x", encoded, tt.encoded)
+			}
+			v, err := decodeInt(encoded[2:])
+			if err != nil || v != tt.v {
+				t.Errorf("decoded %d (%v), want %d", v, err, tt.v)
+			}
+		})
+	}
+}
+
+func TestOID(t *testing.T) {
+	for _, tt := range []struct {
+		oid     string
+		encoded []byte
+	}{
+		{"1.3.6.1", []byte{berOID, 0x03, 0x2b, 0x06, 0x01}},
+		{"1.3.6.1.4.1.32473.2947", []byte{berOID, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x81, 0xfd, 0x59, 0x97, 0x03}},
+		{"1.3.6.1.4.1.32473.2947.1.1.2.268435455", []byte{berOID, 0x11, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x81, 0xfd, 0x59, 0x97, 0x03, 0x01, 0x01, 0x02, 0xff, 0xff, 0xff, 0x7f}},
+	} {
+		t.Run(tt.oid, func(t *testing.T) {
+			o, err := parseOID(tt.oid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded := encodeOID(o)
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("encoded % x, want % x", encoded, tt.encoded)
+			}
+			decoded, err := decodeOID(encoded[2:])
+			if err != nil || decoded.compare(o) != 0 {
+				t.Errorf("decoded %v (%v), want %v", decoded, err, o)
+			}
+		})
+	}
+}
+
+func TestSNMPIndex(t *testing.T) {
+	seen := map[int]string{}
+	for _, target := range []string{"localhost:2947", "gps1.example.com:2947", "gps2.example.com:2947", "nmea:/dev/ttyUSB0"} {
+		index := snmpIndex(target)
+		if index < 1 || index != snmpIndex(target) {
+			t.Errorf("%s: index %d isn't positive and stable", target, index)
+		}
+		if other, ok := seen[index]; ok {
+			t.Errorf("%s and %s share index %d", target, other, index)
+		}
+		seen[index] = target
+	}
+}
+
+// snmpRequest encodes an SNMP request for the OIDs with NULL values
+func snmpRequest(version int64, community string, pduType byte, oids ...string) []byte {
+	var bindings [][]byte
+	for _, s := range oids {
+		o, _ := parseOID(s)
+		bindings = append(bindings, encodeSequence(berSequence, encodeOID(o), encodeTLV(berNull, nil)))
+	}
+	pdu := encodeSequence(pduType, encodeInt(berInteger, 42), encodeInt(berInteger, 0), encodeInt(berInteger, 10), encodeSequence(berSequence, bindings...))
+	return encodeSequence(berSequence, encodeInt(berInteger, version), encodeTLV(berOctetString, []byte(community)), pdu)
+}
+
+// snmpResponse decodes the error status and index of an SNMP response and counts its bindings
+func snmpResponse(t *testing.T, msg []byte) (status, index int64, bindings int) {
+	t.Helper()
+	_, body, _, err := readTLV(msg)
+	for i := 0; i < 2 && err == nil; i++ { // Version and community
+		_, _, body, err = readTLV(body)
+	}
+	var pduType byte
+	var pdu, field []byte
+	if err == nil {
+		pduType, pdu, _, err = readTLV(body)
+	}
+	var fields [3]int64
+	for i := range fields {
+		if err == nil {
+			if _, field, pdu, err = readTLV(pdu); err == nil {
+				fields[i], err = decodeInt(field)
+			}
+		}
+	}
+	var list []byte
+	if err == nil {
+		_, list, _, err = readTLV(pdu)
+	}
+	for err == nil && len(list) > 0 {
+		_, _, list, err = readTLV(list)
+		bindings++
+	}
+	if err != nil || pduType != pduGetResponse || fields[0] != 42 {
+		t.Fatalf("malformed response % x", msg)
+	}
+	return fields[1], fields[2], bindings
+}
+
+func TestSNMPHandle(t *testing.T) {
+	prefix := "1.3.6.1.4.1.32473.2947"
+	many := make([]string, 200)
+	for i := range many {
+		many[i] = fmt.Sprintf("%s.1.1.2.%d", prefix, i+1)
+	}
+	for _, tt := range []struct {
+		name     string
+		request  []byte
+		status   int64
+		index    int64
+		bindings int
+	}{
+		{"get v2c", snmpRequest(1, "secret", pduGetRequest, prefix+".1.1.2.1"), 0, 0, 1},
+		{"get v1 missing", snmpRequest(0, "secret", pduGetRequest, prefix+".1.1.2.1"), snmpNoSuchName, 1, 1},
+		{"getnext", snmpRequest(1, "secret", pduGetNextRequest, prefix), 0, 0, 1},
+		{"set v2c", snmpRequest(1, "secret", pduSetRequest, prefix+".1.1.2.1"), snmpNotWritable, 1, 1},
+		{"set v1", snmpRequest(0, "secret", pduSetRequest, prefix+".1.1.2.1"), snmpNoSuchName, 1, 1},
+		{"inform", snmpRequest(1, "secret", 0xa6, prefix), snmpGenErr, 0, 1},
+		{"get too big", snmpRequest(1, "secret", pduGetRequest, many...), snmpTooBig, 0, 0},
+		{"getbulk trimmed", snmpRequest(1, "secret", pduGetBulkRequest, many...), 0, 0, 72},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &snmpAgent{community: "secret", prefix: oid{1, 3, 6, 1, 4, 1, 32473, 2947}, sources: &sourceSet{}}
+			msg, err := a.handle(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg) > snmpMaxMessageSize {
+				t.Errorf("response of %d bytes", len(msg))
+			}
+			status, index, bindings := snmpResponse(t, msg)
+			if status != tt.status || index != tt.index || bindings != tt.bindings {
+				t.Errorf("got status %d, index %d, %d bindings; want %d, %d, %d", status, index, bindings, tt.status, tt.index, tt.bindings)
+			}
+		})
+	}
+}
+
+func TestSNMPHandleIgnored(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		request []byte
+	}{
+		{"wrong community", snmpRequest(1, "public", pduGetRequest, "1.3.6.1")},
+		{"SNMPv3", snmpRequest(3, "secret", pduGetRequest, "1.3.6.1")},
+		{"response", snmpRequest(1, "secret", pduGetResponse, "1.3.6.1")},
+		{"trap", snmpRequest(1, "secret", pduSNMPv2Trap, "1.3.6.1")},
+		{"getbulk v1", snmpRequest(0, "secret", pduGetBulkRequest, "1.3.6.1")},
+		{"truncated", snmpRequest(1, "secret", pduGetRequest, "1.3.6.1")[:20]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &snmpAgent{community: "secret", prefix: oid{1, 3, 6, 1, 4, 1, 32473, 2947}, sources: &sourceSet{}}
+			if msg, err := a.handle(tt.request); err == nil {
+				t.Errorf("answered with % x", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+// updateSNR exports the minimum, maximum and mean signal strength of the satellites a device used in a SKY report.
+// The gauges are dropped while no used satellite has a signal strength, and SKY reports without satellites leave them as they are.
+func (e *exporter) updateSNR(sky *SKY) {
+	if len(sky.Satellites) == 0 {
+		return
+	}
+	var min, max, sum float64
+	n := 0
+	for i := range sky.Satellites {
+		sat := &sky.Satellites[i]
+		if !sat.Used || sat.SNR <= 0 {
+			continue
+		}
+		if n == 0 || sat.SNR < min {
+			min = sat.SNR
+		}
+		if sat.SNR > max {
+			max = sat.SNR
+		}
+		sum += sat.SNR
+		n++
+	}
+	if n == 0 {
+		e.dropSeries(e.snrMin, sky.Device)
+		e.dropSeries(e.snrMax, sky.Device)
+		e.dropSeries(e.snrMean, sky.Device)
+		return
+	}
+	e.series(e.snrMin, sky.Device).Set(min)
+	e.series(e.snrMax, sky.Device).Set(max)
+	e.series(e.snrMean, sky.Device).Set(sum / float64(n))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// sourceSet holds the exporter of every source and the clients of gpsd targets, which target discovery changes at runtime
+type sourceSet struct {
+	mu         sync.Mutex
+	exporters  []*exporter
+	clients    []*gpsdClient
+	registries map[*gpsdClient]*prometheus.Registry // Registries of discovered targets, gathered along with the main registry
+	discovered map[string]map[string]*gpsdClient    // Running discovered targets by provider and target key
+}
+
+// add adds a source, with its gpsd client if it's a gpsd target
+func (s *sourceSet) add(e *exporter, c *gpsdClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exporters = append(s.exporters, e)
+	if c != nil {
+		s.clients = append(s.clients, c)
+	}
+}
+
+// addDiscovered adds a discovered gpsd target whose metrics are registered with reg
+func (s *sourceSet) addDiscovered(c *gpsdClient, reg *prometheus.Registry) {
+	s.add(c.exporter, c)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.registries == nil {
+		s.registries = map[*gpsdClient]*prometheus.Registry{}
+	}
+	s.registries[c] = reg
+}
+
+// remove removes a discovered gpsd target, whose metrics are no longer gathered
+func (s *sourceSet) remove(c *gpsdClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.clients {
+		if other == c {
+			s.clients = append(s.clients[:i:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	for i, e := range s.exporters {
+		if e == c.exporter {
+			s.exporters = append(s.exporters[:i:i], s.exporters[i+1:]...)
+			break
+		}
+	}
+	delete(s.registries, c)
+}
+
+// list returns the exporters of every source
+func (s *sourceSet) list() []*exporter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*exporter{}, s.exporters...)
+}
+
+// gpsdClients returns the clients of every gpsd target
+func (s *sourceSet) gpsdClients() []*gpsdClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*gpsdClient{}, s.clients...)
+}
+
+// Gather gathers the metrics of discovered targets
+func (s *sourceSet) Gather() ([]*dto.MetricFamily, error) {
+	s.mu.Lock()
+	gatherers := make(prometheus.Gatherers, 0, len(s.registries))
+	for _, reg := range s.registries {
+		gatherers = append(gatherers, reg)
+	}
+	s.mu.Unlock()
+	return gatherers.Gather()
+}
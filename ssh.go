@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// defaultSSHKeys are tried in order when no key is given
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshDialer opens connections as direct-tcpip channels over a shared SSH connection
+type sshDialer struct {
+	addr    string
+	config  *ssh.ClientConfig
+	forward proxy.ContextDialer
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// newSSHDialer returns a dialer that tunnels through target ([user@]host[:port]) using key authentication
+func newSSHDialer(target, keyFile, knownHostsFile string, forward proxy.ContextDialer) (*sshDialer, error) {
+	username, host := "", target
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		username, host = target[:i], target[i+1:]
+	}
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("finding SSH username: %w", err)
+		}
+		username = u.Username
+	}
+
+	home, _ := os.UserHomeDir()
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading SSH known hosts: %w", err)
+	}
+
+	keyFiles := []string{keyFile}
+	if keyFile == "" {
+		keyFiles = nil
+		for _, name := range defaultSSHKeys {
+			keyFiles = append(keyFiles, filepath.Join(home, ".ssh", name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, file := range keyFiles {
+		key, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) && keyFile == "" {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("reading SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("parsing SSH key %s: %w", file, err)
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("no SSH key found, set one with -gpsd.ssh-key")
+	}
+
+	return &sshDialer{
+		addr: normalizeAddr(host, "22"),
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+			HostKeyCallback: hostKeyCallback,
+		},
+		forward: forward,
+	}, nil
+}
+
+// DialContext opens a tunnelled connection to addr, reconnecting to the SSH server if needed.
+// d.mu only guards the client, so a stalled server doesn't block other dials or the keepalive.
+func (d *sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if *dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *dialTimeout)
+		defer cancel()
+	}
+
+	d.mu.Lock()
+	client := d.client
+	d.mu.Unlock()
+	if client != nil {
+		conn, err := dialChannel(ctx, client, network, addr)
+		if err == nil {
+			return &sshConn{Conn: conn, remote: sshAddr(addr + " via " + d.addr)}, nil
+		}
+		log.Warnf("Error opening tunnel over SSH connection to %s, reconnecting: %v", d.addr, err)
+		d.drop(client)
+	}
+
+	client, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	if d.client != nil { // Another dial reconnected first
+		_ = client.Close()
+		client = d.client
+	} else {
+		d.client = client
+		go d.keepalive(client)
+	}
+	d.mu.Unlock()
+	conn, err := dialChannel(ctx, client, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &sshConn{Conn: conn, remote: sshAddr(addr + " via " + d.addr)}, nil
+}
+
+// drop closes client and forgets it if it's still the current one
+func (d *sshDialer) drop(client *ssh.Client) {
+	d.mu.Lock()
+	if d.client == client {
+		d.client = nil
+	}
+	d.mu.Unlock()
+	_ = client.Close()
+}
+
+// dialChannel opens a direct-tcpip channel to addr, giving up when ctx is done as the SSH library can't be interrupted
+func dialChannel(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// keepalive sends keepalive@openssh.com requests every -gpsd.keepalive, and closes the client when the server
+// stops answering, so the tunnelled connections fail and the next dial reconnects
+func (d *sshDialer) keepalive(client *ssh.Client) {
+	if *keepAlive == 0 {
+		return
+	}
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+	ticker := time.NewTicker(*keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil) // A refusal still shows the server is alive
+			replied <- err
+		}()
+		var err error
+		select {
+		case err = <-replied:
+		case <-time.After(*keepAlive):
+			err = errors.New("no reply")
+		case <-closed:
+			return
+		}
+		if err != nil {
+			log.Warnf("SSH keepalive to %s failed, disconnecting: %v", d.addr, err)
+			d.drop(client)
+			return
+		}
+	}
+}
+
+// connect establishes the SSH connection, giving up when ctx is done
+func (d *sshDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	log.Infof("Connecting to SSH server %s as %s", d.addr, d.config.User)
+	conn, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	handshaken := make(chan struct{})
+	defer close(handshaken)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-handshaken:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, d.addr, d.config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshConn emulates deadlines on an SSH channel, which doesn't support them, by closing it once a deadline passes
+type sshConn struct {
+	net.Conn
+	remote sshAddr
+
+	mu         sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+	timedOut   bool
+}
+
+// RemoteAddr returns the tunnel destination, as SSH channels have no meaningful remote address of their own
+func (c *sshConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	return n, c.deadlineErr(err)
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	return n, c.deadlineErr(err)
+}
+
+// deadlineErr reports an error caused by a deadline closing the channel as the deadline passing
+func (c *sshConn) deadlineErr(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil && c.timedOut {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setDeadline(&c.readTimer, t)
+	c.setDeadline(&c.writeTimer, t)
+	return nil
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setDeadline(&c.readTimer, t)
+	return nil
+}
+
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setDeadline(&c.writeTimer, t)
+	return nil
+}
+
+// setDeadline replaces the timer closing the channel at a read or write deadline, with c.mu held
+func (c *sshConn) setDeadline(timer **time.Timer, t time.Time) {
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !t.IsZero() {
+		*timer = time.AfterFunc(time.Until(t), func() {
+			c.mu.Lock()
+			c.timedOut = true
+			c.mu.Unlock()
+			_ = c.Conn.Close()
+		})
+	}
+}
+
+// sshAddr describes a tunnelled connection's destination
+type sshAddr string
+
+func (a sshAddr) Network() string {
+	return "ssh"
+}
+
+func (a sshAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stalenessFlag maps report classes to how long their metrics stay valid without a new report. The empty class applies to all others.
+type stalenessFlag map[string]time.Duration
+
+func (f stalenessFlag) String() string {
+	var specs []string
+	for class, ttl := range f {
+		if class == "" {
+			specs = append(specs, ttl.String())
+		} else {
+			specs = append(specs, fmt.Sprintf("%s=%s", class, ttl))
+		}
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (f stalenessFlag) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		class, ttl := "", spec
+		if i := strings.IndexByte(spec, '='); i >= 0 {
+			class, ttl = strings.ToLower(spec[:i]), spec[i+1:]
+			if _, ok := streamedReports[strings.ToUpper(class)]; !ok {
+				return fmt.Errorf("unknown report class %q", class)
+			}
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return err
+		}
+		f[class] = d
+	}
+	return nil
+}
+
+// ttl returns how long metrics of class stay valid, zero if they never go stale
+func (f stalenessFlag) ttl(class string) time.Duration {
+	if d, ok := f[class]; ok {
+		return d
+	}
+	return f[""]
+}
+
+// classPrefixes returns the metric name prefixes of the metrics updated from a class
+func classPrefixes(class string) []string {
+	switch class {
+	case "sky":
+		return []string{"gpsd_sky_", "gpsd_sat_", "gpsd_constellation_"}
+	case "tpv":
+		return []string{"gpsd_tpv_", "gpsd_marine_"}
+	case "att":
+		return []string{"gpsd_att_", "gpsd_n2k_"}
+	}
+	return []string{fmt.Sprintf("gpsd_%s_", class)}
+}
+
+// expireStale periodically expires the metrics of classes without a new report within their TTL, until done is closed
+func (e *exporter) expireStale(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		e.reportMu.Lock()
+		for class, seen := range e.lastSeen {
+			ttl := staleness.ttl(class)
+			if ttl <= 0 || time.Since(seen) <= ttl {
+				continue
+			}
+			log.Debugf("No %s report in %s, expiring its metrics", strings.ToUpper(class), ttl)
+			e.expireClass(class, *staleAction == "nan")
+			delete(e.lastSeen, class)
+		}
+		e.reportMu.Unlock()
+	}
+}
+
+// expireClass deletes or sets to NaN the metrics of a class, which must be called with reportMu held.
+// Vectors such as per-satellite metrics and the per-device gauges derived from the class are always deleted since their label values aren't tracked.
+func (e *exporter) expireClass(class string, nan bool) {
+	if class == "sky" {
+		e.satellites = map[string]*satVisibility{} // Visibility is no longer known to be continuous
+		e.forgetLabel("prn")
+	}
+	delete(e.latest, class)
+	for _, prefix := range classPrefixes(class) {
+		for name, g := range e.gauges {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if nan {
+				g.Set(math.NaN())
+			} else {
+				e.reg.Unregister(g)
+				delete(e.gauges, name)
+			}
+		}
+		for name, v := range e.gaugeVecs {
+			if strings.HasPrefix(name, prefix) {
+				e.dropVec(v)
+			}
+		}
+		e.satSnapshot.deletePrefix(prefix)
+	}
+	for _, vec := range e.derived[class] {
+		e.dropVec(vec)
+	}
+	e.satSnapshot.publish()
+}
+
+// resetReports deletes every metric derived from gpsd reports, so they're only exported again once new reports arrive.
+// The per-device gauges in e.derived go with their class, and the samples and filters behind them are dropped so they
+// restart from the new reports. Movement and fix state persisted with -state.file are kept.
+func (e *exporter) resetReports() {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	for class := range streamedReports {
+		e.expireClass(strings.ToLower(class), false)
+	}
+	e.latest = map[string]any{}
+	e.smoothers = map[string]*smoother{}
+	e.dopBreached = map[string]bool{}
+	e.dgps = map[string]*dgpsState{}
+	e.oscillators = map[string]*oscState{}
+	e.qErrSamples = map[string][]qErrSample{}
+	e.sectors = map[string]*sectorState{}
+	e.pulses = map[string]float64{}
+	e.offsets = map[string]*clockOffsets{}
+	e.movingBases = map[string]bool{}
+	e.drift = map[string][]driftSample{}
+	e.anomalies = map[string]*anomalyState{}
+	e.lastSeen = map[string]time.Time{}
+	e.lastReports = map[reportKey]string{}
+	e.lastPulse = 0
+	e.forgetLabel("device")
+}
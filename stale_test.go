@@ -0,0 +1,161 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// streamedLines are a report of each streamed class from one receiver
+var streamedLines = map[string]string{
+	"TPV": `{"class":"TPV","device":"/dev/ttyACM0","mode":3,"status":2,"time":"2024-06-01T12:00:00.000Z","lat":37.7749,"lon":-122.4194,` +
+		`"altMSL":62.3,"eph":3.1,"epv":5.1,"speed":1.5,"track":45.0,"magtrack":58.0,"magvar":13.0,"dgpsAge":2.0,"dgpsSta":402}`,
+	"SKY": `{"class":"SKY","device":"/dev/ttyACM0","time":"2024-06-01T12:00:00.000Z","hdop":0.9,"pdop":1.4,"vdop":1.1,"tdop":0.9,"uSat":2,"nSat":3,` +
+		`"satellites":[{"PRN":5,"el":45,"az":90,"ss":42,"used":true,"gnssid":0},{"PRN":12,"el":30,"az":200,"ss":38,"used":true,"gnssid":0},` +
+		`{"PRN":70,"el":10,"az":300,"ss":20,"used":false,"gnssid":6}]}`,
+	"GST":  `{"class":"GST","device":"/dev/ttyACM0","time":"2024-06-01T12:00:00.000Z","rms":1.2,"major":2.1,"minor":1.1,"orient":30,"lat":1.5,"lon":1.4,"alt":2.2}`,
+	"PPS":  `{"class":"PPS","device":"/dev/ttyACM0","real_sec":1717243200,"real_nsec":0,"clock_sec":1717243200,"clock_nsec":120,"precision":-20,"qErr":-1500}`,
+	"TOFF": `{"class":"TOFF","device":"/dev/ttyACM0","real_sec":1717243200,"real_nsec":0,"clock_sec":1717243200,"clock_nsec":450000}`,
+	"OSC":  `{"class":"OSC","device":"/dev/ttyACM0","running":true,"reference":true,"disciplined":true,"delta":12}`,
+	"ATT":  `{"class":"ATT","device":"/dev/ttyACM0","time":"2024-06-01T12:00:00.000Z","heading":271.5}`,
+}
+
+// streamedExporter returns an exporter that has received a report of each streamed class
+func streamedExporter(t *testing.T) (*exporter, *prometheus.Registry) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	e := newExporter("localhost:2947", reg)
+	for class, line := range streamedLines {
+		if err := e.processStreamed(class, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e, reg
+}
+
+// classSeries counts the gauge series updated from class, directly or derived from its reports.
+// Counters and histograms accumulate over every report, so they aren't expired.
+func classSeries(t *testing.T, e *exporter, reg *prometheus.Registry, class string) int {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		for _, prefix := range classPrefixes(class) {
+			if strings.HasPrefix(family.GetName(), prefix) {
+				n += len(family.GetMetric())
+			}
+		}
+	}
+	for _, vec := range e.derived[class] {
+		n += testutil.CollectAndCount(vec)
+	}
+	return n
+}
+
+func TestExpireClass(t *testing.T) {
+	defer func(heading bool) { *movingBase = heading }(*movingBase)
+	*movingBase = true
+	for class := range streamedReports {
+		class = strings.ToLower(class)
+		t.Run(class, func(t *testing.T) {
+			e, reg := streamedExporter(t)
+			if classSeries(t, e, reg, class) == 0 {
+				t.Fatal("no series exported")
+			}
+			if _, ok := e.latest[class]; !ok {
+				t.Fatal("no latest report kept")
+			}
+
+			e.reportMu.Lock()
+			e.expireClass(class, false)
+			e.reportMu.Unlock()
+			if n := classSeries(t, e, reg, class); n != 0 {
+				t.Errorf("%d series left", n)
+			}
+			if _, ok := e.latest[class]; ok {
+				t.Error("latest report kept")
+			}
+			if class == "sky" && len(e.satellites) != 0 {
+				t.Errorf("kept the visibility of %d satellites", len(e.satellites))
+			}
+			for other := range streamedReports {
+				other = strings.ToLower(other)
+				if _, ok := e.latest[other]; other != class && !ok {
+					t.Errorf("expired %s along with it", other)
+				}
+			}
+		})
+	}
+}
+
+func TestResetOnDisconnect(t *testing.T) {
+	defer func(reset, heading bool) { *resetOnDisconnect, *movingBase = reset, heading }(*resetOnDisconnect, *movingBase)
+	*resetOnDisconnect, *movingBase = true, true
+	e, reg := streamedExporter(t)
+	state := func() map[string]int {
+		return map[string]int{
+			"latest":      len(e.latest),
+			"satellites":  len(e.satellites),
+			"smoothers":   len(e.smoothers),
+			"dopBreached": len(e.dopBreached),
+			"dgps":        len(e.dgps),
+			"oscillators": len(e.oscillators),
+			"qErrSamples": len(e.qErrSamples),
+			"sectors":     len(e.sectors),
+			"pulses":      len(e.pulses),
+			"offsets":     len(e.offsets),
+			"movingBases": len(e.movingBases),
+			"drift":       len(e.drift),
+			"anomalies":   len(e.anomalies),
+			"lastSeen":    len(e.lastSeen),
+			"lastReports": len(e.lastReports),
+			"devices":     len(e.labelValues["device"]),
+		}
+	}
+	// The times of the last reports stay for staleness alerts, and the session maxima and trips are movement state
+	kept := regexp.MustCompile(`^gpsd_(last_[a-z]+_timestamp_seconds|session_max_.*|trip_.*)$`)
+	deviceSeries := func() []string {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, family := range families {
+			if family.GetType() != dto.MetricType_GAUGE || kept.MatchString(family.GetName()) {
+				continue
+			}
+			for _, m := range family.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "device" {
+						names = append(names, family.GetName())
+					}
+				}
+			}
+		}
+		return names
+	}
+	if len(deviceSeries()) == 0 || state()["latest"] != len(streamedLines) {
+		t.Fatalf("reports not exported, state %v", state())
+	}
+
+	c := &gpsdClient{addr: "localhost:2947", exporter: e}
+	c.disconnect()
+	for name, n := range state() {
+		if n != 0 {
+			t.Errorf("kept %d entries in %s", n, name)
+		}
+	}
+	if names := deviceSeries(); len(names) != 0 {
+		t.Errorf("kept the device series of %v", names)
+	}
+}
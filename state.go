@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// persistedDevice is the long-lived state of a device kept in -state.file, so restarts don't reset aggregates graphed over months
+type persistedDevice struct {
+	Distance    float64  `json:"distance_meters,omitempty"`
+	Trips       float64  `json:"trips,omitempty"`
+	FixLosses   float64  `json:"fix_losses,omitempty"`
+	MaxSpeed    float64  `json:"max_speed_meters_per_second,omitempty"`
+	MaxAltitude *float64 `json:"max_altitude_meters,omitempty"`
+}
+
+// stateFileMu serializes updates of the state file, which holds the state of every target
+var stateFileMu sync.Mutex
+
+// readState reads the persisted state by target and device
+func readState() (map[string]map[string]*persistedDevice, error) {
+	state := map[string]map[string]*persistedDevice{}
+	b, err := os.ReadFile(*stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, json.Unmarshal(b, &state)
+}
+
+// counterValue returns the value of a counter
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+// loadState restores the odometer, trip and fix loss counters and the maxima of each device from -state.file
+func (e *exporter) loadState() error {
+	if *stateFile == "" {
+		return nil
+	}
+	stateFileMu.Lock()
+	state, err := readState()
+	stateFileMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("reading state from %s: %w", *stateFile, err)
+	}
+
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	for device, d := range state[e.target] {
+		e.distance.WithLabelValues(device).Add(d.Distance)
+		e.tripsTotal.WithLabelValues(device).Add(d.Trips)
+		e.fixLosses.WithLabelValues(device).Add(d.FixLosses)
+		m := &motionState{maxSpeed: d.MaxSpeed}
+		e.series(e.maxSpeed, device).Set(d.MaxSpeed)
+		if d.MaxAltitude != nil {
+			m.maxAltitude, m.hasAltitude = *d.MaxAltitude, true
+			e.series(e.maxAltitude, device).Set(m.maxAltitude)
+		}
+		e.motion[device] = m
+	}
+	if len(state[e.target]) > 0 {
+		log.Infof("Restored the state of %d devices of %s from %s", len(state[e.target]), e.target, *stateFile)
+	}
+	return nil
+}
+
+// persistedDevices returns the state of the devices of the source to persist
+func (e *exporter) persistedDevices() map[string]*persistedDevice {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	devices := map[string]*persistedDevice{}
+	for device, m := range e.motion {
+		d := &persistedDevice{
+			Distance:  counterValue(e.distance.WithLabelValues(device)),
+			Trips:     counterValue(e.tripsTotal.WithLabelValues(device)),
+			FixLosses: counterValue(e.fixLosses.WithLabelValues(device)),
+			MaxSpeed:  m.maxSpeed,
+		}
+		if m.hasAltitude {
+			alt := m.maxAltitude
+			d.MaxAltitude = &alt
+		}
+		devices[device] = d
+	}
+	return devices
+}
+
+// saveState persists the state of the sources, keeping that of targets no longer running
+func saveState(sources *sourceSet) error {
+	stateFileMu.Lock()
+	defer stateFileMu.Unlock()
+	state, err := readState()
+	if err != nil {
+		return err
+	}
+	for _, e := range sources.list() {
+		if devices := e.persistedDevices(); len(devices) > 0 {
+			state[e.target] = devices
+		}
+	}
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := *stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *stateFile)
+}
+
+// persistState saves the state of the sources every interval, and once more before exiting on SIGINT or SIGTERM
+func persistState(sources *sourceSet, interval time.Duration) {
+	log.Infof("Saving state to %s every %s", *stateFile, interval)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			if err := saveState(sources); err != nil {
+				log.Warnf("Error saving state to %s: %v", *stateFile, err)
+			}
+		case sig := <-signals:
+			if err := saveState(sources); err != nil {
+				log.Errorf("Error saving state to %s: %v", *stateFile, err)
+			}
+			log.Infof("Exiting on %s", sig)
+			os.Exit(0)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// eventStream fans out parsed gpsd reports to server-sent event clients
+type eventStream struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	last    map[string][]byte // Most recent event per class, replayed to new clients
+}
+
+// events is nil unless the event stream is enabled
+var events *eventStream
+
+func newEventStream() *eventStream {
+	return &eventStream{
+		clients: map[chan []byte]struct{}{},
+		last:    map[string][]byte{},
+	}
+}
+
+// publish sends a report of the given class to all connected clients
+func (s *eventStream) publish(class string, report any) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Warnf("Error marshalling %s event: %v", class, err)
+		return
+	}
+	msg := []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", class, data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[class] = msg
+	for c := range s.clients {
+		select {
+		case c <- msg:
+		default: // Drop events for slow clients rather than blocking the reader
+		}
+	}
+}
+
+func (s *eventStream) subscribe() chan []byte {
+	c := make(chan []byte, 16)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range s.last {
+		c <- msg
+	}
+	s.clients[c] = struct{}{}
+	return c
+}
+
+func (s *eventStream) unsubscribe(c chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, c)
+}
+
+// ServeHTTP streams events to the client until it disconnects
+func (s *eventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	c := s.subscribe()
+	defer s.unsubscribe(c)
+	log.Debugf("Event stream client %s connected", r.RemoteAddr)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debugf("Event stream client %s disconnected", r.RemoteAddr)
+			return
+		case msg := <-c:
+			if _, err := w.Write(msg); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
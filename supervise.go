@@ -0,0 +1,64 @@
+package main
+
+import (
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tasks restarted after a panic wait between these backoffs, doubling each time
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// supervise runs a task of the source until it returns or done is closed, restarting it with exponential backoff whenever it panics.
+// A bug hit by one source's reports then only affects that source, not the whole exporter.
+func (e *exporter) supervise(task string, done <-chan struct{}, fn func()) {
+	e.superviseErr(task, done, func() error {
+		fn()
+		return nil
+	})
+}
+
+// superviseErr is supervise for a task that can fail, which is also restarted when it returns an error
+func (e *exporter) superviseErr(task string, done <-chan struct{}, fn func() error) {
+	backoff := minRestartBackoff
+	for {
+		start := time.Now()
+		e.taskUp.WithLabelValues(task).Set(1)
+		if !e.runTask(task, fn) {
+			return
+		}
+		e.taskUp.WithLabelValues(task).Set(0)
+		if time.Since(start) > maxRestartBackoff {
+			backoff = minRestartBackoff // It had been running fine for a while
+		}
+		log.Errorf("Restarting %s of %s in %s", task, e.target, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-done:
+			return
+		}
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// runTask runs fn, reporting whether it panicked or failed
+func (e *exporter) runTask(task string, fn func() error) (failed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			failed = true
+			e.taskPanics.WithLabelValues(task).Inc()
+			log.Errorf("Panic in %s of %s: %v\n%s", task, e.target, r, debug.Stack())
+		}
+	}()
+	if err := fn(); err != nil {
+		log.Errorf("Error in %s of %s: %v", task, e.target, err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sky coverage is binned into azimuth sectors and elevation bands
+const (
+	surveySectorDegrees = 30
+	surveyBandDegrees   = 30
+)
+
+// welford accumulates the mean and variance of a value
+type welford struct {
+	n, mean, m2 float64
+}
+
+func (w *welford) add(x float64) {
+	w.n++
+	d := x - w.mean
+	w.mean += d / w.n
+	w.m2 += d * (x - w.mean)
+}
+
+func (w *welford) stddev() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return math.Sqrt(w.m2 / (w.n - 1))
+}
+
+// skyBin accumulates the satellites seen in a region of the sky
+type skyBin struct {
+	AzimuthFrom   float64 `json:"azimuth_from"`
+	ElevationFrom float64 `json:"elevation_from"`
+	Observations  int     `json:"observations"`
+	MeanSNR       float64 `json:"mean_snr_dbhz"`
+}
+
+// surveyReport is the result of a site survey
+type surveyReport struct {
+	Target   string    `json:"target"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Fixes    int       `json:"fixes"`
+	Fixes3D  int       `json:"fixes_3d"`
+	Lat      float64   `json:"lat"`
+	Lon      float64   `json:"lon"`
+	AltMSL   float64   `json:"alt_msl"`
+	StdNorth float64   `json:"stddev_north_meters"`
+	StdEast  float64   `json:"stddev_east_meters"`
+	StdUp    float64   `json:"stddev_up_meters"`
+	Coverage float64   `json:"sky_coverage_ratio"`
+	Sky      []skyBin  `json:"sky"`
+}
+
+// survey accumulates position statistics and sky coverage from the reports of an exporter
+type survey struct {
+	mu              sync.Mutex
+	report          surveyReport
+	lat0, lon0      float64 // First fix, the origin of the north and east offsets
+	north, east, up welford
+	sky             []skyBin
+
+	progress prometheus.Gauge
+	samples  prometheus.Counter
+	coverage prometheus.Gauge
+	stddev   *prometheus.GaugeVec
+}
+
+func newSurvey(target string, reg prometheus.Registerer) *survey {
+	factory := promauto.With(reg)
+	s := &survey{
+		report: surveyReport{Target: target, Start: time.Now().UTC()},
+		progress: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_survey_progress_ratio",
+			Help: "Fraction of the survey duration elapsed",
+		}),
+		samples: factory.NewCounter(prometheus.CounterOpts{
+			Name: "gpsd_survey_fixes_total",
+			Help: "Number of fixes accumulated by the survey",
+		}),
+		coverage: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "gpsd_survey_sky_coverage_ratio",
+			Help: "Fraction of the sky regions in which a satellite has been seen",
+		}),
+		stddev: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gpsd_survey_position_stddev_meters",
+			Help: "Standard deviation of the surveyed position along each axis",
+		}, []string{"axis"}),
+	}
+	for el := 0.0; el < 90; el += surveyBandDegrees {
+		for az := 0.0; az < 360; az += surveySectorDegrees {
+			s.sky = append(s.sky, skyBin{AzimuthFrom: az, ElevationFrom: el})
+		}
+	}
+	return s
+}
+
+// observe accumulates a report, and is called by the exporter with its reportMu held
+func (s *survey) observe(class string, report any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r := report.(type) {
+	case *TPV:
+		if _, ok := fixTime(r); !ok {
+			return
+		}
+		if s.report.Fixes == 0 {
+			s.lat0, s.lon0 = r.Lat, r.Lon
+		}
+		s.report.Fixes++
+		s.north.add((r.Lat - s.lat0) * metersPerDegree)
+		s.east.add((r.Lon - s.lon0) * metersPerDegree * math.Cos(s.lat0*math.Pi/180))
+		if r.Mode >= 3 {
+			s.report.Fixes3D++
+			s.up.add(r.AltMSL)
+		}
+		s.samples.Inc()
+		s.stddev.WithLabelValues("north").Set(s.north.stddev())
+		s.stddev.WithLabelValues("east").Set(s.east.stddev())
+		s.stddev.WithLabelValues("up").Set(s.up.stddev())
+	case *SKY:
+		seen := 0
+		for _, sat := range r.Satellites {
+			if sat.SNR <= 0 || sat.Elevation < 0 {
+				continue
+			}
+			el := math.Min(sat.Elevation, 89.9)
+			az := math.Mod(math.Mod(sat.Azimuth, 360)+360, 360)
+			b := &s.sky[int(el/surveyBandDegrees)*(360/surveySectorDegrees)+int(az/surveySectorDegrees)]
+			b.Observations++
+			b.MeanSNR += (sat.SNR - b.MeanSNR) / float64(b.Observations)
+		}
+		for _, b := range s.sky {
+			if b.Observations > 0 {
+				seen++
+			}
+		}
+		s.coverage.Set(float64(seen) / float64(len(s.sky)))
+	}
+}
+
+// result returns the survey report as of now
+func (s *survey) result() surveyReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.report
+	r.End = time.Now().UTC()
+	r.Lat = s.lat0 + s.north.mean/metersPerDegree
+	r.Lon = s.lon0 + s.east.mean/(metersPerDegree*math.Cos(s.lat0*math.Pi/180))
+	r.AltMSL = s.up.mean
+	r.StdNorth, r.StdEast, r.StdUp = s.north.stddev(), s.east.stddev(), s.up.stddev()
+	r.Sky = append([]skyBin{}, s.sky...)
+	seen := 0
+	for _, b := range r.Sky {
+		if b.Observations > 0 {
+			seen++
+		}
+	}
+	r.Coverage = float64(seen) / float64(len(r.Sky))
+	return r
+}
+
+// writeCSV writes the survey report as field,value rows, with a row per sky region
+func (r surveyReport) writeCSV(f *os.File) error {
+	w := csv.NewWriter(f)
+	g := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	rows := [][]string{
+		{"field", "value"},
+		{"target", r.Target},
+		{"start", r.Start.Format(time.RFC3339)},
+		{"end", r.End.Format(time.RFC3339)},
+		{"fixes", strconv.Itoa(r.Fixes)},
+		{"fixes_3d", strconv.Itoa(r.Fixes3D)},
+		{"lat", g(r.Lat)},
+		{"lon", g(r.Lon)},
+		{"alt_msl", g(r.AltMSL)},
+		{"stddev_north_meters", g(r.StdNorth)},
+		{"stddev_east_meters", g(r.StdEast)},
+		{"stddev_up_meters", g(r.StdUp)},
+		{"sky_coverage_ratio", g(r.Coverage)},
+	}
+	for _, b := range r.Sky {
+		region := fmt.Sprintf("sky_az%03.0f_el%02.0f", b.AzimuthFrom, b.ElevationFrom)
+		rows = append(rows,
+			[]string{region + "_observations", strconv.Itoa(b.Observations)},
+			[]string{region + "_mean_snr_dbhz", g(b.MeanSNR)},
+		)
+	}
+	return w.WriteAll(rows)
+}
+
+// runSurvey accumulates position statistics and sky coverage for a duration and writes them to a report, for commissioning an antenna
+func runSurvey(args []string) {
+	fs := flag.NewFlagSet("survey", flag.ExitOnError)
+	addr := fs.String("d", "localhost:2947", "gpsd address")
+	duration := fs.Duration("duration", time.Hour, "how long to survey")
+	output := fs.String("output", "survey.json", "file to write the report to")
+	format := fs.String("format", "json", "report format (json or csv)")
+	listen := fs.String("l", "", "address to serve progress metrics on while surveying (empty to disable)")
+	interval := fs.Duration("p", time.Second, "gpsd poll interval")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s survey [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *format != "json" && *format != "csv" {
+		log.Fatalf("Unknown survey format %q", *format)
+	}
+
+	registry := prometheus.NewRegistry()
+	e := newExporter(*addr, registry)
+	s := newSurvey(*addr, registry)
+	e.onReport = s.observe
+	dialer, err := newDialer(*proxyURL, *sshTarget)
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := &gpsdClient{
+		addr:         normalizeAddr(*addr, defaultGPSDPort),
+		pollInterval: *interval,
+		dialer:       dialer,
+		exporter:     e,
+	}
+	go client.run()
+	go client.pollLoop()
+
+	if *listen != "" {
+		go func() {
+			log.Infof("Serving survey progress on %s/metrics", *listen)
+			log.Fatal(http.ListenAndServe(*listen, promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+		}()
+	}
+
+	log.Infof("Surveying %s for %s", *addr, *duration)
+	start := time.Now()
+	ticker := time.NewTicker(time.Second)
+	for now := range ticker.C {
+		elapsed := now.Sub(start)
+		s.progress.Set(math.Min(elapsed.Seconds()/duration.Seconds(), 1))
+		if elapsed >= *duration {
+			break
+		}
+		if int(elapsed.Seconds())%60 == 0 {
+			r := s.result()
+			log.Infof("Survey %.0f%% done: %d fixes, %.2fm/%.2fm/%.2fm north/east/up stddev, %.0f%% of the sky covered",
+				100*elapsed.Seconds()/duration.Seconds(), r.Fixes, r.StdNorth, r.StdEast, r.StdUp, 100*r.Coverage)
+		}
+	}
+	ticker.Stop()
+
+	r := s.result()
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *format == "csv" {
+		err = r.writeCSV(f)
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("Error writing survey report: %v", err)
+	}
+	log.Infof("Wrote survey report of %d fixes to %s", r.Fixes, *output)
+	if r.Fixes == 0 {
+		log.Error("No fixes received during the survey")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/proxy"
+)
+
+// targetConfig is a gpsd instance to poll
+type targetConfig struct {
+	addr         string
+	pollInterval time.Duration // Zero uses the global poll interval
+}
+
+// targetsFlag is a repeatable flag of gpsd targets in addr[@interval] form
+type targetsFlag []targetConfig
+
+func (f *targetsFlag) String() string {
+	var addrs []string
+	for _, t := range *f {
+		addrs = append(addrs, t.addr)
+	}
+	return strings.Join(addrs, ", ")
+}
+
+func (f *targetsFlag) Set(value string) error {
+	t := targetConfig{addr: value}
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		interval, err := time.ParseDuration(value[i+1:])
+		if err != nil {
+			return fmt.Errorf("invalid poll interval for %s: %w", value[:i], err)
+		}
+		t.addr, t.pollInterval = value[:i], interval
+	}
+	t.addr = normalizeAddr(t.addr, defaultGPSDPort)
+	*f = append(*f, t)
+	return nil
+}
+
+// startTarget starts polling a gpsd target, registering its metrics with reg. Closing done stops it, nil to run forever.
+func startTarget(t targetConfig, reg prometheus.Registerer, dialer proxy.ContextDialer, done chan struct{}) (*gpsdClient, error) {
+	if t.pollInterval == 0 {
+		t.pollInterval = *pollInterval
+	}
+	longest := t.pollInterval
+	if *adaptivePoll && *maxPollInterval > longest {
+		longest = *maxPollInterval
+	}
+	if *readTimeout > 0 && *readTimeout <= longest {
+		log.Warnf("Read timeout %s is not longer than the %s poll interval %s, connections to an idle gpsd will time out", *readTimeout, t.addr, longest)
+	}
+	if *stallTimeout > 0 && *stallTimeout <= longest {
+		log.Warnf("Stall timeout %s is not longer than the %s poll interval %s, connections to an idle gpsd will be reset", *stallTimeout, t.addr, longest)
+	}
+
+	e := newExporter(t.addr, reg)
+	if err := e.loadReference(); err != nil {
+		return nil, err
+	}
+	if err := e.loadState(); err != nil {
+		return nil, err
+	}
+	client := &gpsdClient{
+		addr:         t.addr,
+		pollInterval: t.pollInterval,
+		dialer:       dialer,
+		exporter:     e,
+		done:         done,
+	}
+	if err := client.loadOverride(); err != nil {
+		return nil, err
+	}
+	if len(staleness) > 0 {
+		go e.supervise("expire", done, func() { e.expireStale(done) })
+	}
+	go e.supervise("connection", done, client.run)
+	go e.supervise("poll", done, client.pollLoop)
+	if *devicesInterval > 0 {
+		go e.supervise("devices", done, client.devicesLoop)
+	}
+	if *stallTimeout > 0 {
+		go e.supervise("watchdog", done, client.watchdog)
+	}
+	return client, nil
+}
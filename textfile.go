@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// textfileName is the file written for node_exporter's textfile collector
+const textfileName = "gpsd.prom"
+
+// textfileGatherer gathers from g without the Go runtime, process, and HTTP handler metrics, which node_exporter exports itself
+func textfileGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		var filtered []*dto.MetricFamily
+		for _, mf := range families {
+			name := mf.GetName()
+			if strings.HasPrefix(name, "go_") || strings.HasPrefix(name, "process_") || strings.HasPrefix(name, "promhttp_") {
+				continue
+			}
+			filtered = append(filtered, mf)
+		}
+		return filtered, err
+	})
+}
+
+// writeTextfile atomically rewrites the textfile every interval
+func writeTextfile(dir string, interval time.Duration, g prometheus.Gatherer) {
+	path := filepath.Join(dir, textfileName)
+	log.Infof("Writing metrics to %s every %s", path, interval)
+	g = textfileGatherer(g)
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		if err := prometheus.WriteToTextfile(path, g); err != nil {
+			log.Warnf("Error writing %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// trip is a period of movement of a device
+type trip struct {
+	Target   string     `json:"target"`
+	Device   string     `json:"device"`
+	Start    time.Time  `json:"start"`
+	End      *time.Time `json:"end,omitempty"` // Nil while the trip is in progress
+	Distance float64    `json:"distance_meters"`
+	StartLat float64    `json:"start_lat,omitempty"` // Omitted when positions are redacted
+	StartLon float64    `json:"start_lon,omitempty"`
+	EndLat   float64    `json:"end_lat,omitempty"`
+	EndLon   float64    `json:"end_lon,omitempty"`
+}
+
+// duration returns how long the trip lasted, or has lasted so far as of t
+func (tr *trip) duration(t time.Time) time.Duration {
+	if tr.End != nil {
+		return tr.End.Sub(tr.Start)
+	}
+	return t.Sub(tr.Start)
+}
+
+// updateTrip starts a trip when the device moves faster than the start speed and ends it once it has been slower for the dwell time
+func (e *exporter) updateTrip(m *motionState, tpv *TPV, t time.Time, d float64) {
+	device := tpv.Device
+	if tpv.Speed >= *tripStartSpeed {
+		m.lastMoving = t
+		if m.trip == nil {
+			m.trip = &trip{Target: e.target, Device: device, Start: t, StartLat: tpv.Lat, StartLon: tpv.Lon}
+			e.series(e.tripActive, device).Set(1)
+		}
+	}
+	if m.trip == nil {
+		return
+	}
+
+	m.trip.Distance += d
+	m.trip.EndLat, m.trip.EndLon = tpv.Lat, tpv.Lon
+	if t.Sub(m.lastMoving) < *tripDwell {
+		e.series(e.tripDistance, device).Set(m.trip.Distance)
+		e.series(e.tripDuration, device).Set(m.trip.duration(t).Seconds())
+		return
+	}
+
+	// The trip ended when the device stopped, not when the dwell time passed
+	end := m.lastMoving
+	m.trip.End = &end
+	e.trips = append(e.trips, m.trip)
+	if len(e.trips) > *tripHistory {
+		e.trips = e.trips[len(e.trips)-*tripHistory:]
+	}
+	m.trip = nil
+	e.tripsTotal.WithLabelValues(device).Inc()
+	e.series(e.tripActive, device).Set(0)
+	e.series(e.tripDistance, device).Set(0)
+	e.series(e.tripDuration, device).Set(0)
+}
+
+// recentTrips returns the completed trips and those in progress, oldest first
+func (e *exporter) recentTrips() []trip {
+	e.reportMu.Lock()
+	defer e.reportMu.Unlock()
+	var trips []trip
+	for _, tr := range e.trips {
+		trips = append(trips, tr.public())
+	}
+	for _, m := range e.motion {
+		if m.trip != nil {
+			trips = append(trips, m.trip.public())
+		}
+	}
+	return trips
+}
+
+// public returns a copy of the trip with its positions limited by the privacy mode
+func (tr *trip) public() trip {
+	public := *tr
+	public.StartLat, public.StartLon, _ = privacy.position(tr.StartLat, tr.StartLon)
+	public.EndLat, public.EndLon, _ = privacy.position(tr.EndLat, tr.EndLon)
+	return public
+}
+
+// tripsHandler serves the recent trips of every source as JSON
+func tripsHandler(sources *sourceSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		trips := []trip{}
+		for _, e := range sources.list() {
+			trips = append(trips, e.recentTrips()...)
+		}
+		sort.Slice(trips, func(i, j int) bool { return trips[i].Start.Before(trips[j].Start) })
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(trips)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles holds the single-page UI and the scripts it loads, so it works on hosts without internet access
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded single-page UI at /ui and its scripts under /ui/.
+// The page loads its script and the API with URLs relative to /ui, so /ui/ redirects there rather than serving it.
+func uiHandler() http.Handler {
+	files, _ := fs.Sub(uiFiles, "ui")
+	assets := http.StripPrefix("/ui/", http.FileServer(http.FS(files)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ui/", "/ui/index.html":
+			// Relative so that it also works under the path prefix of a reverse proxy, which http.Redirect would drop
+			w.Header().Set("Location", "../ui")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		case "/ui":
+		default:
+			assets.ServeHTTP(w, r)
+			return
+		}
+		index, _ := fs.ReadFile(files, "index.html")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(index)
+	})
+}
@@ -0,0 +1,112 @@
+// A minimal slippy map of OpenStreetMap tiles with a position marker, served with the UI so it works without a CDN.
+// Tiles are still fetched from the tile server; when it can't be reached, the marker is drawn on an empty map.
+class TileMap {
+    constructor(el, url, attribution) {
+        this.el = el;
+        this.url = url;
+        this.zoom = 2;
+        this.center = {lat: 0, lon: 0};
+        this.tiles = new Map(); // Tile images by z/x/y, reused while in view
+
+        el.style.position = "relative";
+        el.style.overflow = "hidden";
+        el.style.cursor = "grab";
+        el.style.touchAction = "none";
+        this.layer = document.createElement("div");
+        this.marker = document.createElement("div");
+        this.marker.style.cssText = "position:absolute;width:12px;height:12px;margin:-8px 0 0 -8px;border:2px solid #fff;border-radius:50%;background:#38f;display:none;";
+        const credit = document.createElement("div");
+        credit.style.cssText = "position:absolute;right:0;bottom:0;padding:0 4px;font-size:10px;background:rgba(0,0,0,.5);";
+        credit.innerHTML = attribution;
+        el.append(this.layer, this.marker, credit);
+
+        let drag = null;
+        el.addEventListener("pointerdown", (e) => {
+            drag = {x: e.clientX, y: e.clientY};
+            el.setPointerCapture(e.pointerId);
+            el.style.cursor = "grabbing";
+        });
+        el.addEventListener("pointermove", (e) => {
+            if (!drag) {
+                return;
+            }
+            const p = this.project(this.center, this.zoom);
+            this.center = this.unproject({x: p.x - (e.clientX - drag.x), y: p.y - (e.clientY - drag.y)}, this.zoom);
+            drag = {x: e.clientX, y: e.clientY};
+            this.render();
+        });
+        el.addEventListener("pointerup", () => {
+            drag = null;
+            el.style.cursor = "grab";
+        });
+        el.addEventListener("wheel", (e) => {
+            e.preventDefault();
+            this.setView(this.center, this.zoom + (e.deltaY < 0 ? 1 : -1));
+        }, {passive: false});
+        new ResizeObserver(() => this.render()).observe(el);
+    }
+
+    // project returns the Web Mercator pixel coordinates of a position at a zoom level
+    project(pos, zoom) {
+        const size = 256 * 2 ** zoom;
+        const lat = Math.max(-85.0511, Math.min(85.0511, pos.lat)) * Math.PI / 180;
+        return {
+            x: (pos.lon + 180) / 360 * size,
+            y: (1 - Math.log(Math.tan(lat) + 1 / Math.cos(lat)) / Math.PI) / 2 * size,
+        };
+    }
+
+    unproject(p, zoom) {
+        const size = 256 * 2 ** zoom;
+        const n = Math.PI - 2 * Math.PI * p.y / size;
+        return {lat: Math.atan(Math.sinh(n)) * 180 / Math.PI, lon: p.x / size * 360 - 180};
+    }
+
+    setView([lat, lon], zoom) {
+        this.center = {lat, lon};
+        this.zoom = Math.max(1, Math.min(19, zoom));
+        this.render();
+    }
+
+    setMarker([lat, lon]) {
+        this.position = {lat, lon};
+        this.render();
+    }
+
+    render() {
+        const width = this.el.clientWidth, height = this.el.clientHeight;
+        const c = this.project(this.center, this.zoom);
+        const left = c.x - width / 2, top = c.y - height / 2;
+        const n = 2 ** this.zoom;
+        const seen = new Set();
+        for (let x = Math.floor(left / 256); x * 256 < left + width; x++) {
+            for (let y = Math.max(0, Math.floor(top / 256)); y * 256 < top + height && y < n; y++) {
+                const key = `${this.zoom}/${x}/${y}`;
+                seen.add(key);
+                let img = this.tiles.get(key);
+                if (!img) {
+                    img = document.createElement("img");
+                    img.style.cssText = "position:absolute;width:256px;height:256px;";
+                    img.onerror = () => img.style.visibility = "hidden";
+                    img.src = this.url.replace("{z}", this.zoom).replace("{x}", ((x % n) + n) % n).replace("{y}", y);
+                    this.tiles.set(key, img);
+                    this.layer.appendChild(img);
+                }
+                img.style.left = (x * 256 - left) + "px";
+                img.style.top = (y * 256 - top) + "px";
+            }
+        }
+        for (const [key, img] of this.tiles) {
+            if (!seen.has(key)) {
+                img.remove();
+                this.tiles.delete(key);
+            }
+        }
+        if (this.position) {
+            const p = this.project(this.position, this.zoom);
+            this.marker.style.left = (p.x - left) + "px";
+            this.marker.style.top = (p.y - top) + "px";
+            this.marker.style.display = "block";
+        }
+    }
+}
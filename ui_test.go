@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUIHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	ui := uiHandler()
+	mux.Handle("/ui", ui)
+	mux.Handle("/ui/", ui)
+	for _, tt := range []struct {
+		path, location string
+		status         int
+		contentType    string
+		body           string
+	}{
+		{path: "/ui", status: http.StatusOK, contentType: "text/html", body: `src="ui/map.js"`},
+		{path: "/ui/", status: http.StatusMovedPermanently, location: "../ui"},
+		{path: "/ui/index.html", status: http.StatusMovedPermanently, location: "../ui"},
+		{path: "/ui/map.js", status: http.StatusOK, contentType: "javascript", body: "class TileMap"},
+		{path: "/ui/missing.js", status: http.StatusNotFound},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d", w.Code, tt.status)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("redirected to %q, want %q", location, tt.location)
+			}
+			if !strings.Contains(w.Header().Get("Content-Type"), tt.contentType) || !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("got %s content %.80q", w.Header().Get("Content-Type"), w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	connectionUptimeDesc = prometheus.NewDesc(
+		"gpsd_connection_uptime_seconds",
+		"Time since the VERSION handshake of the current gpsd connection",
+		nil, nil,
+	)
+	deviceUptimeDesc = prometheus.NewDesc(
+		"gpsd_device_uptime_seconds",
+		"Time since gpsd activated the device, from its activated timestamp",
+		[]string{"device"}, nil,
+	)
+)
+
+// uptimeCollector exports how long the gpsd connection and each active device have been up as of the scrape
+type uptimeCollector struct {
+	e *exporter
+}
+
+func (c uptimeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionUptimeDesc
+	ch <- deviceUptimeDesc
+}
+
+func (c uptimeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	c.e.mu.Lock()
+	defer c.e.mu.Unlock()
+	if !c.e.handshake.IsZero() {
+		ch <- prometheus.MustNewConstMetric(connectionUptimeDesc, prometheus.GaugeValue, now.Sub(c.e.handshake).Seconds())
+	}
+	for device, activated := range c.e.activated {
+		ch <- prometheus.MustNewConstMetric(deviceUptimeDesc, prometheus.GaugeValue, now.Sub(activated).Seconds(), device)
+	}
+}
+
+// setActivated records when gpsd activated a device, or forgets it if the activated timestamp is absent because the device is inactive.
+// Called with e.mu held.
+func (e *exporter) setActivated(device, activated string) {
+	if activated == "" {
+		delete(e.activated, device)
+		return
+	}
+	t, err := time.Parse(time.RFC3339Nano, activated)
+	if err != nil {
+		log.Debugf("Ignoring activated timestamp %q of %s: %v", activated, device, err)
+		delete(e.activated, device)
+		return
+	}
+	e.activated[device] = t
+}
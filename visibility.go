@@ -0,0 +1,69 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// satVisibility tracks how long a satellite has been continuously visible and used
+type satVisibility struct {
+	visibleSince time.Time
+	usedSince    time.Time // Zero while the satellite isn't used in the solution
+	seen         time.Time // Time of the latest SKY report the satellite was in
+}
+
+// reportGaugeVec returns a gauge vector derived from reports, registering it with the report metrics so it's expired along with its class
+func (e *exporter) reportGaugeVec(name, help, label string) *prometheus.GaugeVec {
+	v, ok := e.gaugeVecs[name]
+	if !ok {
+		v = e.factory.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{label})
+		e.gaugeVecs[name] = v
+	}
+	return v
+}
+
+// updateVisibility updates how long each satellite in a SKY report has been visible and used, forgetting those that dropped out.
+// SKY reports without satellites, which some gpsd releases send with only the DOPs, leave the durations as they are.
+func (e *exporter) updateVisibility(sky *SKY) {
+	if len(sky.Satellites) == 0 {
+		return
+	}
+	const (
+		visible = "gpsd_sat_visible_duration_seconds"
+		used    = "gpsd_sat_used_duration_seconds"
+	)
+	now := time.Now()
+	for i := range sky.Satellites {
+		sat := &sky.Satellites[i]
+		prn := prnLabel(sat.PRN)
+		v, ok := e.satellites[prn]
+		if !ok {
+			v = &satVisibility{visibleSince: now}
+			e.satellites[prn] = v
+			e.satAppearances.WithLabelValues(prn).Inc()
+		}
+		v.seen = now
+		switch {
+		case !sat.Used:
+			v.usedSince = time.Time{}
+		case v.usedSince.IsZero():
+			v.usedSince = now
+		}
+
+		e.satSnapshot.set(visible, "How long the satellite has been continuously visible", prn, now.Sub(v.visibleSince).Seconds())
+		usedFor := 0.0
+		if !v.usedSince.IsZero() {
+			usedFor = now.Sub(v.usedSince).Seconds()
+		}
+		e.satSnapshot.set(used, "How long the satellite has been continuously used in the solution, zero when unused", prn, usedFor)
+	}
+
+	for prn, v := range e.satellites {
+		if v.seen != now {
+			delete(e.satellites, prn)
+			e.satSnapshot.delete(visible, prn)
+			e.satSnapshot.delete(used, prn)
+		}
+	}
+}
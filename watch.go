@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// watchOptionNames are the boolean WATCH options that can be requested from gpsd
+var watchOptionNames = map[string]bool{"scaled": true, "split24": true, "pps": true, "timing": true}
+
+// watchOptionsFlag is a set of boolean WATCH options enabled on every connection
+type watchOptionsFlag map[string]bool
+
+func (f watchOptionsFlag) String() string {
+	return strings.Join(f.names(), ",")
+}
+
+func (f watchOptionsFlag) Set(value string) error {
+	for _, option := range strings.Split(value, ",") {
+		option = strings.ToLower(strings.TrimSpace(option))
+		if !watchOptionNames[option] {
+			return fmt.Errorf("invalid WATCH option %q (expected scaled, split24, pps, or timing)", option)
+		}
+		f[option] = true
+	}
+	return nil
+}
+
+// names returns the enabled options in a stable order
+func (f watchOptionsFlag) names() []string {
+	var names []string
+	for option := range f {
+		names = append(names, option)
+	}
+	sort.Strings(names)
+	return names
+}